@@ -0,0 +1,131 @@
+package sqlutil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// LeaseAdminHandler returns an http.Handler for inspecting and administering the leases of l.
+// It serves these paths
+// (relative to wherever it is mounted, e.g. with http.StripPrefix):
+//
+//	GET  /                  list unexpired leases as JSON (see Lessor.List)
+//	POST /revoke?name=NAME  revoke the named lease (see Lessor.Revoke)
+//
+// If readOnly is true,
+// the admin operations are not served.
+// The handler does no authentication or authorization of its own.
+func LeaseAdminHandler(l *Lessor, readOnly bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		leases, err := l.List(req.Context())
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, leases)
+	})
+	if !readOnly {
+		mux.HandleFunc("/revoke", func(w http.ResponseWriter, req *http.Request) {
+			if !requirePost(w, req) {
+				return
+			}
+			name := req.FormValue("name")
+			if name == "" {
+				http.Error(w, "missing name", http.StatusBadRequest)
+				return
+			}
+			if err := l.Revoke(req.Context(), name); err != nil {
+				adminError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return mux
+}
+
+// QueueAdminHandler returns an http.Handler for inspecting and administering q.
+// It serves these paths
+// (relative to wherever it is mounted, e.g. with http.StripPrefix):
+//
+//	GET  /depth           the number of ready jobs, as JSON {"depth": N} (see Queue.Depth)
+//	GET  /dead?limit=N    up to N dead-lettered jobs as JSON (default 100; see Queue.DeadJobs)
+//	POST /retry?id=ID     return the dead-lettered job with the given ID to the queue (see Queue.RetryDead)
+//
+// If readOnly is true,
+// the admin operations are not served.
+// The handler does no authentication or authorization of its own.
+func QueueAdminHandler(q *Queue, readOnly bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/depth", func(w http.ResponseWriter, req *http.Request) {
+		n, err := q.Depth(req.Context())
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, map[string]int64{"depth": n})
+	})
+	mux.HandleFunc("/dead", func(w http.ResponseWriter, req *http.Request) {
+		limit := 100
+		if s := req.FormValue("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+				http.Error(w, "bad limit", http.StatusBadRequest)
+				return
+			}
+		}
+		jobs, err := q.DeadJobs(req.Context(), limit)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, jobs)
+	})
+	if !readOnly {
+		mux.HandleFunc("/retry", func(w http.ResponseWriter, req *http.Request) {
+			if !requirePost(w, req) {
+				return
+			}
+			id, err := strconv.ParseInt(req.FormValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "bad id", http.StatusBadRequest)
+				return
+			}
+			if err := q.RetryDead(req.Context(), id); err != nil {
+				adminError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return mux
+}
+
+func requirePost(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, ErrLeaseNotHeld) || errors.Is(err, ErrJobNotDead) {
+		code = http.StatusNotFound
+	}
+	http.Error(w, RedactDSN(err.Error()), code)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
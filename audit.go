@@ -0,0 +1,232 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var actorCtxkey = ctxkeytype("actor")
+
+// WithActor creates a child of the given context object identifying the actor
+// (e.g. a user ID)
+// responsible for changes made in it,
+// for recording by Auditor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtxkey, actor)
+}
+
+// GetActor extracts the actor previously stored in ctx
+// (or some parent of ctx)
+// with WithActor.
+// The boolean result tells whether there is one.
+func GetActor(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorCtxkey).(string)
+	return actor, ok
+}
+
+// Auditor wraps InsertStruct, UpdateStruct, and DeleteStruct,
+// recording each change in an audit table
+// in the same transaction as the change itself.
+// Each audit record includes JSON snapshots of the row before and after the change
+// (as objects mapping column names to values),
+// the actor from the context
+// (see WithActor),
+// and a timestamp.
+//
+// The audit table must have these columns:
+//
+//	table_name  a string-compatible type
+//	row_key     a string-compatible type; a JSON object of the row's primary-key columns
+//	action      a string-compatible type; one of "insert", "update", and "delete"
+//	before      a nullable string-compatible type (like TEXT or JSONB)
+//	after       a nullable string-compatible type (like TEXT or JSONB)
+//	actor       a nullable string-compatible type
+//	at          a time.Time-compatible type (like DATETIME)
+type Auditor struct {
+	// Table is the name of the audit table.
+	// The default if this is unspecified is "audit_log".
+	Table string
+}
+
+const defaultAuditTable = "audit_log"
+
+// NewAuditor produces a new Auditor.
+func NewAuditor() *Auditor {
+	return &Auditor{}
+}
+
+func (a *Auditor) tableName() string {
+	if a.Table == "" {
+		return defaultAuditTable
+	}
+	return a.Table
+}
+
+// Insert calls InsertStruct in tx and records the change.
+// Note that columns assigned by the database
+// (such as autoincr primary keys)
+// are not known,
+// so they are omitted from the audit record.
+func (a *Auditor) Insert(ctx context.Context, tx *sql.Tx, table string, v interface{}) error {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	if err = InsertStruct(ctx, tx, table, v); err != nil {
+		return err
+	}
+	after := structColumns(rv, fields, func(f structField) bool { return !f.autoincr })
+	return a.record(ctx, tx, table, "insert", rv, fields, nil, after)
+}
+
+// Update calls UpdateStruct in tx and records the change,
+// including the row's previous contents.
+// If no row is affected,
+// nothing is recorded.
+func (a *Auditor) Update(ctx context.Context, tx *sql.Tx, table string, v interface{}) (int64, error) {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return 0, err
+	}
+	before, err := a.snapshot(ctx, tx, table, rv, fields)
+	if err != nil {
+		return 0, err
+	}
+	aff, err := UpdateStruct(ctx, tx, table, v)
+	if err != nil || aff == 0 {
+		return aff, err
+	}
+	after := structColumns(rv, fields, nil)
+	return aff, a.record(ctx, tx, table, "update", rv, fields, before, after)
+}
+
+// Delete calls DeleteStruct in tx and records the change,
+// including the row's previous contents.
+// If no row is affected,
+// nothing is recorded.
+func (a *Auditor) Delete(ctx context.Context, tx *sql.Tx, table string, v interface{}) (int64, error) {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return 0, err
+	}
+	before, err := a.snapshot(ctx, tx, table, rv, fields)
+	if err != nil {
+		return 0, err
+	}
+	aff, err := DeleteStruct(ctx, tx, table, v)
+	if err != nil || aff == 0 {
+		return aff, err
+	}
+	return aff, a.record(ctx, tx, table, "delete", rv, fields, before, nil)
+}
+
+// snapshot returns the current contents of the row identified by the primary-key fields of rv,
+// or nil if there is no such row.
+func (a *Auditor) snapshot(ctx context.Context, tx *sql.Tx, table string, rv reflect.Value, fields []structField) (map[string]interface{}, error) {
+	pks := pkFields(fields)
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("%s has no primary-key fields", rv.Type())
+	}
+	where, args := whereFields(rv, pks, 1)
+
+	const selQFmt = `SELECT * FROM %s WHERE %s`
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selQFmt, table, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying current row: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, wrapf(rows.Err(), "querying current row")
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("getting columns: %w", err)
+	}
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err = rows.Scan(ptrs...); err != nil {
+		return nil, fmt.Errorf("scanning current row: %w", err)
+	}
+	m := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		if b, ok := vals[i].([]byte); ok {
+			// Drivers commonly return text columns as []byte;
+			// record them as strings rather than base64.
+			vals[i] = string(b)
+		}
+		m[col] = vals[i]
+	}
+	return m, nil
+}
+
+// structColumns maps column names to the values of rv's fields
+// for which keep returns true
+// (or all of them, if keep is nil).
+// Values implementing driver.Valuer
+// (such as sql.NullString)
+// are converted with their Value methods.
+func structColumns(rv reflect.Value, fields []structField, keep func(structField) bool) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if keep != nil && !keep(f) {
+			continue
+		}
+		fv := rv.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			m[f.column] = nil
+			continue
+		}
+		val := fv.Interface()
+		if valuer, ok := val.(driver.Valuer); ok {
+			if v, err := valuer.Value(); err == nil {
+				val = v
+			}
+		}
+		m[f.column] = val
+	}
+	return m
+}
+
+func (a *Auditor) record(ctx context.Context, tx *sql.Tx, table, action string, rv reflect.Value, fields []structField, before, after map[string]interface{}) error {
+	rowKey, err := json.Marshal(structColumns(rv, fields, func(f structField) bool { return f.pk && !(action == "insert" && f.autoincr) }))
+	if err != nil {
+		return fmt.Errorf("encoding row key: %w", err)
+	}
+	beforeJSON, err := nullableJSON(before)
+	if err != nil {
+		return fmt.Errorf("encoding before snapshot: %w", err)
+	}
+	afterJSON, err := nullableJSON(after)
+	if err != nil {
+		return fmt.Errorf("encoding after snapshot: %w", err)
+	}
+	var actor interface{}
+	if s, ok := GetActor(ctx); ok {
+		actor = s
+	}
+
+	const insQFmt = `INSERT INTO %s (table_name, row_key, action, before, after, actor, at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	insQ := fmt.Sprintf(insQFmt, a.tableName())
+	_, err = tx.ExecContext(ctx, insQ, table, string(rowKey), action, beforeJSON, afterJSON, actor, time.Now())
+	return wrapf(err, "inserting audit record")
+}
+
+func nullableJSON(m map[string]interface{}) (interface{}, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
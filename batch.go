@@ -0,0 +1,161 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BatchSpec describes a BatchProcess job.
+type BatchSpec struct {
+	// Name identifies the job's checkpoint,
+	// so that a restarted job resumes where it left off.
+	Name string
+
+	// Table is the table to walk.
+	Table string
+
+	// KeyColumn is the table's integer primary-key column.
+	// The default if this is unspecified is "id".
+	KeyColumn string
+
+	// Where, if not empty,
+	// restricts the rows considered
+	// (with no placeholders).
+	Where string
+
+	// ChunkSize is the maximum number of rows in each chunk.
+	// The default if this is unspecified is 1000.
+	ChunkSize int
+
+	// Delay is a pause between chunks,
+	// to limit the load on the database.
+	Delay time.Duration
+
+	// Fn processes one chunk:
+	// the rows whose keys are in the inclusive range [first, last].
+	// It runs inside a transaction,
+	// in which the job's checkpoint is also updated.
+	// If it returns an error,
+	// the transaction is rolled back and BatchProcess stops.
+	Fn func(ctx context.Context, tx *sql.Tx, first, last int64) error
+
+	// CheckpointTable is the name of the table recording job progress.
+	// The default if this is unspecified is "batch_checkpoints".
+	// It must have these columns:
+	//
+	//	name        a string-compatible type, uniquely indexed
+	//	last_key    a 64-bit integer type (like BIGINT)
+	//	updated_at  a time.Time-compatible type (like DATETIME)
+	CheckpointTable string
+}
+
+const (
+	defaultBatchKeyColumn   = "id"
+	defaultBatchChunkSize   = 1000
+	defaultCheckpointsTable = "batch_checkpoints"
+)
+
+// BatchProcess walks a large table in ascending primary-key order,
+// one chunk at a time,
+// calling spec.Fn for each chunk in its own short transaction
+// and recording progress in a checkpoint table,
+// so that it can resume after a crash.
+// It returns when all rows have been processed,
+// or on the first error.
+// Once a job has completed,
+// running it again processes only rows added since
+// (with keys greater than the last one processed).
+func BatchProcess(ctx context.Context, db DB, spec BatchSpec) error {
+	keyCol := spec.KeyColumn
+	if keyCol == "" {
+		keyCol = defaultBatchKeyColumn
+	}
+	chunkSize := spec.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBatchChunkSize
+	}
+	cpTable := spec.CheckpointTable
+	if cpTable == "" {
+		cpTable = defaultCheckpointsTable
+	}
+
+	const cpSelQFmt = `SELECT last_key FROM %s WHERE name = $1`
+	var (
+		last    int64
+		hasLast = true
+	)
+	err := db.QueryRowContext(ctx, fmt.Sprintf(cpSelQFmt, cpTable), spec.Name).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		hasLast = false
+	} else if err != nil {
+		return fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	const (
+		chunkQFmt = `SELECT MIN(%[2]s), MAX(%[2]s) FROM (SELECT %[2]s FROM %[1]s WHERE %[3]s ORDER BY %[2]s LIMIT %[4]d) sub`
+		cpUpdQFmt = `UPDATE %s SET last_key = $1, updated_at = $2 WHERE name = $3`
+		cpInsQFmt = `INSERT INTO %s (name, last_key, updated_at) VALUES ($1, $2, $3)`
+	)
+	cpUpdQ := fmt.Sprintf(cpUpdQFmt, cpTable)
+	cpInsQ := fmt.Sprintf(cpInsQFmt, cpTable)
+
+	for {
+		cond := "1 = 1"
+		var args []interface{}
+		if hasLast {
+			cond = keyCol + " > $1"
+			args = append(args, last)
+		}
+		if spec.Where != "" {
+			cond += " AND (" + spec.Where + ")"
+		}
+		chunkQ := fmt.Sprintf(chunkQFmt, spec.Table, keyCol, cond, chunkSize)
+
+		var first, end sql.NullInt64
+		if err := db.QueryRowContext(ctx, chunkQ, args...).Scan(&first, &end); err != nil {
+			return fmt.Errorf("finding next chunk: %w", err)
+		}
+		if !end.Valid {
+			return nil
+		}
+
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			if err = spec.Fn(ctx, tx, first.Int64, end.Int64); err != nil {
+				return err
+			}
+
+			now := time.Now()
+			res, err := tx.ExecContext(ctx, cpUpdQ, end.Int64, now, spec.Name)
+			if err != nil {
+				return fmt.Errorf("updating checkpoint: %w", err)
+			}
+			if aff, err := res.RowsAffected(); err != nil {
+				return fmt.Errorf("counting affected rows: %w", err)
+			} else if aff == 0 {
+				if _, err = tx.ExecContext(ctx, cpInsQ, spec.Name, end.Int64, now); err != nil {
+					return fmt.Errorf("inserting checkpoint: %w", err)
+				}
+			}
+			return tx.Commit()
+		}()
+		if err != nil {
+			return fmt.Errorf("processing chunk [%d, %d]: %w", first.Int64, end.Int64, err)
+		}
+		last, hasLast = end.Int64, true
+
+		if spec.Delay > 0 {
+			if err := sleep(ctx, spec.Delay); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package bench provides reproducible benchmarks of sqlutil's query helpers
+// against hand-written scan loops,
+// across row counts and column types,
+// so that changes to the reflection path can be evaluated.
+//
+// The benchmarks run against an in-memory sqlmockutil database,
+// isolating the cost of the helpers from that of any real driver or server.
+// To run them, add a benchmark to any test file:
+//
+//	func BenchmarkSqlutil(b *testing.B) { bench.All(b) }
+//
+// and run go test -bench Sqlutil.
+// Alternatively, Run runs them outside of go test.
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+// RowCounts are the result sizes benchmarked.
+var RowCounts = []int{1, 100, 10000}
+
+const query = "SELECT * FROM bench"
+
+// A shape is a set of result columns,
+// with a ForQueryRows callback and a hand-written scan loop for them.
+type shape struct {
+	name    string
+	columns []string
+	row     func(i int) []interface{}
+	fqr     interface{}
+	manual  func(*sql.Rows) error
+}
+
+var shapes = []shape{
+	{
+		name:    "int",
+		columns: []string{"a"},
+		row:     func(i int) []interface{} { return []interface{}{int64(i)} },
+		fqr:     func(a int64) {},
+		manual: func(rows *sql.Rows) error {
+			var a int64
+			return rows.Scan(&a)
+		},
+	},
+	{
+		name:    "string",
+		columns: []string{"a", "b"},
+		row: func(i int) []interface{} {
+			return []interface{}{strconv.Itoa(i), fmt.Sprintf("row number %d", i)}
+		},
+		fqr: func(a, b string) {},
+		manual: func(rows *sql.Rows) error {
+			var a, b string
+			return rows.Scan(&a, &b)
+		},
+	},
+	{
+		name:    "mixed",
+		columns: []string{"a", "b", "c", "d", "e", "f"},
+		row: func(i int) []interface{} {
+			return []interface{}{int64(i), strconv.Itoa(i), float64(i) / 2, i%2 == 0, time.Unix(int64(i), 0).UTC(), []byte(strconv.Itoa(i))}
+		},
+		fqr: func(a int64, b string, c float64, d bool, e time.Time, f []byte) {},
+		manual: func(rows *sql.Rows) error {
+			var (
+				a int64
+				b string
+				c float64
+				d bool
+				e time.Time
+				f []byte
+			)
+			return rows.Scan(&a, &b, &c, &d, &e, &f)
+		},
+	},
+}
+
+// All runs every benchmark as a sub-benchmark of b.
+func All(b *testing.B) {
+	for _, bm := range Benchmarks() {
+		b.Run(bm.Name, bm.F)
+	}
+}
+
+// Benchmarks returns every benchmark,
+// named approach/shape/rows.
+func Benchmarks() []testing.InternalBenchmark {
+	var result []testing.InternalBenchmark
+	for _, s := range shapes {
+		for _, n := range RowCounts {
+			s, n := s, n
+			suffix := fmt.Sprintf("%s/%d", s.name, n)
+			result = append(result,
+				testing.InternalBenchmark{
+					Name: "ForQueryRows/" + suffix,
+					F:    func(b *testing.B) { benchHelper(b, s, n, sqlutil.ForQueryRows) },
+				},
+				testing.InternalBenchmark{
+					Name: "ForQueryRowsReuse/" + suffix,
+					F:    func(b *testing.B) { benchHelper(b, s, n, sqlutil.ForQueryRowsReuse) },
+				},
+				testing.InternalBenchmark{
+					Name: "Manual/" + suffix,
+					F:    func(b *testing.B) { benchManual(b, s, n) },
+				},
+			)
+		}
+	}
+	return result
+}
+
+// Run runs every benchmark and writes the results to w.
+func Run(w io.Writer) {
+	for _, bm := range Benchmarks() {
+		r := testing.Benchmark(bm.F)
+		fmt.Fprintf(w, "%-32s %s %s\n", bm.Name, r.String(), r.MemString())
+	}
+}
+
+func setup(s shape, n int) *sqlmockutil.Mock {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = s.row(i)
+	}
+	m := sqlmockutil.New()
+	m.AddRows(query, s.columns, rows)
+	return m
+}
+
+// benchHelper benchmarks a ForQueryRows-like helper.
+func benchHelper(b *testing.B, s shape, n int, helper func(context.Context, sqlutil.QueryerContext, string, ...interface{}) error) {
+	m := setup(s, n)
+	defer m.Close()
+
+	var (
+		ctx = context.Background()
+		db  = m.DB()
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := helper(ctx, db, query, s.fqr); err != nil {
+			b.Fatal(err)
+		}
+		m.Reset()
+	}
+}
+
+func benchManual(b *testing.B, s shape, n int) {
+	m := setup(s, n)
+	defer m.Close()
+
+	var (
+		ctx = context.Background()
+		db  = m.DB()
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := manual(ctx, db, s); err != nil {
+			b.Fatal(err)
+		}
+		m.Reset()
+	}
+}
+
+func manual(ctx context.Context, db *sql.DB, s shape) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := s.manual(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
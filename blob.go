@@ -0,0 +1,203 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Blobs stores very large values,
+// which are written and read as streams
+// so that they need not fit in memory.
+//
+// On Postgres,
+// blobs are server-side large objects,
+// identified by their OIDs
+// (in decimal).
+// Elsewhere they are emulated with a table holding each blob as a sequence of chunks,
+// with these columns:
+//
+//	blob_id  a string-compatible type (like TEXT)
+//	seq      an integer type
+//	data     a binary type large enough for ChunkSize bytes (like BLOB or LONGBLOB)
+//
+// with a unique index on (blob_id, seq).
+type Blobs struct {
+	db DB
+
+	// Dialect is the database's SQL dialect.
+	Dialect Dialect
+
+	// Table is the name of the chunk table used when Dialect is not Postgres.
+	// The default if this is unspecified is "blob_chunks".
+	Table string
+
+	// ChunkSize is the number of bytes written or read in each statement.
+	// The default if this is unspecified is 1MiB.
+	ChunkSize int
+}
+
+const (
+	defaultBlobsTable     = "blob_chunks"
+	defaultBlobsChunkSize = 1 << 20
+)
+
+// NewBlobs produces a new Blobs.
+func NewBlobs(db DB, d Dialect) *Blobs {
+	return &Blobs{db: db, Dialect: d}
+}
+
+func (b *Blobs) tableName() string {
+	if b.Table == "" {
+		return defaultBlobsTable
+	}
+	return b.Table
+}
+
+func (b *Blobs) chunkSize() int {
+	if b.ChunkSize <= 0 {
+		return defaultBlobsChunkSize
+	}
+	return b.ChunkSize
+}
+
+// Create creates a new, empty blob
+// and returns its ID and a writer for its contents.
+// The writer must be closed to flush the final chunk.
+// Writes are not transactional:
+// if writing fails,
+// the caller should Delete the partial blob.
+func (b *Blobs) Create(ctx context.Context) (string, io.WriteCloser, error) {
+	var id string
+	if b.Dialect == Postgres {
+		var oid int64
+		if err := b.db.QueryRowContext(ctx, `SELECT lo_create(0)`).Scan(&oid); err != nil {
+			return "", nil, fmt.Errorf("creating large object: %w", err)
+		}
+		id = strconv.FormatInt(oid, 10)
+	} else {
+		var err error
+		if id, err = newKey(); err != nil {
+			return "", nil, fmt.Errorf("computing blob ID: %w", err)
+		}
+	}
+	return id, &blobWriter{ctx: ctx, b: b, id: id, buf: make([]byte, 0, b.chunkSize())}, nil
+}
+
+// Open returns a reader for the contents of the blob with the given ID.
+func (b *Blobs) Open(ctx context.Context, id string) io.Reader {
+	return &blobReader{ctx: ctx, b: b, id: id}
+}
+
+// Delete deletes the blob with the given ID.
+func (b *Blobs) Delete(ctx context.Context, id string) error {
+	if b.Dialect == Postgres {
+		_, err := b.db.ExecContext(ctx, `SELECT lo_unlink($1)`, id)
+		return wrapf(err, "unlinking large object")
+	}
+	const delQFmt = `DELETE FROM %s WHERE blob_id = $1`
+	_, err := b.db.ExecContext(ctx, fmt.Sprintf(delQFmt, b.tableName()), id)
+	return wrapf(err, "deleting blob chunks")
+}
+
+type blobWriter struct {
+	ctx context.Context
+	b   *Blobs
+	id  string
+	buf []byte
+	n   int64 // bytes flushed so far
+	seq int64 // chunks flushed so far
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		k := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		p = p[k:]
+		written += k
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *blobWriter) Close() error {
+	return w.flush()
+}
+
+func (w *blobWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.b.Dialect == Postgres {
+		_, err = w.b.db.ExecContext(w.ctx, `SELECT lo_put($1, $2, $3)`, w.id, w.n, w.buf)
+	} else {
+		const insQFmt = `INSERT INTO %s (blob_id, seq, data) VALUES ($1, $2, $3)`
+		_, err = w.b.db.ExecContext(w.ctx, fmt.Sprintf(insQFmt, w.b.tableName()), w.id, w.seq, w.buf)
+	}
+	if err != nil {
+		return fmt.Errorf("writing blob %s at offset %d: %w", w.id, w.n, err)
+	}
+	w.n += int64(len(w.buf))
+	w.seq++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type blobReader struct {
+	ctx context.Context
+	b   *Blobs
+	id  string
+	buf []byte
+	n   int64 // bytes fetched so far
+	seq int64 // chunks fetched so far
+	eof bool
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.fetch(); err != nil {
+			return 0, err
+		}
+	}
+	k := copy(p, r.buf)
+	r.buf = r.buf[k:]
+	return k, nil
+}
+
+func (r *blobReader) fetch() error {
+	var (
+		chunk []byte
+		err   error
+	)
+	if r.b.Dialect == Postgres {
+		err = r.b.db.QueryRowContext(r.ctx, `SELECT lo_get($1, $2, $3)`, r.id, r.n, r.b.chunkSize()).Scan(&chunk)
+		if err == nil && len(chunk) == 0 {
+			r.eof = true
+		}
+	} else {
+		const selQFmt = `SELECT data FROM %s WHERE blob_id = $1 AND seq = $2`
+		err = r.b.db.QueryRowContext(r.ctx, fmt.Sprintf(selQFmt, r.b.tableName()), r.id, r.seq).Scan(&chunk)
+		if errors.Is(err, sql.ErrNoRows) {
+			r.eof, err = true, nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("reading blob %s at offset %d: %w", r.id, r.n, err)
+	}
+	r.buf = chunk
+	r.n += int64(len(chunk))
+	r.seq++
+	return nil
+}
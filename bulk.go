@@ -0,0 +1,112 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MaxParams is the maximum number of placeholders BulkInsert, ForQueryRowsIn, and QueryAllIn put in a single statement
+// when the context carries no Dialect
+// (see WithDialect).
+// It is Postgres's limit.
+var MaxParams = 65535
+
+var dialectCtxkey = ctxkeytype("dialect")
+
+// WithDialect creates a child of the given context object
+// carrying the dialect of the database used in it.
+// Helpers that take no Dialect argument,
+// like BulkInsert, ForQueryRowsIn, and QueryAllIn,
+// then write their placeholders with d.Placeholder,
+// and split their statements at d.MaxParams() placeholders
+// instead of MaxParams.
+// Without a Dialect they use $1, $2, ... placeholders.
+func WithDialect(ctx context.Context, d Dialect) context.Context {
+	return context.WithValue(ctx, dialectCtxkey, d)
+}
+
+// placeholder returns the placeholder for the nth (1-based) argument of statements made in ctx.
+func placeholder(ctx context.Context) func(n int) string {
+	if d, ok := ctx.Value(dialectCtxkey).(Dialect); ok {
+		return d.Placeholder
+	}
+	return Postgres.Placeholder
+}
+
+// maxParams returns the placeholder limit for statements made in ctx.
+func maxParams(ctx context.Context) int {
+	if d, ok := ctx.Value(dialectCtxkey).(Dialect); ok {
+		return d.MaxParams()
+	}
+	return MaxParams
+}
+
+// CopyFromer is implemented by handles with a native bulk-loading protocol,
+// like Postgres's COPY.
+// BulkInsert uses it when db implements it.
+// It is implemented by the pgx adapter in github.com/bobg/sqlutil/sqlutilpgx.
+type CopyFromer interface {
+	CopyFromRows(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error)
+}
+
+// BulkInsert inserts rows into the given columns of table,
+// using multi-row INSERT statements with as many rows each as the placeholder limit allows
+// (MaxParams, or that of the Dialect in ctx; see WithDialect),
+// or db's CopyFromRows method if it is a CopyFromer.
+// Each row must have one value per column.
+// The statements are not run in a transaction;
+// pass a *sql.Tx as db to make the whole insertion atomic.
+func BulkInsert(ctx context.Context, db ExecerContext, table string, columns []string, rows [][]interface{}) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	if c, ok := db.(CopyFromer); ok {
+		_, err := c.CopyFromRows(ctx, table, columns, rows)
+		return wrapf(err, "copying into database")
+	}
+	var (
+		limit = maxParams(ctx)
+		ph    = placeholder(ctx)
+	)
+	perStmt := limit / len(columns)
+	if perStmt < 1 {
+		return fmt.Errorf("too many columns (%d) for placeholder limit (%d)", len(columns), limit)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+
+	for len(rows) > 0 {
+		batch := rows
+		if len(batch) > perStmt {
+			batch = batch[:perStmt]
+		}
+		rows = rows[len(batch):]
+
+		var (
+			b    strings.Builder
+			args = make([]interface{}, 0, len(batch)*len(columns))
+		)
+		b.WriteString(prefix)
+		for i, row := range batch {
+			if len(row) != len(columns) {
+				return fmt.Errorf("row has %d values for %d columns", len(row), len(columns))
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('(')
+			for j, val := range row {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				args = append(args, val)
+				b.WriteString(ph(len(args)))
+			}
+			b.WriteByte(')')
+		}
+		if _, err := db.ExecContext(ctx, b.String(), args...); err != nil {
+			return fmt.Errorf("inserting into database: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package sqlutil_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+func TestBulkInsert(t *testing.T) {
+	// With SQLite's limit of 999 placeholders,
+	// three columns allow 333 rows per statement.
+	const numRows = 700
+
+	rows := make([][]interface{}, 0, numRows)
+	for i := 0; i < numRows; i++ {
+		rows = append(rows, []interface{}{i, fmt.Sprintf("p%d", i), i * 2})
+	}
+
+	m := sqlmockutil.New()
+	defer m.Close()
+	for _, n := range []int{333, 333, 34} {
+		m.AddResult(bulkInsert(sqlutil.SQLite, n), 0, int64(n))
+	}
+
+	ctx := sqlutil.WithDialect(context.Background(), sqlutil.SQLite)
+	if err := sqlutil.BulkInsert(ctx, m.DB(), "people", []string{"id", "name", "score"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	stmts := m.Statements()
+	if len(stmts) != 3 {
+		t.Fatalf("got %d statements, want 3", len(stmts))
+	}
+	if args := stmts[2].Args; len(args) != 34*3 || args[0] != int64(666) {
+		t.Errorf("got %d args starting with %v in the last statement, want %d starting with 666", len(args), args[0], 34*3)
+	}
+}
+
+func TestBulkInsertPlaceholders(t *testing.T) {
+	rows := [][]interface{}{{1, "a", 2}, {3, "b", 4}}
+	for _, d := range []sqlutil.Dialect{sqlutil.Postgres, sqlutil.MySQL} {
+		t.Run(d.String(), func(t *testing.T) {
+			m := sqlmockutil.New()
+			defer m.Close()
+			m.AddResult(bulkInsert(d, 2), 0, 2)
+
+			ctx := context.Background()
+			if d != sqlutil.Postgres {
+				ctx = sqlutil.WithDialect(ctx, d)
+			}
+			if err := sqlutil.BulkInsert(ctx, m.DB(), "people", []string{"id", "name", "score"}, rows); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// bulkInsert is the statement BulkInsert produces for n rows of people in dialect d.
+func bulkInsert(d sqlutil.Dialect, n int) string {
+	tuples := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		tuples = append(tuples, fmt.Sprintf("(%s, %s, %s)", d.Placeholder(3*i+1), d.Placeholder(3*i+2), d.Placeholder(3*i+3)))
+	}
+	return "INSERT INTO people (id, name, score) VALUES " + strings.Join(tuples, ", ")
+}
+
+type copier struct {
+	sqlutil.ExecerContext
+	table string
+	rows  int
+}
+
+func (c *copier) CopyFromRows(_ context.Context, table string, _ []string, rows [][]interface{}) (int64, error) {
+	c.table, c.rows = table, len(rows)
+	return int64(len(rows)), nil
+}
+
+func TestBulkInsertCopyFromer(t *testing.T) {
+	c := new(copier)
+	if err := sqlutil.BulkInsert(context.Background(), c, "people", []string{"id"}, [][]interface{}{{1}, {2}}); err != nil {
+		t.Fatal(err)
+	}
+	if c.table != "people" || c.rows != 2 {
+		t.Errorf("got CopyFromRows(%q, %d rows), want (people, 2 rows)", c.table, c.rows)
+	}
+}
@@ -0,0 +1,168 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChunkOptions configure DeleteWhereChunked and UpdateWhereChunked.
+// A nil *ChunkOptions is equivalent to a zero-valued one.
+type ChunkOptions struct {
+	// KeyColumn is the table's (unique, sortable) primary-key column,
+	// used to divide the matching rows into chunks.
+	// The default if this is unspecified is "id".
+	KeyColumn string
+
+	// Delay is a pause between chunks,
+	// giving replicas a chance to catch up and other transactions a chance at the locks.
+	// The default if this is unspecified is 100ms.
+	// Use a negative value for no pause.
+	Delay time.Duration
+}
+
+const defaultChunkDelay = 100 * time.Millisecond
+
+func (o *ChunkOptions) keyColumn() string {
+	if o == nil || o.KeyColumn == "" {
+		return defaultBatchKeyColumn
+	}
+	return o.KeyColumn
+}
+
+func (o *ChunkOptions) delay() time.Duration {
+	if o == nil || o.Delay == 0 {
+		return defaultChunkDelay
+	}
+	return o.Delay
+}
+
+// DeleteWhereChunked deletes the rows of table matching where
+// (an SQL boolean expression with placeholders $1, $2, ... for args)
+// in chunks of at most chunkSize rows,
+// in ascending key order,
+// pausing between chunks.
+// Each chunk is deleted with its own statement,
+// so no single statement holds locks on,
+// or generates replication traffic for,
+// more than chunkSize rows.
+// It returns the total number of rows deleted,
+// including those deleted before any error.
+func DeleteWhereChunked(ctx context.Context, db DB, table, where string, args []interface{}, chunkSize int, opts *ChunkOptions) (int64, error) {
+	const delQFmt = `DELETE FROM %s WHERE %s`
+	return execChunked(ctx, db, table, where, args, nil, chunkSize, opts, func(cond string) string {
+		return fmt.Sprintf(delQFmt, table, cond)
+	})
+}
+
+// UpdateWhereChunked is like DeleteWhereChunked
+// but updates the matching rows with set
+// (an SQL SET clause, without the SET keyword, e.g. "archived = TRUE"),
+// with its own placeholders $1, $2, ... for setArgs.
+// Both set and where number their placeholders from $1;
+// in each statement,
+// where's placeholders are renumbered to follow set's.
+// Since each key range is visited once,
+// rows that still match where after the update are not updated again.
+// It returns the total number of rows updated.
+func UpdateWhereChunked(ctx context.Context, db DB, table, set string, setArgs []interface{}, where string, args []interface{}, chunkSize int, opts *ChunkOptions) (int64, error) {
+	const updQFmt = `UPDATE %s SET %s WHERE %s`
+	return execChunked(ctx, db, table, where, args, setArgs, chunkSize, opts, func(cond string) string {
+		return fmt.Sprintf(updQFmt, table, set, cond)
+	})
+}
+
+// execChunked runs stmt on each chunk of the rows matching where.
+// The statement's args are stmtArgs
+// (referred to by stmt's own placeholders, which must precede cond in its text),
+// then args,
+// then the key range.
+func execChunked(ctx context.Context, db DB, table, where string, args, stmtArgs []interface{}, chunkSize int, opts *ChunkOptions, stmt func(cond string) string) (int64, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultBatchChunkSize
+	}
+	if where == "" {
+		where = "1 = 1"
+	}
+
+	var (
+		keyCol = opts.keyColumn()
+		delay  = opts.delay()
+
+		// Placeholders are numbered in order of their appearance in the query text,
+		// since SQLite numbers $N parameters that way.
+		// The key-range placeholders follow the caller's.
+		chunkP = fmt.Sprintf("$%d", len(args)+1)
+
+		stmtWhere = shiftPlaceholders(where, len(stmtArgs))
+		stmtP1    = fmt.Sprintf("$%d", len(stmtArgs)+len(args)+1)
+		stmtP2    = fmt.Sprintf("$%d", len(stmtArgs)+len(args)+2)
+	)
+
+	const chunkQFmt = `SELECT MAX(%[2]s) FROM (SELECT %[2]s FROM %[1]s WHERE %[3]s ORDER BY %[2]s LIMIT %[4]d) sub`
+	var (
+		firstChunkQ = fmt.Sprintf(chunkQFmt, table, keyCol, "("+where+")", chunkSize)
+		nextChunkQ  = fmt.Sprintf(chunkQFmt, table, keyCol, fmt.Sprintf("(%s) AND %s > %s", where, keyCol, chunkP), chunkSize)
+		firstStmt   = stmt(fmt.Sprintf("(%s) AND %s <= %s", stmtWhere, keyCol, stmtP1))
+		nextStmt    = stmt(fmt.Sprintf("(%s) AND %s > %s AND %s <= %s", stmtWhere, keyCol, stmtP1, keyCol, stmtP2))
+	)
+
+	// withArgs returns args followed by extra,
+	// without modifying args.
+	withArgs := func(extra ...interface{}) []interface{} {
+		return append(args[:len(args):len(args)], extra...)
+	}
+
+	// withStmtArgs returns stmtArgs, args, and extra.
+	withStmtArgs := func(extra ...interface{}) []interface{} {
+		result := make([]interface{}, 0, len(stmtArgs)+len(args)+len(extra))
+		result = append(result, stmtArgs...)
+		result = append(result, args...)
+		return append(result, extra...)
+	}
+
+	var (
+		total int64
+		last  interface{}
+	)
+	for {
+		var (
+			end interface{}
+			err error
+		)
+		if last == nil {
+			err = db.QueryRowContext(ctx, firstChunkQ, args...).Scan(&end)
+		} else {
+			err = db.QueryRowContext(ctx, nextChunkQ, withArgs(last)...).Scan(&end)
+		}
+		if err != nil {
+			return total, fmt.Errorf("finding next chunk: %w", err)
+		}
+		if end == nil {
+			return total, nil
+		}
+
+		var res sql.Result
+		if last == nil {
+			res, err = db.ExecContext(ctx, firstStmt, withStmtArgs(end)...)
+		} else {
+			res, err = db.ExecContext(ctx, nextStmt, withStmtArgs(last, end)...)
+		}
+		if err != nil {
+			return total, fmt.Errorf("executing chunk: %w", err)
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("counting affected rows: %w", err)
+		}
+		total += aff
+		last = end
+
+		if delay > 0 {
+			if err := sleep(ctx, delay); err != nil {
+				return total, err
+			}
+		}
+	}
+}
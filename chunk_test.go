@@ -0,0 +1,105 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+// newChunkDB produces a database with a table of n items,
+// with ids 1 through n and odd = (id % 2).
+func newChunkDB(t *testing.T, n int) *sql.DB {
+	vals := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		vals = append(vals, fmt.Sprintf("(%d, %d, 0)", i, i%2))
+	}
+	return testdb.NewSQLite(t, testdb.DDL(
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, odd INTEGER NOT NULL, archived INTEGER NOT NULL)",
+		"INSERT INTO items (id, odd, archived) VALUES "+strings.Join(vals, ", "),
+	))
+}
+
+func TestDeleteWhereChunked(t *testing.T) {
+	db := newChunkDB(t, 25)
+	c := testdb.NewCaptureDB(db)
+
+	n, err := sqlutil.DeleteWhereChunked(context.Background(), c, "items", "odd = $1", []interface{}{1}, 5, &sqlutil.ChunkOptions{Delay: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 13 {
+		t.Errorf("deleted %d rows, want 13", n)
+	}
+	testdb.AssertRowCount(t, db, "items", "", 12)
+	testdb.AssertRowCount(t, db, "items", "odd = 1", 0)
+
+	var deletes int
+	for _, s := range c.Statements() {
+		if strings.HasPrefix(s.Query, "DELETE") {
+			deletes++
+		}
+	}
+	if deletes != 3 {
+		t.Errorf("got %d DELETE statements, want 3", deletes)
+	}
+}
+
+func TestUpdateWhereChunked(t *testing.T) {
+	db := newChunkDB(t, 25)
+
+	n, err := sqlutil.UpdateWhereChunked(context.Background(), db, "items", "archived = 1", nil, "odd = $1", []interface{}{0}, 4, &sqlutil.ChunkOptions{Delay: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 12 {
+		t.Errorf("updated %d rows, want 12", n)
+	}
+	testdb.AssertRowCount(t, db, "items", "archived = 1", 12)
+	testdb.AssertRowCount(t, db, "items", "archived = 1 AND odd = 1", 0)
+
+	// Nothing left to update.
+	n, err = sqlutil.UpdateWhereChunked(context.Background(), db, "items", "archived = 1", nil, "archived = 0 AND odd = 0", nil, 4, &sqlutil.ChunkOptions{Delay: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("updated %d rows, want 0", n)
+	}
+}
+
+func TestUpdateWhereChunkedSetArgs(t *testing.T) {
+	cases := []struct {
+		name, set, where string
+		setArgs, args    []interface{}
+	}{{
+		name:    "one each",
+		set:     "archived = $1",
+		setArgs: []interface{}{7},
+		where:   "odd = $1",
+		args:    []interface{}{1},
+	}, {
+		name:    "several",
+		set:     "archived = $1 + $2",
+		setArgs: []interface{}{3, 4},
+		where:   "odd = $1 AND id > $2 AND '$2' <> ''",
+		args:    []interface{}{1, 0},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newChunkDB(t, 25)
+			n, err := sqlutil.UpdateWhereChunked(context.Background(), db, "items", tc.set, tc.setArgs, tc.where, tc.args, 4, &sqlutil.ChunkOptions{Delay: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 13 {
+				t.Errorf("updated %d rows, want 13", n)
+			}
+			testdb.AssertRowCount(t, db, "items", "archived = 7 AND odd = 1", 13)
+		})
+	}
+}
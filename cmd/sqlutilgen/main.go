@@ -0,0 +1,336 @@
+// Command sqlutilgen generates type-specific scan and iterate functions for structs,
+// removing reflection from the hot path of queries that produce them.
+//
+// It is meant to be run with go generate.
+// Annotate each struct with a //sqlutil:gen comment
+// (or name it with -type),
+// and add to one of the package's files:
+//
+//	//go:generate go run github.com/bobg/sqlutil/cmd/sqlutilgen
+//
+// For each struct type T,
+// sqlutilgen writes these declarations to sqlutil_gen.go
+// (the names are unexported if T is):
+//
+//	// TColumns is the comma-separated list of T's columns, in scan order.
+//	const TColumns = "..."
+//
+//	// ScanT scans a row (e.g. a *sql.Row or *sql.Rows) of TColumns into a T.
+//	func ScanT(s interface{ Scan(...interface{}) error }) (T, error)
+//
+//	// ForTRows calls fn on each row produced by query,
+//	// which must select TColumns.
+//	func ForTRows(ctx context.Context, db sqlutil.QueryerContext, query string, fn func(T) error, args ...interface{}) error
+//
+// Fields map to columns according to their `sql` struct tags,
+// as documented in package sqlutil.
+// The fields of embedded structs are included if those structs are declared in the same package;
+// time.Time is treated as an ordinary field.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const directive = "//sqlutil:gen"
+
+func main() {
+	var (
+		typeNames = flag.String("type", "", "comma-separated list of struct type names (in addition to those annotated with "+directive+")")
+		output    = flag.String("output", "sqlutil_gen.go", "output file name")
+		dir       = flag.String("dir", ".", "package directory")
+	)
+	flag.Parse()
+
+	if err := run(*dir, *output, *typeNames); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(dir, output, typeNames string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != output
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("found %d packages in %s, want 1", len(pkgs), dir)
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	g := &generator{
+		structs: make(map[string]*ast.StructType),
+		want:    make(map[string]bool),
+	}
+	for _, name := range strings.Split(typeNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			g.want[name] = true
+		}
+	}
+
+	var fileNames []string
+	for name := range pkg.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		g.collect(pkg.Files[name])
+	}
+
+	var names []string
+	for name := range g.want {
+		if _, ok := g.structs[name]; !ok {
+			return fmt.Errorf("struct type %s not found", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no struct types annotated with %s or named with -type", directive)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&g.buf, "// Code generated by sqlutilgen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&g.buf, "package %s\n\n", pkg.Name)
+	fmt.Fprintf(&g.buf, "import (\n\t\"context\"\n\n\t\"github.com/bobg/sqlutil\"\n)\n")
+	for _, name := range names {
+		if err := g.generate(name); err != nil {
+			return err
+		}
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, output), src, 0644)
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	structs map[string]*ast.StructType
+	want    map[string]bool
+}
+
+// collect records the struct types declared in f,
+// and which ones are annotated.
+func (g *generator) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			g.structs[ts.Name.Name] = st
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			if hasDirective(doc) {
+				g.want[ts.Name.Name] = true
+			}
+		}
+	}
+}
+
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// column is a struct field mapped to a column.
+type column struct {
+	name string // column name
+	path string // field selector path, e.g. "Base.ID"
+}
+
+func (g *generator) columns(typeName string, st *ast.StructType, prefix string, seen map[string]bool) ([]column, error) {
+	if seen[typeName] {
+		return nil, fmt.Errorf("recursive embedding of %s", typeName)
+	}
+	seen[typeName] = true
+	defer delete(seen, typeName)
+
+	var result []column
+	for _, field := range st.Fields.List {
+		var tag string
+		hasTag := false
+		if field.Tag != nil {
+			raw, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("field tag in %s: %w", typeName, err)
+			}
+			tag, hasTag = reflect.StructTag(raw).Lookup("sql")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			// Embedded.
+			if ident, ok := field.Type.(*ast.Ident); ok && !hasTag {
+				if embedded, isLocal := g.structs[ident.Name]; isLocal {
+					sub, err := g.columns(ident.Name, embedded, prefix+ident.Name+".", seen)
+					if err != nil {
+						return nil, err
+					}
+					result = append(result, sub...)
+					continue
+				}
+			}
+			name := embeddedName(field.Type)
+			if name == "" {
+				return nil, fmt.Errorf("unsupported embedded field in %s", typeName)
+			}
+			if !ast.IsExported(name) {
+				continue
+			}
+			result = append(result, column{name: columnName(tag, name), path: prefix + name})
+			continue
+		}
+
+		for _, n := range field.Names {
+			if !n.IsExported() {
+				continue
+			}
+			result = append(result, column{name: columnName(tag, n.Name), path: prefix + n.Name})
+		}
+	}
+	return result, nil
+}
+
+// embeddedName returns the field name of an embedded field of type expr.
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
+func columnName(tag, fieldName string) string {
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return snakeCase(fieldName)
+}
+
+func (g *generator) generate(typeName string) error {
+	cols, err := g.columns(typeName, g.structs[typeName], "", make(map[string]bool))
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		return fmt.Errorf("struct type %s has no columns", typeName)
+	}
+
+	var (
+		names = make([]string, 0, len(cols))
+		ptrs  = make([]string, 0, len(cols))
+		seen  = make(map[string]bool, len(cols))
+	)
+	for _, c := range cols {
+		if seen[c.name] {
+			return fmt.Errorf("duplicate column %s in %s", c.name, typeName)
+		}
+		seen[c.name] = true
+		names = append(names, c.name)
+		ptrs = append(ptrs, "&v."+c.path)
+	}
+
+	var (
+		upper    = exportAs(true, typeName)
+		exported = ast.IsExported(typeName)
+		colsName = exportAs(exported, typeName+"Columns")
+		scanName = exportAs(exported, "Scan"+upper)
+		forName  = exportAs(exported, "For"+upper+"Rows")
+	)
+
+	fmt.Fprintf(&g.buf, "\n// %s is the comma-separated list of %s's columns, in scan order.\n", colsName, typeName)
+	fmt.Fprintf(&g.buf, "const %s = %q\n", colsName, strings.Join(names, ", "))
+
+	fmt.Fprintf(&g.buf, "\n// %s scans a row (e.g. a *sql.Row or *sql.Rows) of %s into a %s.\n", scanName, colsName, typeName)
+	fmt.Fprintf(&g.buf, "func %s(s interface{ Scan(...interface{}) error }) (%s, error) {\n", scanName, typeName)
+	fmt.Fprintf(&g.buf, "\tvar v %s\n", typeName)
+	fmt.Fprintf(&g.buf, "\terr := s.Scan(%s)\n", strings.Join(ptrs, ", "))
+	fmt.Fprintf(&g.buf, "\treturn v, err\n}\n")
+
+	fmt.Fprintf(&g.buf, "\n// %s calls fn on each row produced by query,\n// which must select %s.\n", forName, colsName)
+	fmt.Fprintf(&g.buf, "func %s(ctx context.Context, db sqlutil.QueryerContext, query string, fn func(%s) error, args ...interface{}) error {\n", forName, typeName)
+	fmt.Fprintf(&g.buf, "\trows, err := db.QueryContext(ctx, query, args...)\n")
+	fmt.Fprintf(&g.buf, "\tif err != nil {\n\t\treturn err\n\t}\n")
+	fmt.Fprintf(&g.buf, "\tdefer rows.Close()\n")
+	fmt.Fprintf(&g.buf, "\tfor rows.Next() {\n")
+	fmt.Fprintf(&g.buf, "\t\tv, err := %s(rows)\n", scanName)
+	fmt.Fprintf(&g.buf, "\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(&g.buf, "\t\tif err := fn(v); err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(&g.buf, "\t}\n")
+	fmt.Fprintf(&g.buf, "\treturn rows.Err()\n}\n")
+
+	return nil
+}
+
+// exportAs returns name with its first letter capitalized if exported is true,
+// and lowercased otherwise.
+func exportAs(exported bool, name string) string {
+	runes := []rune(name)
+	if exported {
+		runes[0] = unicode.ToUpper(runes[0])
+	} else {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	return string(runes)
+}
+
+// snakeCase converts a Go identifier like UserID to user_id.
+// It must agree with the function of the same name in package sqlutil.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,259 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ConnectorOptions configure the instrumentation added by WrapConnector.
+type ConnectorOptions struct {
+	// Tag, if true, applies TagQuery to each statement.
+	Tag bool
+
+	// Logger, if set, logs each statement,
+	// with its arguments
+	// (passed through Redactor, if set),
+	// duration,
+	// and error.
+	Logger   Logger
+	Redactor Redactor
+
+	// Slog, if set, receives structured log records of each statement
+	// (when Logger is not set),
+	// as described for LoggingDB.
+	Slog *slog.Logger
+
+	// Metrics, if set, receives an observation of each statement.
+	Metrics Metrics
+
+	// Observe, if set, is called after each statement,
+	// e.g. to record a tracing span.
+	// The op is one of "prepare", "query", or "exec".
+	Observe func(ctx context.Context, op, query string, args []interface{}, start time.Time, err error)
+}
+
+// WrapConnector wraps a driver.Connector so that the instrumentation in opts applies to every statement on its connections,
+// including those issued through a *sql.DB directly rather than through this package's helpers.
+// Use it with sql.OpenDB:
+//
+//	db := sql.OpenDB(sqlutil.WrapConnector(connector, &sqlutil.ConnectorOptions{Tag: true, Logger: logger}))
+//
+// Statements in transactions are instrumented too,
+// but beginning, committing, and rolling back a transaction are not observed.
+func WrapConnector(c driver.Connector, opts *ConnectorOptions) driver.Connector {
+	if opts == nil {
+		opts = &ConnectorOptions{}
+	}
+	return &wrappedConnector{Connector: c, opts: opts}
+}
+
+type wrappedConnector struct {
+	driver.Connector
+	opts *ConnectorOptions
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{Conn: conn, opts: c.opts}, nil
+}
+
+func (o *ConnectorOptions) rewrite(ctx context.Context, query string) string {
+	if o.Tag {
+		return TagQuery(ctx, query)
+	}
+	return query
+}
+
+func (o *ConnectorOptions) observe(ctx context.Context, op, query string, nargs []driver.NamedValue, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		// Not a real statement;
+		// database/sql retries it another way,
+		// which is observed instead.
+		return
+	}
+	if o.Logger == nil && o.Slog == nil && o.Metrics == nil && o.Observe == nil {
+		return
+	}
+	args := make([]interface{}, len(nargs))
+	for i, nv := range nargs {
+		args[i] = nv.Value
+	}
+	if o.Logger != nil || o.Slog != nil {
+		(&LoggingDB{Logger: o.Logger, Slog: o.Slog, Redactor: o.Redactor}).log(ctx, op, query, args, start, -1, err)
+	}
+	if o.Metrics != nil {
+		o.Metrics.ObserveQuery(op, QueryName(ctx), time.Since(start), err)
+	}
+	if o.Observe != nil {
+		o.Observe(ctx, op, query, args, start, err)
+	}
+}
+
+type wrappedConn struct {
+	driver.Conn
+	opts *ConnectorOptions
+}
+
+var (
+	_ driver.ConnPrepareContext = (*wrappedConn)(nil)
+	_ driver.ExecerContext      = (*wrappedConn)(nil)
+	_ driver.QueryerContext     = (*wrappedConn)(nil)
+	_ driver.ConnBeginTx        = (*wrappedConn)(nil)
+	_ driver.Pinger             = (*wrappedConn)(nil)
+	_ driver.SessionResetter    = (*wrappedConn)(nil)
+	_ driver.Validator          = (*wrappedConn)(nil)
+	_ driver.NamedValueChecker  = (*wrappedConn)(nil)
+)
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = c.opts.rewrite(ctx, query)
+	start := time.Now()
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	c.opts.observe(ctx, "prepare", query, nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedStmt{Stmt: stmt, query: query, opts: c.opts}, nil
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query = c.opts.rewrite(ctx, query)
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	c.opts.observe(ctx, "exec", query, args, start, err)
+	return res, err
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query = c.opts.rewrite(ctx, query)
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	c.opts.observe(ctx, "query", query, args, start, err)
+	return rows, err
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+
+	// As database/sql does for drivers without ConnBeginTx.
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type wrappedStmt struct {
+	driver.Stmt
+	query string
+	opts  *ConnectorOptions
+}
+
+var (
+	_ driver.StmtExecContext  = (*wrappedStmt)(nil)
+	_ driver.StmtQueryContext = (*wrappedStmt)(nil)
+)
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedValuesToValues(args))
+	}
+	s.opts.observe(ctx, "exec", s.query, args, start, err)
+	return res, err
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValuesToValues(args))
+	}
+	s.opts.observe(ctx, "query", s.query, args, start, err)
+	return rows, err
+}
+
+func (s *wrappedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(nargs []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(nargs))
+	for i, nv := range nargs {
+		vals[i] = nv.Value
+	}
+	return vals
+}
@@ -0,0 +1,49 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// minimalConn is a driver.Conn implementing none of the optional interfaces.
+type minimalConn struct{}
+
+func (minimalConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (minimalConn) Close() error                        { return nil }
+func (minimalConn) Begin() (driver.Tx, error)           { return minimalTx{}, nil }
+
+type minimalTx struct{}
+
+func (minimalTx) Commit() error   { return nil }
+func (minimalTx) Rollback() error { return nil }
+
+type minimalConnector struct{}
+
+func (minimalConnector) Connect(context.Context) (driver.Conn, error) { return minimalConn{}, nil }
+func (minimalConnector) Driver() driver.Driver                        { return nil }
+
+func TestWrapConnectorBeginTx(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(sqlutil.WrapConnector(minimalConnector{}, nil))
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []*sql.TxOptions{{ReadOnly: true}, {Isolation: sql.LevelSerializable}} {
+		if tx, err := db.BeginTx(ctx, opts); err == nil {
+			tx.Rollback()
+			t.Errorf("got no error beginning a transaction with options %+v on a driver without ConnBeginTx", opts)
+		}
+	}
+}
@@ -1,10 +1,20 @@
 package sqlutil
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 type ctxkeytype string
 
-var ctxkey = ctxkeytype("db")
+var (
+	ctxkey       = ctxkeytype("db")
+	lessorCtxkey = ctxkeytype("lessor")
+)
+
+// namedDBKey is the context key type for DBs stored with WithNamedDB.
+// It is distinct from ctxkeytype so that no name can collide with ctxkey.
+type namedDBKey string
 
 // WithDB creates a child of the given context object containing a DB.
 // The DB in the context can be retrieved with GetDB.
@@ -18,3 +28,72 @@ func WithDB(ctx context.Context, db DB) context.Context {
 func GetDB(ctx context.Context) DB {
 	return ctx.Value(ctxkey).(DB)
 }
+
+// WithNamedDB creates a child of the given context object containing a DB under the given name.
+// This allows a context to carry handles for more than one database.
+// The DB in the context can be retrieved with GetNamedDB.
+func WithNamedDB(ctx context.Context, name string, db DB) context.Context {
+	return context.WithValue(ctx, namedDBKey(name), db)
+}
+
+// GetNamedDB extracts the DB previously stored in ctx
+// (or some parent of ctx)
+// with WithNamedDB under the given name.
+func GetNamedDB(ctx context.Context, name string) DB {
+	return ctx.Value(namedDBKey(name)).(DB)
+}
+
+// WithLessor creates a child of the given context object containing a Lessor.
+// The Lessor in the context can be retrieved with GetLessor.
+func WithLessor(ctx context.Context, l *Lessor) context.Context {
+	return context.WithValue(ctx, lessorCtxkey, l)
+}
+
+// GetLessor extracts the Lessor previously stored in ctx
+// (or some parent of ctx)
+// with WithLessor.
+func GetLessor(ctx context.Context) *Lessor {
+	return ctx.Value(lessorCtxkey).(*Lessor)
+}
+
+var (
+	defaultDBMu sync.RWMutex
+	defaultDB   DB
+)
+
+// SetDefaultDB sets the process-wide default DB,
+// used by GetDBOrDefault and GetNamedDBOrDefault when the context carries no DB.
+// Passing nil clears the default.
+func SetDefaultDB(db DB) {
+	defaultDBMu.Lock()
+	defaultDB = db
+	defaultDBMu.Unlock()
+}
+
+// DefaultDB returns the DB set with SetDefaultDB,
+// or nil if there isn't one.
+func DefaultDB() DB {
+	defaultDBMu.RLock()
+	defer defaultDBMu.RUnlock()
+	return defaultDB
+}
+
+// GetDBOrDefault is like GetDB,
+// but if ctx carries no DB it returns the default DB set with SetDefaultDB
+// (which may be nil).
+func GetDBOrDefault(ctx context.Context) DB {
+	if db, ok := ctx.Value(ctxkey).(DB); ok {
+		return db
+	}
+	return DefaultDB()
+}
+
+// GetNamedDBOrDefault is like GetNamedDB,
+// but if ctx carries no DB with the given name it returns the default DB set with SetDefaultDB
+// (which may be nil).
+func GetNamedDBOrDefault(ctx context.Context, name string) DB {
+	if db, ok := ctx.Value(namedDBKey(name)).(DB); ok {
+		return db
+	}
+	return DefaultDB()
+}
@@ -0,0 +1,328 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Coordinator runs operations spanning more than one database,
+// where a true two-phase commit is not available.
+// A coordination is a sequence of steps,
+// each running in a transaction on its own database.
+// If a step fails,
+// the compensating actions of the steps before it run in reverse order,
+// undoing their effects.
+//
+// Each coordination's progress is recorded in a table,
+// so that coordinations interrupted by a crash can be completed
+// (or compensated)
+// by Resume.
+// The table must have these columns:
+//
+//	id          a string-compatible type, uniquely indexed
+//	kind        a string-compatible type
+//	payload     a []byte-compatible type (like BLOB or BYTEA)
+//	step        an integer: the number of steps completed
+//	state       a string-compatible type
+//	updated_at  a time.Time-compatible type (like DATETIME)
+//
+// Since a step's transaction commits separately from the recording of its progress,
+// a step may run again when its coordination is resumed.
+// Do and Compensate functions must therefore be idempotent,
+// except in steps whose DB is nil,
+// which run on the Coordinator's own database
+// in the same transaction that records their progress.
+type Coordinator struct {
+	db DB
+
+	// Table is the name of the db table holding coordination progress.
+	// The default if this is unspecified is "coordinations".
+	Table string
+
+	// Lessor, if set, is used to acquire a lease on each coordination while it runs,
+	// so that Resume in one process does not interfere with a coordination still running in another.
+	// Without a Lessor,
+	// Resume should be called only when no coordinations are running
+	// (e.g. at startup of the only process using the Coordinator).
+	Lessor *Lessor
+
+	// LeaseDuration is how long the lease on a coordination lasts.
+	// The default if this is unspecified is 10 minutes.
+	LeaseDuration time.Duration
+
+	kinds map[string][]CoordinationStep
+}
+
+// CoordinationStep is one step in a coordination.
+// Do and Compensate receive the coordination's payload.
+type CoordinationStep struct {
+	Name string
+
+	// DB is the database on which the step runs.
+	// If it is nil,
+	// the step runs on the Coordinator's database.
+	DB DB
+
+	Do func(ctx context.Context, tx *sql.Tx, payload []byte) error
+
+	// Compensate undoes Do.
+	// It is optional.
+	Compensate func(ctx context.Context, tx *sql.Tx, payload []byte) error
+}
+
+const (
+	defaultCoordinationsTable        = "coordinations"
+	defaultCoordinationLeaseDuration = 10 * time.Minute
+	coordinationLeasePrefix          = "sqlutil.coordination:"
+
+	// Coordination states.
+	coordRunning      = "running"
+	coordCompensating = "compensating"
+	coordDone         = "done"
+	coordCompensated  = "compensated"
+)
+
+// ErrCompensated is the error produced by Coordinator.Run when a step fails
+// and the steps before it have been compensated.
+// The error also wraps the failing step's error.
+var ErrCompensated = errors.New("coordination compensated")
+
+// NewCoordinator produces a new Coordinator
+// recording progress in db.
+func NewCoordinator(db DB) *Coordinator {
+	return &Coordinator{db: db}
+}
+
+func (c *Coordinator) tableName() string {
+	if c.Table == "" {
+		return defaultCoordinationsTable
+	}
+	return c.Table
+}
+
+func (c *Coordinator) leaseDuration() time.Duration {
+	if c.LeaseDuration <= 0 {
+		return defaultCoordinationLeaseDuration
+	}
+	return c.LeaseDuration
+}
+
+// Register defines a kind of coordination as a sequence of steps.
+// Every kind must be registered before Run or Resume uses it,
+// in every process that might resume it.
+func (c *Coordinator) Register(kind string, steps ...CoordinationStep) {
+	if c.kinds == nil {
+		c.kinds = make(map[string][]CoordinationStep)
+	}
+	c.kinds[kind] = steps
+}
+
+// Run runs a new coordination of the given kind,
+// identified by id
+// (which must be unique),
+// passing payload to each step.
+// If a step fails,
+// Run compensates the steps before it
+// and returns an error wrapping both ErrCompensated and the step's error.
+// If a compensation fails,
+// Run returns its error,
+// and the coordination can be completed later with Resume.
+func (c *Coordinator) Run(ctx context.Context, kind, id string, payload []byte) error {
+	if _, ok := c.kinds[kind]; !ok {
+		return fmt.Errorf("unknown coordination kind %s", kind)
+	}
+	ctx, unlock, err := c.lock(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	const insQFmt = `INSERT INTO %s (id, kind, payload, step, state, updated_at) VALUES ($1, $2, $3, 0, $4, $5)`
+	insQ := fmt.Sprintf(insQFmt, c.tableName())
+	if _, err = c.db.ExecContext(ctx, insQ, id, kind, payload, coordRunning, time.Now()); err != nil {
+		return fmt.Errorf("recording coordination %s: %w", id, err)
+	}
+	return c.advance(ctx, id, kind, payload, 0, coordRunning)
+}
+
+// Resume completes the coordinations that were interrupted,
+// running the remaining steps of those in progress
+// and the remaining compensations of those being compensated.
+// It returns the errors of all the coordinations it could not complete,
+// joined with errors.Join.
+// Coordinations whose leases are held
+// (when c has a Lessor)
+// are skipped.
+func (c *Coordinator) Resume(ctx context.Context) error {
+	type pending struct {
+		id, kind, state string
+		payload         []byte
+		step            int
+	}
+
+	const selQFmt = `SELECT id, kind, payload, step, state FROM %s WHERE state IN ($1, $2) ORDER BY updated_at`
+	selQ := fmt.Sprintf(selQFmt, c.tableName())
+	var todo []pending
+	err := ForQueryRows(ctx, c.db, selQ, coordRunning, coordCompensating, func(id, kind string, payload []byte, step int, state string) {
+		todo = append(todo, pending{id: id, kind: kind, state: state, payload: payload, step: step})
+	})
+	if err != nil {
+		return fmt.Errorf("querying interrupted coordinations: %w", err)
+	}
+
+	var errs []error
+	for _, p := range todo {
+		err := func() error {
+			ctx, unlock, err := c.lock(ctx, p.id)
+			if errors.Is(err, ErrLeaseHeld) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			// The coordination may have advanced,
+			// or even finished,
+			// before we acquired its lease.
+			step, state, err := c.progress(ctx, p.id)
+			if err != nil {
+				return err
+			}
+			if state != coordRunning && state != coordCompensating {
+				return nil
+			}
+			return c.advance(ctx, p.id, p.kind, p.payload, step, state)
+		}()
+		if err != nil && !errors.Is(err, ErrCompensated) {
+			errs = append(errs, fmt.Errorf("resuming coordination %s: %w", p.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lock acquires the lease on coordination id,
+// if c has a Lessor.
+func (c *Coordinator) lock(ctx context.Context, id string) (context.Context, func(), error) {
+	if c.Lessor == nil {
+		return ctx, func() {}, nil
+	}
+	lease, err := c.Lessor.Acquire(ctx, coordinationLeasePrefix+id, time.Now().Add(c.leaseDuration()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquiring coordination lease: %w", err)
+	}
+	leaseCtx, cancel := lease.Context(ctx)
+	return leaseCtx, func() {
+		cancel()
+		lease.Release(ctx)
+	}, nil
+}
+
+// progress returns the step number and state recorded for coordination id.
+func (c *Coordinator) progress(ctx context.Context, id string) (int, string, error) {
+	const selQFmt = `SELECT step, state FROM %s WHERE id = $1`
+	selQ := fmt.Sprintf(selQFmt, c.tableName())
+	var (
+		step  int
+		state string
+	)
+	err := c.db.QueryRowContext(ctx, selQ, id).Scan(&step, &state)
+	return step, state, wrapf(err, "querying coordination progress")
+}
+
+// advance runs coordination id onward from the given step and state.
+func (c *Coordinator) advance(ctx context.Context, id, kind string, payload []byte, step int, state string) error {
+	steps, ok := c.kinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown coordination kind %s", kind)
+	}
+
+	var stepErr error
+	if state == coordRunning {
+		for ; step < len(steps); step++ {
+			s := steps[step]
+			committed, err := c.runStep(ctx, id, s, s.Do, payload, step+1, coordRunning)
+			if committed && err != nil {
+				// The step succeeded but its progress was not recorded.
+				// Leave the coordination to be resumed.
+				return err
+			}
+			if err != nil {
+				stepErr = fmt.Errorf("step %s: %w", s.Name, err)
+				break
+			}
+		}
+		if stepErr == nil {
+			return c.setProgress(ctx, c.db, id, step, coordDone)
+		}
+		if err := c.setProgress(ctx, c.db, id, step, coordCompensating); err != nil {
+			return errors.Join(stepErr, err)
+		}
+	}
+
+	for ; step > 0; step-- {
+		s := steps[step-1]
+		if s.Compensate == nil {
+			if err := c.setProgress(ctx, c.db, id, step-1, coordCompensating); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := c.runStep(ctx, id, s, s.Compensate, payload, step-1, coordCompensating); err != nil {
+			return errors.Join(stepErr, fmt.Errorf("compensating step %s: %w", s.Name, err))
+		}
+	}
+	if err := c.setProgress(ctx, c.db, id, 0, coordCompensated); err != nil {
+		return errors.Join(stepErr, err)
+	}
+	if stepErr == nil {
+		// Compensation resumed after an earlier failure.
+		return ErrCompensated
+	}
+	return fmt.Errorf("%w: %w", ErrCompensated, stepErr)
+}
+
+// runStep runs fn in a transaction on s's database
+// and then records the new step number and state.
+// When s has no database of its own,
+// the progress is recorded in the same transaction.
+// The boolean result tells whether fn's transaction committed
+// (in which case any error is from recording the progress).
+func (c *Coordinator) runStep(ctx context.Context, id string, s CoordinationStep, fn func(context.Context, *sql.Tx, []byte) error, payload []byte, step int, state string) (bool, error) {
+	db := s.DB
+	if db == nil {
+		db = c.db
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(ctx, tx, payload); err != nil {
+		return false, err
+	}
+	if s.DB == nil {
+		if err = c.setProgress(ctx, tx, id, step, state); err != nil {
+			return false, err
+		}
+		if err = tx.Commit(); err != nil {
+			return false, fmt.Errorf("committing: %w", err)
+		}
+		return false, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("committing: %w", err)
+	}
+	return true, c.setProgress(ctx, c.db, id, step, state)
+}
+
+func (c *Coordinator) setProgress(ctx context.Context, db ExecerContext, id string, step int, state string) error {
+	const updQFmt = `UPDATE %s SET step = $1, state = $2, updated_at = $3 WHERE id = $4`
+	updQ := fmt.Sprintf(updQFmt, c.tableName())
+	_, err := db.ExecContext(ctx, updQ, step, state, time.Now(), id)
+	return wrapf(err, "recording coordination progress")
+}
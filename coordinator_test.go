@@ -0,0 +1,116 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func newCoordinator(t *testing.T) (*sqlutil.Coordinator, *sql.DB) {
+	db := testdb.NewSQLite(t,
+		testdb.DDL(
+			"CREATE TABLE coordinations (id TEXT PRIMARY KEY, kind TEXT NOT NULL, payload BLOB, step INTEGER NOT NULL, state TEXT NOT NULL, updated_at DATETIME NOT NULL)",
+			"CREATE TABLE log (step TEXT NOT NULL)",
+		),
+		testdb.LessorTable(sqlutil.NewLessor(nil)),
+	)
+	return sqlutil.NewCoordinator(db), db
+}
+
+// logStep produces a step function that records name in the log table.
+func logStep(name string, err error) func(context.Context, *sql.Tx, []byte) error {
+	return func(ctx context.Context, tx *sql.Tx, _ []byte) error {
+		if err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO log (step) VALUES ($1)", name)
+		return err
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	ctx := context.Background()
+	c, db := newCoordinator(t)
+
+	errFail := errors.New("fail")
+	c.Register("ok",
+		sqlutil.CoordinationStep{Name: "a", Do: logStep("a", nil)},
+		sqlutil.CoordinationStep{Name: "b", Do: logStep("b", nil)},
+	)
+	c.Register("bad",
+		sqlutil.CoordinationStep{Name: "a", Do: logStep("a", nil), Compensate: logStep("undo a", nil)},
+		sqlutil.CoordinationStep{Name: "b", Do: logStep("b", errFail)},
+	)
+
+	if err := c.Run(ctx, "ok", "1", nil); err != nil {
+		t.Fatal(err)
+	}
+	testdb.AssertExists(t, db, "coordinations", "id = '1' AND state = 'done' AND step = 2")
+
+	err := c.Run(ctx, "bad", "2", nil)
+	if !errors.Is(err, sqlutil.ErrCompensated) || !errors.Is(err, errFail) {
+		t.Errorf("got error %v, want one wrapping %v and %v", err, sqlutil.ErrCompensated, errFail)
+	}
+	testdb.AssertExists(t, db, "coordinations", "id = '2' AND state = 'compensated' AND step = 0")
+	testdb.AssertExists(t, db, "log", "step = 'undo a'")
+}
+
+func TestCoordinatorResume(t *testing.T) {
+	ctx := context.Background()
+	c, db := newCoordinator(t)
+	c.Register("ok",
+		sqlutil.CoordinationStep{Name: "a", Do: logStep("a", nil)},
+		sqlutil.CoordinationStep{Name: "b", Do: logStep("b", nil)},
+	)
+
+	const insQ = "INSERT INTO coordinations (id, kind, payload, step, state, updated_at) VALUES ($1, 'ok', NULL, 1, 'running', CURRENT_TIMESTAMP)"
+	if _, err := db.Exec(insQ, "interrupted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	testdb.AssertExists(t, db, "coordinations", "id = 'interrupted' AND state = 'done' AND step = 2")
+	testdb.AssertRowCount(t, db, "log", "", 1)
+}
+
+// finishingDB is a DB that marks coordination "racing" done
+// just before its first ExecContext,
+// as if another process finished it while Resume acquired its lease.
+type finishingDB struct {
+	sqlutil.DB
+	done bool
+}
+
+func (f *finishingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if !f.done {
+		f.done = true
+		if _, err := f.DB.ExecContext(ctx, "UPDATE coordinations SET step = 2, state = 'done' WHERE id = 'racing'"); err != nil {
+			return nil, err
+		}
+	}
+	return f.DB.ExecContext(ctx, query, args...)
+}
+
+func TestCoordinatorResumeFinished(t *testing.T) {
+	ctx := context.Background()
+	c, db := newCoordinator(t)
+	c.Lessor = sqlutil.NewLessor(&finishingDB{DB: db})
+	c.Register("ok",
+		sqlutil.CoordinationStep{Name: "a", Do: logStep("a", nil)},
+		sqlutil.CoordinationStep{Name: "b", Do: logStep("b", nil)},
+	)
+
+	const insQ = "INSERT INTO coordinations (id, kind, payload, step, state, updated_at) VALUES ($1, 'ok', NULL, 1, 'running', CURRENT_TIMESTAMP)"
+	if _, err := db.Exec(insQ, "racing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	testdb.AssertRowCount(t, db, "log", "", 0)
+}
@@ -0,0 +1,154 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Counter provides named counters stored in a database table,
+// which can be shared among many processes.
+// Updates use an INSERT ... ON CONFLICT ... RETURNING upsert,
+// as supported by Postgres and SQLite.
+//
+// The counters table must have these columns:
+//
+//	name   a string-compatible type, uniquely indexed
+//	value  a 64-bit integer type (like BIGINT)
+type Counter struct {
+	db DB
+
+	// Table is the name of the db table holding counters.
+	// The default if this is unspecified is "counters".
+	Table string
+}
+
+const defaultCounterTable = "counters"
+
+// NewCounter produces a new Counter.
+func NewCounter(db DB) *Counter {
+	return &Counter{db: db}
+}
+
+func (c *Counter) tableName() string {
+	if c.Table == "" {
+		return defaultCounterTable
+	}
+	return c.Table
+}
+
+// Incr adds 1 to the named counter and returns its new value.
+func (c *Counter) Incr(ctx context.Context, name string) (int64, error) {
+	return c.Add(ctx, name, 1)
+}
+
+// Add adds delta to the named counter and returns its new value.
+// A counter that does not yet exist starts at 0.
+func (c *Counter) Add(ctx context.Context, name string, delta int64) (int64, error) {
+	const upsQFmt = `INSERT INTO %[1]s (name, value) VALUES ($1, $2)` +
+		` ON CONFLICT (name) DO UPDATE SET value = %[1]s.value + EXCLUDED.value` +
+		` RETURNING value`
+	upsQ := fmt.Sprintf(upsQFmt, c.tableName())
+	var val int64
+	err := c.db.QueryRowContext(ctx, upsQ, name, delta).Scan(&val)
+	return val, wrapf(err, "upserting counter")
+}
+
+// Get returns the value of the named counter.
+// A counter that does not exist has value 0.
+func (c *Counter) Get(ctx context.Context, name string) (int64, error) {
+	const selQFmt = `SELECT value FROM %s WHERE name = $1`
+	selQ := fmt.Sprintf(selQFmt, c.tableName())
+	var val int64
+	err := c.db.QueryRowContext(ctx, selQ, name).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return val, wrapf(err, "querying counter")
+}
+
+// Reset sets the named counter to 0.
+func (c *Counter) Reset(ctx context.Context, name string) error {
+	const delQFmt = `DELETE FROM %s WHERE name = $1`
+	delQ := fmt.Sprintf(delQFmt, c.tableName())
+	_, err := c.db.ExecContext(ctx, delQ, name)
+	return wrapf(err, "deleting from database")
+}
+
+// CounterBatcher accumulates increments to a Counter in memory
+// and applies them to the database in batches,
+// for high-frequency increments where the counter's current value is not needed immediately.
+// It is safe for concurrent use.
+type CounterBatcher struct {
+	c *Counter
+
+	mu      sync.Mutex
+	pending map[string]int64
+}
+
+// Batcher produces a new CounterBatcher for c.
+func (c *Counter) Batcher() *CounterBatcher {
+	return &CounterBatcher{c: c, pending: make(map[string]int64)}
+}
+
+// Add adds delta to the named counter in memory.
+// The change reaches the database at the next Flush.
+func (b *CounterBatcher) Add(name string, delta int64) {
+	b.mu.Lock()
+	b.pending[name] += delta
+	b.mu.Unlock()
+}
+
+// Flush applies the accumulated increments to the database.
+// Increments that could not be applied are retained for the next Flush.
+func (b *CounterBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string]int64)
+	b.mu.Unlock()
+
+	for name, delta := range pending {
+		if delta == 0 {
+			delete(pending, name)
+			continue
+		}
+		if _, err := b.c.Add(ctx, name, delta); err != nil {
+			b.mu.Lock()
+			for name, delta := range pending {
+				b.pending[name] += delta
+			}
+			b.mu.Unlock()
+			return wrapf(err, "flushing counter %s", name)
+		}
+		delete(pending, name)
+	}
+	return nil
+}
+
+// Run calls Flush every interval until ctx is canceled,
+// then flushes a final time
+// (using a context that is not canceled)
+// and returns.
+// Errors from Flush are passed to onErr,
+// which may be nil.
+func (b *CounterBatcher) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.Flush(context.Background()); err != nil && onErr != nil {
+				onErr(err)
+			}
+			return
+		case <-ticker.C:
+			if err := b.Flush(ctx); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package sqlutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the times at which a scheduled job runs.
+type Schedule interface {
+	// Next returns the first run time strictly after t.
+	// If there is none, it returns the zero time.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a schedule specification.
+// It may be an interval of the form "@every <duration>",
+// where <duration> is understood by time.ParseDuration;
+// one of the shorthands "@hourly", "@daily", "@weekly", "@monthly", and "@yearly";
+// or a standard five-field cron expression
+// (minute, hour, day of month, month, day of week),
+// where each field is "*" or a comma-separated list of numbers and ranges,
+// each optionally followed by a /step.
+// Cron expressions are evaluated in the location of the time passed to Next.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("parsing interval: %s", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("interval must be positive")
+		}
+		return Interval(d), nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@yearly":
+		spec = "0 0 1 1 *"
+	}
+	return parseCron(spec)
+}
+
+// Interval is a Schedule that runs at a fixed interval.
+type Interval time.Duration
+
+// Next implements Schedule.
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bitsets
+
+	// If both dom and dow are restricted,
+	// a day matches if either one does
+	// (as in traditional cron).
+	domStar, dowStar bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression must have %d fields, got %d", len(cronFields), len(fields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s field: %s", cronFields[i].name, err)
+		}
+		bits[i] = b
+	}
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(f string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.IndexByte(part, '-'); i >= 0 {
+				var err error
+				if lo, err = strconv.Atoi(part[:i]); err != nil {
+					return 0, fmt.Errorf("bad range start in %q", part)
+				}
+				if hi, err = strconv.Atoi(part[i+1:]); err != nil {
+					return 0, fmt.Errorf("bad range end in %q", part)
+				}
+			} else {
+				n, err := strconv.Atoi(part)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+				lo, hi = n, n
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// cronHorizon is how far ahead Next searches before concluding that a cron expression never matches
+// (e.g. "0 0 30 2 *").
+const cronHorizon = 5 * 366 * 24 * time.Hour
+
+// Next implements Schedule.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(cronHorizon)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
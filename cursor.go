@@ -0,0 +1,187 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// DefaultFetchSize is the number of rows ForQueryRowsCursor fetches at a time
+// when it is given a fetch size of zero or less.
+const DefaultFetchSize = 1000
+
+var cursorCounter int64
+
+// ForQueryRowsCursor is like ForQueryRows,
+// but it runs query through a Postgres server-side cursor,
+// fetching fetchSize rows at a time,
+// so that neither the client nor the driver holds more than that many rows in memory.
+// This suits scans of millions of rows.
+//
+// The cursor lives in a transaction that ForQueryRowsCursor begins on db
+// and commits when the rows are exhausted
+// (or rolls back on error).
+// The callback therefore should not write through db expecting to see its changes in later rows.
+func ForQueryRowsCursor(ctx context.Context, db DB, fetchSize int, query string, args ...interface{}) error {
+	if len(args) == 0 {
+		return fmt.Errorf("too few arguments")
+	}
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+
+	var (
+		queryArgs = args[:len(args)-1]
+		fnArg     = args[len(args)-1]
+		fnVal     = reflect.ValueOf(fnArg)
+		n         int
+	)
+	if fnVal.Kind() != reflect.Func {
+		return fmt.Errorf("fn arg not a function")
+	}
+
+	// Wrap the callback to count the rows in each FETCH.
+	counter := reflect.MakeFunc(fnVal.Type(), func(in []reflect.Value) []reflect.Value {
+		n++
+		return fnVal.Call(in)
+	}).Interface()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	name := fmt.Sprintf("sqlutil_cursor_%d", atomic.AddInt64(&cursorCounter, 1))
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", name, query), queryArgs...); err != nil {
+		return fmt.Errorf("declaring cursor: %w", err)
+	}
+
+	fetchQ := fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, name)
+	for {
+		n = 0
+		if err := ForQueryRows(ctx, tx, fetchQ, counter); err != nil {
+			return err
+		}
+		if n < fetchSize {
+			break
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "CLOSE "+name); err != nil {
+		return fmt.Errorf("closing cursor: %w", err)
+	}
+	return wrapf(tx.Commit(), "committing transaction")
+}
+
+// QueryAllCursor is like QueryAll but uses ForQueryRowsCursor,
+// bounding the memory used by the driver
+// (though not by the result slice).
+func QueryAllCursor[T any](ctx context.Context, db DB, fetchSize int, query string, args ...interface{}) ([]T, error) {
+	var result []T
+	err := ForQueryRowsCursor(ctx, db, fetchSize, query, append(args, func(v T) {
+		result = append(result, v)
+	})...)
+	return result, err
+}
+
+// Cursor is a pull-style iterator over the rows of a query result,
+// each scanned into a value of type T
+// (by column name if T is a struct type,
+// as in ForQueryRows,
+// and otherwise as the row's single column).
+// It suits consumers that need to control the pace of consumption,
+// like merges of several sorted results.
+// (Despite its name it uses an ordinary query,
+// not a server-side cursor like ForQueryRowsCursor;
+// the driver determines how many rows are buffered.)
+//
+// Use it like this:
+//
+//	c, err := QueryCursor[T](ctx, db, query, args...)
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	for c.Next() {
+//		v := c.Value()
+//		...
+//	}
+//	return c.Err()
+//
+// A Cursor holds a database connection until it is exhausted or closed.
+type Cursor[T any] struct {
+	rows *sql.Rows
+	ss   *structScanner
+	val  T
+	err  error
+}
+
+// QueryCursor runs query and returns a Cursor over its result.
+func QueryCursor[T any](ctx context.Context, db QueryerContext, query string, args ...interface{}) (*Cursor[T], error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cursor[T]{rows: rows}
+	if t := reflect.TypeOf((*T)(nil)).Elem(); isScanStruct(t) {
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if c.ss, err = newStructScanner(t, cols, structScanOptions(ctx)); err != nil {
+			rows.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Next advances c to the next row,
+// which is then available from Value.
+// It returns false when there are no more rows or an error occurs
+// (see Err),
+// and closes c.
+func (c *Cursor[T]) Next() bool {
+	if c.err != nil || !c.rows.Next() {
+		c.Close()
+		return false
+	}
+	var v T
+	if c.ss != nil {
+		dests := c.ss.dests(reflect.ValueOf(&v).Elem())
+		if c.err = c.rows.Scan(dests...); c.err == nil {
+			c.ss.finish(reflect.ValueOf(&v).Elem(), dests)
+		}
+	} else {
+		c.err = c.rows.Scan(&v)
+	}
+	if c.err != nil {
+		c.Close()
+		return false
+	}
+	c.val = v
+	return true
+}
+
+// Value returns the row scanned by the latest call to Next.
+func (c *Cursor[T]) Value() T {
+	return c.val
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (c *Cursor[T]) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+// Close releases c's connection.
+// It is safe to call more than once.
+func (c *Cursor[T]) Close() error {
+	return c.rows.Close()
+}
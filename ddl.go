@@ -0,0 +1,220 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CreateTableOptions are options for CreateTable and TableSQL.
+// A nil *CreateTableOptions is equivalent to a zero-valued one.
+type CreateTableOptions struct {
+	// Dialect selects the flavor of SQL to produce.
+	Dialect Dialect
+
+	// IfNotExists adds IF NOT EXISTS to the generated statements,
+	// where the dialect supports it.
+	IfNotExists bool
+}
+
+// CreateTable creates a table whose columns correspond to the fields of the struct that v points to
+// (or the struct v itself).
+// See TableSQL.
+func CreateTable(ctx context.Context, db ExecerContext, table string, v interface{}, opts *CreateTableOptions) error {
+	stmts, err := TableSQL(table, v, opts)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("executing %s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// TableSQL returns the DDL statements for creating a table whose columns correspond to the fields of the struct that v points to
+// (or the struct v itself).
+// The first statement is a CREATE TABLE;
+// any others create indexes.
+//
+// Fields map to columns as described by their `sql` struct tags
+// (see the package documentation).
+// Columns are NOT NULL unless the field has a pointer or sql.Null* type or the null option.
+// Column types are chosen from the field's Go type according to the dialect in opts,
+// unless overridden with the type= option.
+func TableSQL(table string, v interface{}, opts *CreateTableOptions) ([]string, error) {
+	if opts == nil {
+		opts = &CreateTableOptions{}
+	}
+	d := opts.Dialect
+
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil, fmt.Errorf("nil value")
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s has no columns", t)
+	}
+
+	var pks []string
+	for _, f := range fields {
+		if f.pk {
+			pks = append(pks, d.QuoteIdent(f.column))
+		}
+	}
+
+	var (
+		defs    []string
+		inline  []string // MySQL index definitions
+		indexes []string
+		qtable  = d.QuoteIdent(table)
+	)
+	for _, f := range fields {
+		def, err := columnDef(d, f, len(pks) == 1)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		defs = append(defs, def)
+
+		if !f.indexed && !f.unique {
+			continue
+		}
+		idxName := d.QuoteIdent(table + "_" + f.column + "_idx")
+		col := d.QuoteIdent(f.column)
+		var unique string
+		if f.unique {
+			unique = "UNIQUE "
+		}
+		if d == MySQL {
+			// MySQL does not support CREATE INDEX IF NOT EXISTS,
+			// so declare indexes inline.
+			inline = append(inline, fmt.Sprintf("%sINDEX %s (%s)", unique, idxName, col))
+			continue
+		}
+		var ifNotExists string
+		if opts.IfNotExists {
+			ifNotExists = "IF NOT EXISTS "
+		}
+		indexes = append(indexes, fmt.Sprintf("CREATE %sINDEX %s%s ON %s (%s)", unique, ifNotExists, idxName, qtable, col))
+	}
+
+	// SQLite autoincrement columns must be declared INTEGER PRIMARY KEY inline
+	// (handled in columnDef).
+	if len(pks) > 0 && !(d == SQLite && len(pks) == 1 && hasAutoincr(fields)) {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pks, ", ")))
+	}
+	defs = append(defs, inline...)
+
+	var ifNotExists string
+	if opts.IfNotExists {
+		ifNotExists = "IF NOT EXISTS "
+	}
+	create := fmt.Sprintf("CREATE TABLE %s%s (\n  %s\n)", ifNotExists, qtable, strings.Join(defs, ",\n  "))
+	return append([]string{create}, indexes...), nil
+}
+
+func hasAutoincr(fields []structField) bool {
+	for _, f := range fields {
+		if f.pk && f.autoincr {
+			return true
+		}
+	}
+	return false
+}
+
+func columnDef(d Dialect, f structField, singlePK bool) (string, error) {
+	typ, nullable := f.typ, f.nullable
+	if typ.Kind() == reflect.Ptr {
+		typ, nullable = typ.Elem(), true
+	}
+	if base, ok := nullTypes[typ]; ok {
+		typ, nullable = base, true
+	}
+
+	dbType := f.dbType
+	if dbType == "" {
+		var err error
+		dbType, err = columnType(d, typ)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	col := d.QuoteIdent(f.column)
+
+	if f.autoincr {
+		switch d {
+		case Postgres:
+			return fmt.Sprintf("%s %s GENERATED BY DEFAULT AS IDENTITY", col, dbType), nil
+		case MySQL:
+			return fmt.Sprintf("%s %s NOT NULL AUTO_INCREMENT", col, dbType), nil
+		case SQLite:
+			if !f.pk || !singlePK {
+				return "", fmt.Errorf("in SQLite, autoincr requires a single-column primary key")
+			}
+			return col + " INTEGER PRIMARY KEY AUTOINCREMENT", nil
+		}
+	}
+
+	if nullable && !f.pk {
+		return col + " " + dbType, nil
+	}
+	return col + " " + dbType + " NOT NULL", nil
+}
+
+var nullTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    timeType,
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// columnType returns the default column type in dialect d for Go type t.
+func columnType(d Dialect, t reflect.Type) (string, error) {
+	// Indexed by Dialect: Postgres, MySQL, SQLite.
+	var types [3]string
+
+	switch {
+	case t == timeType:
+		types = [3]string{"TIMESTAMP WITH TIME ZONE", "DATETIME(6)", "DATETIME"}
+	case t == bytesType:
+		types = [3]string{"BYTEA", "BLOB", "BLOB"}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			types = [3]string{"BOOLEAN", "BOOLEAN", "INTEGER"}
+		case reflect.Int8, reflect.Int16, reflect.Uint8:
+			types = [3]string{"SMALLINT", "SMALLINT", "INTEGER"}
+		case reflect.Int32, reflect.Uint16:
+			types = [3]string{"INTEGER", "INT", "INTEGER"}
+		case reflect.Int, reflect.Int64, reflect.Uint32:
+			types = [3]string{"BIGINT", "BIGINT", "INTEGER"}
+		case reflect.Float32:
+			types = [3]string{"REAL", "FLOAT", "REAL"}
+		case reflect.Float64:
+			types = [3]string{"DOUBLE PRECISION", "DOUBLE", "REAL"}
+		case reflect.String:
+			types = [3]string{"TEXT", "VARCHAR(255)", "TEXT"}
+		default:
+			return "", fmt.Errorf("no default column type for %s; use the type= tag option", t)
+		}
+	}
+	if d < 0 || int(d) >= len(types) {
+		return "", fmt.Errorf("unknown dialect %d", d)
+	}
+	return types[d], nil
+}
@@ -0,0 +1,135 @@
+package sqlutil
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DebugState is a snapshot of this package's internal state in the current process,
+// for quick debugging in production.
+// See DebugSnapshot.
+//
+// It has no statement-cache hit rates,
+// since this package does not cache prepared statements;
+// database/sql's own per-connection statement handling is not observable.
+type DebugState struct {
+	// Leases are the leases currently held by this process
+	// (acquired and neither released, lost on renewal, nor expired),
+	// sorted by table and name.
+	Leases []DebugLease `json:"leases"`
+
+	// QueueDepths maps each queue table to the number of ready jobs
+	// most recently observed by Queue.Depth.
+	QueueDepths map[string]int64 `json:"queue_depths"`
+
+	// Dequeues is the number of jobs claimed by Queue.Dequeue,
+	// and DequeueMisses the number of calls that found no job ready.
+	Dequeues      int64 `json:"dequeues"`
+	DequeueMisses int64 `json:"dequeue_misses"`
+
+	// Retries is the number of attempts retried by Retry and WithTxRetry,
+	// and RetryGiveUps the number of calls that failed after retrying.
+	Retries      int64 `json:"retries"`
+	RetryGiveUps int64 `json:"retry_give_ups"`
+}
+
+// DebugLease describes a lease in DebugState.
+type DebugLease struct {
+	Table string    `json:"table"`
+	Name  string    `json:"name"`
+	Exp   time.Time `json:"exp"`
+}
+
+type debugLeaseKey struct {
+	table, name string
+}
+
+var debugState struct {
+	mu          sync.Mutex
+	leases      map[debugLeaseKey]time.Time
+	queueDepths map[string]int64
+
+	dequeues, dequeueMisses atomic.Int64
+	retries, retryGiveUps   atomic.Int64
+}
+
+func debugLeaseHeld(l *Lease, exp time.Time) {
+	debugState.mu.Lock()
+	defer debugState.mu.Unlock()
+	if debugState.leases == nil {
+		debugState.leases = make(map[debugLeaseKey]time.Time)
+	}
+	debugState.leases[debugLeaseKey{l.Lessor.tableName(), l.Name}] = exp
+}
+
+func debugLeaseGone(l *Lease) {
+	debugState.mu.Lock()
+	defer debugState.mu.Unlock()
+	delete(debugState.leases, debugLeaseKey{l.Lessor.tableName(), l.Name})
+}
+
+func debugQueueDepth(table string, n int64) {
+	debugState.mu.Lock()
+	defer debugState.mu.Unlock()
+	if debugState.queueDepths == nil {
+		debugState.queueDepths = make(map[string]int64)
+	}
+	debugState.queueDepths[table] = n
+}
+
+// DebugSnapshot returns a snapshot of this package's internal state.
+func DebugSnapshot() DebugState {
+	s := DebugState{
+		QueueDepths:   make(map[string]int64),
+		Dequeues:      debugState.dequeues.Load(),
+		DequeueMisses: debugState.dequeueMisses.Load(),
+		Retries:       debugState.retries.Load(),
+		RetryGiveUps:  debugState.retryGiveUps.Load(),
+	}
+
+	debugState.mu.Lock()
+	defer debugState.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range debugState.leases {
+		if exp.Before(now) {
+			delete(debugState.leases, k)
+			continue
+		}
+		s.Leases = append(s.Leases, DebugLease{Table: k.table, Name: k.name, Exp: exp})
+	}
+	sort.Slice(s.Leases, func(i, j int) bool {
+		if s.Leases[i].Table != s.Leases[j].Table {
+			return s.Leases[i].Table < s.Leases[j].Table
+		}
+		return s.Leases[i].Name < s.Leases[j].Name
+	})
+	for table, n := range debugState.queueDepths {
+		s.QueueDepths[table] = n
+	}
+	return s
+}
+
+// DebugVar returns an expvar.Var whose value is the current DebugSnapshot.
+// Publish it with expvar.Publish
+// to include it in the output of the expvar package's /debug/vars handler:
+//
+//	expvar.Publish("sqlutil", sqlutil.DebugVar())
+func DebugVar() expvar.Var {
+	return expvar.Func(func() any { return DebugSnapshot() })
+}
+
+// DebugHandler returns an http.Handler serving the current DebugSnapshot as JSON.
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(DebugSnapshot())
+	})
+}
@@ -0,0 +1,91 @@
+package sqlutil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies a flavor of SQL.
+// The zero value is Postgres,
+// whose $1, $2, ... placeholder syntax is used throughout this package.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	MySQL
+	SQLite
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	case SQLite:
+		return "sqlite"
+	}
+	return "unknown"
+}
+
+// QuoteIdent quotes an identifier such as a table or column name.
+func (d Dialect) QuoteIdent(s string) string {
+	if d == MySQL {
+		return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// MaxParams returns the maximum number of placeholders d allows in a single statement:
+// 65535 for Postgres and MySQL,
+// and 999 for SQLite
+// (the default limit before SQLite 3.32.0;
+// later versions allow 32766).
+func (d Dialect) MaxParams() int {
+	if d == SQLite {
+		return 999
+	}
+	return 65535
+}
+
+// Placeholder returns the query placeholder for the nth (1-based) argument.
+func (d Dialect) Placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// shiftPlaceholders renumbers the $N placeholders in query to $(N+by),
+// leaving quoted strings and identifiers alone.
+func shiftPlaceholders(query string, by int) string {
+	if by == 0 {
+		return query
+	}
+	var (
+		b     strings.Builder
+		quote byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			b.WriteString("$" + strconv.Itoa(n+by))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
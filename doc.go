@@ -1,2 +1,38 @@
 // Package sqlutil provides miscellaneous useful utilities for use with the database/sql package.
+//
+// # Struct tags
+//
+// Functions in this package that map Go structs to database rows
+// (such as CreateTable, InsertStruct, and ForQueryRows with a struct-typed callback)
+// are controlled by `sql` struct tags of the form
+//
+//	`sql:"name,option,option,..."`
+//
+// where name is the column name
+// (defaulting to the snake_case form of the field name, e.g. user_id for UserID)
+// and the options are any of:
+//
+//	pk         the column is (part of) the primary key
+//	autoincr   the column's value is assigned by the database
+//	index      the column is indexed
+//	unique     the column is uniquely indexed
+//	null       the column is nullable (implied for pointer and sql.Null* types)
+//	type=T     the column has database type T, overriding the default for the field's Go type
+//	leftover   the field is not a column, but a map[string]interface{} collecting unmatched result columns (see ScanCollect)
+//
+// A tag of "-" excludes the field.
+// Unexported fields are excluded.
+// The fields of embedded structs
+// (other than time.Time)
+// are treated as fields of the outer struct.
+//
+// # pgx
+//
+// The interfaces in this package
+// (QueryerContext, ExecerContext, DB, and so on)
+// traffic in database/sql types such as *sql.Rows and *sql.Tx,
+// which a pgxpool.Pool cannot produce natively.
+// The separate module github.com/bobg/sqlutil/sqlutilpgx adapts a pool to them,
+// using pgx's native protocol for statements and for bulk loads
+// (via CopyFromer).
 package sqlutil
@@ -0,0 +1,196 @@
+package sqlutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Keyring holds the keys used by Encrypted.
+// Values are encrypted with the current key,
+// and decrypted with whichever key encrypted them,
+// as identified by the key ID recorded in the ciphertext.
+// To rotate keys,
+// add a new key and make it current,
+// keeping the old keys until all values encrypted with them have been rewritten.
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring produces a Keyring from a map of key IDs to AES keys
+// (each 16, 24, or 32 bytes long),
+// with the key identified by current used for encryption.
+// Key IDs must be no longer than 255 bytes.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q not in keys", current)
+	}
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("key ID %q too long", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aeads[id] = aead
+	}
+	return &Keyring{current: current, aeads: aeads}, nil
+}
+
+// Ciphertext envelope format:
+//
+//	version byte (1)
+//	key ID length byte
+//	key ID
+//	nonce
+//	sealed data
+const envelopeVersion = 1
+
+func (k *Keyring) encrypt(plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("computing nonce: %w", err)
+	}
+	out := make([]byte, 0, 2+len(k.current)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, envelopeVersion, byte(len(k.current)))
+	out = append(out, k.current...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+func (k *Keyring) decrypt(envelope []byte) (plaintext []byte, keyID string, err error) {
+	if len(envelope) < 2 || envelope[0] != envelopeVersion {
+		return nil, "", fmt.Errorf("unknown ciphertext format")
+	}
+	n := int(envelope[1])
+	if len(envelope) < 2+n {
+		return nil, "", fmt.Errorf("truncated ciphertext")
+	}
+	keyID = string(envelope[2 : 2+n])
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown key %q", keyID)
+	}
+	rest := envelope[2+n:]
+	if len(rest) < aead.NonceSize() {
+		return nil, "", fmt.Errorf("truncated ciphertext")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err = aead.Open(nil, nonce, sealed, nil)
+	return plaintext, keyID, wrapf(err, "decrypting")
+}
+
+var (
+	defaultKeyringMu sync.RWMutex
+	defaultKeyring   *Keyring
+)
+
+// SetDefaultKeyring sets the Keyring used by Encrypted values that have none of their own.
+func SetDefaultKeyring(k *Keyring) {
+	defaultKeyringMu.Lock()
+	defaultKeyring = k
+	defaultKeyringMu.Unlock()
+}
+
+// Encrypted is a column value that is transparently encrypted in the database,
+// using AES-GCM authenticated encryption.
+// It implements sql.Scanner and driver.Valuer,
+// so it can be used with ForQueryRows, Row.Scan, and the struct helpers like any other column type.
+// The plaintext is the JSON encoding of V.
+// The column must have a []byte-compatible type (like BLOB or BYTEA).
+type Encrypted[T any] struct {
+	V T
+
+	// Valid is false for a NULL column value.
+	Valid bool
+
+	// Keyring is used for encryption and decryption.
+	// If it is nil,
+	// the keyring set with SetDefaultKeyring is used.
+	Keyring *Keyring
+
+	keyID string
+}
+
+// NewEncrypted produces a valid Encrypted holding v,
+// using the default keyring.
+func NewEncrypted[T any](v T) Encrypted[T] {
+	return Encrypted[T]{V: v, Valid: true}
+}
+
+func (e *Encrypted[T]) keyring() (*Keyring, error) {
+	if e.Keyring != nil {
+		return e.Keyring, nil
+	}
+	defaultKeyringMu.RLock()
+	defer defaultKeyringMu.RUnlock()
+	if defaultKeyring == nil {
+		return nil, fmt.Errorf("no keyring")
+	}
+	return defaultKeyring, nil
+}
+
+// KeyID returns the ID of the key that encrypted the value most recently scanned into e.
+// Callers can use it to find values needing re-encryption after a key rotation.
+func (e *Encrypted[T]) KeyID() string {
+	return e.keyID
+}
+
+// Value implements driver.Valuer.
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	k, err := e.keyring()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(e.V)
+	if err != nil {
+		return nil, fmt.Errorf("encoding plaintext: %w", err)
+	}
+	return k.encrypt(plaintext)
+}
+
+// Scan implements sql.Scanner.
+func (e *Encrypted[T]) Scan(src interface{}) error {
+	var envelope []byte
+	switch src := src.(type) {
+	case nil:
+		var zero T
+		e.V, e.Valid, e.keyID = zero, false, ""
+		return nil
+	case []byte:
+		envelope = src
+	case string:
+		envelope = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into Encrypted", src)
+	}
+	k, err := e.keyring()
+	if err != nil {
+		return err
+	}
+	plaintext, keyID, err := k.decrypt(envelope)
+	if err != nil {
+		return err
+	}
+	var v T
+	if err = json.Unmarshal(plaintext, &v); err != nil {
+		return fmt.Errorf("decoding plaintext: %w", err)
+	}
+	e.V, e.Valid, e.keyID = v, true, keyID
+	return nil
+}
@@ -0,0 +1,55 @@
+package sqlutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// wrapf annotates err with a message,
+// as fmt.Errorf does with %w,
+// except that it returns nil if err is nil.
+func wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// ErrRetryable marks errors that IsRetryable should report as retryable.
+// Test for it with errors.Is;
+// mark an error with MarkRetryable.
+var ErrRetryable = errors.New("retryable")
+
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string        { return e.err.Error() }
+func (e retryableError) Unwrap() error        { return e.err }
+func (e retryableError) Is(target error) bool { return target == ErrRetryable }
+
+// MarkRetryable wraps err so that errors.Is(err, ErrRetryable) is true,
+// and hence so is IsRetryable(err).
+// It returns nil if err is nil.
+func MarkRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err: err}
+}
+
+// isUniqueViolation tells whether err reports the violation of a uniqueness constraint.
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "23505" {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "duplicate key") || // Postgres
+		strings.Contains(msg, "Duplicate entry") || // MySQL
+		strings.Contains(msg, "UNIQUE constraint failed") // SQLite
+}
@@ -0,0 +1,125 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// FanOutConcurrency is the maximum number of targets QueryFanOut queries at once.
+var FanOutConcurrency = 8
+
+// FanOutError is the error produced by QueryFanOut when the query fails on some targets.
+type FanOutError struct {
+	// Errs holds the error from each target,
+	// indexed like the targets,
+	// and nil for targets that succeeded.
+	Errs []error
+}
+
+func (e *FanOutError) Error() string {
+	var msgs []string
+	for i, err := range e.Errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("target %d: %s", i, err))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// QueryFanOut runs the same query concurrently on each of dbs
+// (e.g. the shards or replicas of a database),
+// at most FanOutConcurrency at a time.
+// The args are as for ForQueryRows,
+// ending with the per-row callback.
+// The callback receives the rows of all targets as they arrive,
+// interleaved in no particular order,
+// but is never called concurrently.
+//
+// If the callback returns an error,
+// the remaining queries are canceled
+// and QueryFanOut returns that error.
+// Otherwise the rows from targets that succeed are all delivered,
+// and if any target fails,
+// QueryFanOut returns a *FanOutError.
+func QueryFanOut(ctx context.Context, dbs []QueryerContext, query string, args ...interface{}) error {
+	if len(args) == 0 {
+		return fmt.Errorf("too few arguments")
+	}
+	var (
+		queryArgs = args[:len(args)-1]
+		fnVal     = reflect.ValueOf(args[len(args)-1])
+	)
+	if fnVal.Kind() != reflect.Func {
+		return fmt.Errorf("fn arg not a function")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		fnErr error
+	)
+	// Serialize calls to the callback and note whether it failed.
+	// Once it has,
+	// rows still arriving from other targets are not delivered.
+	wrapped := reflect.MakeFunc(fnVal.Type(), func(in []reflect.Value) []reflect.Value {
+		mu.Lock()
+		defer mu.Unlock()
+		if fnErr != nil {
+			return []reflect.Value{reflect.ValueOf(&fnErr).Elem()}
+		}
+		out := fnVal.Call(in)
+		if len(out) == 1 && !out[0].IsNil() && fnErr == nil {
+			fnErr = out[0].Interface().(error)
+			cancel()
+		}
+		return out
+	}).Interface()
+
+	var (
+		errs   = make([]error, len(dbs))
+		failed bool
+		sem    = make(chan struct{}, fanOutConcurrency())
+		wg     sync.WaitGroup
+	)
+	for i, db := range dbs {
+		wg.Add(1)
+		go func(i int, db QueryerContext) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			errs[i] = ForQueryRows(ctx, db, query, append(queryArgs[:len(queryArgs):len(queryArgs)], wrapped)...)
+		}(i, db)
+	}
+	wg.Wait()
+
+	if fnErr != nil {
+		return fnErr
+	}
+	for _, err := range errs {
+		if err != nil {
+			failed = true
+			break
+		}
+	}
+	if failed {
+		return &FanOutError{Errs: errs}
+	}
+	return nil
+}
+
+func fanOutConcurrency() int {
+	if FanOutConcurrency < 1 {
+		return 1
+	}
+	return FanOutConcurrency
+}
@@ -0,0 +1,86 @@
+package sqlutil_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+const fanOutQ = "SELECT n FROM nums"
+
+// fanOutTargets produces mocks that each return the given rows for fanOutQ,
+// or fail if rows is nil.
+func fanOutTargets(t *testing.T, rows ...[]int) []sqlutil.QueryerContext {
+	var dbs []sqlutil.QueryerContext
+	for _, r := range rows {
+		m := sqlmockutil.New()
+		t.Cleanup(func() { m.Close() })
+		if r == nil {
+			m.AddError(fanOutQ, errors.New("down"))
+		} else {
+			vals := make([][]interface{}, 0, len(r))
+			for _, n := range r {
+				vals = append(vals, []interface{}{n})
+			}
+			m.AddRows(fanOutQ, []string{"n"}, vals)
+		}
+		dbs = append(dbs, m.DB())
+	}
+	return dbs
+}
+
+func TestQueryFanOut(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("all rows", func(t *testing.T) {
+		var got []int
+		err := sqlutil.QueryFanOut(ctx, fanOutTargets(t, []int{1, 2}, []int{3}, []int{4, 5}), fanOutQ, func(n int) {
+			got = append(got, n)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(got)
+		if len(got) != 5 || got[0] != 1 || got[4] != 5 {
+			t.Errorf("got %v, want [1 2 3 4 5]", got)
+		}
+	})
+
+	t.Run("target fails", func(t *testing.T) {
+		var got []int
+		err := sqlutil.QueryFanOut(ctx, fanOutTargets(t, []int{1}, nil, []int{2}), fanOutQ, func(n int) {
+			got = append(got, n)
+		})
+		var fe *sqlutil.FanOutError
+		if !errors.As(err, &fe) {
+			t.Fatalf("got error %v, want a *FanOutError", err)
+		}
+		if fe.Errs[0] != nil || fe.Errs[1] == nil || fe.Errs[2] != nil {
+			t.Errorf("got errors %v, want a failure from target 1 only", fe.Errs)
+		}
+		if len(got) != 2 {
+			t.Errorf("got %v, want the rows of the other targets", got)
+		}
+	})
+
+	t.Run("callback fails", func(t *testing.T) {
+		var (
+			calls   int
+			errStop = errors.New("stop")
+		)
+		err := sqlutil.QueryFanOut(ctx, fanOutTargets(t, []int{1, 2, 3}, []int{4, 5, 6}, []int{7, 8, 9}), fanOutQ, func(n int) error {
+			calls++
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("got error %v, want %v", err, errStop)
+		}
+		if calls != 1 {
+			t.Errorf("callback called %d times, want 1", calls)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package sqlutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// structField describes the mapping of a struct field to a database column,
+// as controlled by its `sql` struct tag.
+// See the package documentation for the tag syntax.
+type structField struct {
+	index    []int
+	name     string // Go field name
+	column   string
+	typ      reflect.Type
+	pk       bool
+	autoincr bool
+	indexed  bool
+	unique   bool
+	nullable bool
+	dbType   string
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	structFieldsMap sync.Map // reflect.Type -> []structField
+)
+
+// structFields returns the column mappings for the fields of struct type t.
+func structFields(t reflect.Type) ([]structField, error) {
+	if fields, ok := structFieldsMap.Load(t); ok {
+		return fields.([]structField), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct type", t)
+	}
+	fields, err := appendStructFields(nil, t, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if seen[f.column] {
+			return nil, fmt.Errorf("duplicate column %s in %s", f.column, t)
+		}
+		seen[f.column] = true
+	}
+	structFieldsMap.Store(t, fields)
+	return fields, nil
+}
+
+func appendStructFields(fields []structField, t reflect.Type, prefix []int) ([]structField, error) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("sql")
+		if tag == "-" {
+			continue
+		}
+		index := make([]int, len(prefix)+1)
+		copy(index, prefix)
+		index[len(prefix)] = i
+
+		if sf.Anonymous && !hasTag && sf.Type.Kind() == reflect.Struct && sf.Type != timeType {
+			var err error
+			fields, err = appendStructFields(fields, sf.Type, index)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+
+		f := structField{
+			index: index,
+			name:  sf.Name,
+			typ:   sf.Type,
+		}
+		parts := strings.Split(tag, ",")
+		f.column = parts[0]
+		if f.column == "" {
+			f.column = snakeCase(sf.Name)
+		}
+		var leftover bool
+		for _, opt := range parts[1:] {
+			switch {
+			case opt == "leftover":
+				leftover = true
+			case opt == "pk":
+				f.pk = true
+			case opt == "autoincr":
+				f.autoincr = true
+			case opt == "index":
+				f.indexed = true
+			case opt == "unique":
+				f.unique = true
+			case opt == "null":
+				f.nullable = true
+			case strings.HasPrefix(opt, "type="):
+				f.dbType = strings.TrimPrefix(opt, "type=")
+			default:
+				return nil, fmt.Errorf("unknown sql tag option %q on field %s", opt, sf.Name)
+			}
+		}
+		if leftover {
+			// Not a column; see ScanCollect.
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// snakeCase converts a Go identifier like UserID to user_id.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
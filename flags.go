@@ -0,0 +1,171 @@
+package sqlutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flags is a feature-flag store backed by a database table and cached in memory.
+// Call Refresh
+// (or Run)
+// to load the flags;
+// the getters read only the cache.
+//
+// Each flag's value is stored as a string,
+// and interpreted according to the getter used:
+// Bool parses it with strconv.ParseBool,
+// Percent and InPercentage parse it as a number from 0 to 100
+// (with an optional trailing %),
+// and JSON parses it as JSON.
+//
+// The flags table must have these columns:
+//
+//	name   a string-compatible type, uniquely indexed
+//	value  a string-compatible type (like TEXT)
+type Flags struct {
+	db QueryerContext
+
+	// Table is the name of the db table holding flags.
+	// The default if this is unspecified is "flags".
+	Table string
+
+	// Notifier, if set, causes Run to refresh whenever a notification arrives on FlagsChannel,
+	// in addition to its regular interval.
+	Notifier Notifier
+
+	mu   sync.RWMutex
+	vals map[string]string
+}
+
+const defaultFlagsTable = "flags"
+
+// FlagsChannel is the Notifier channel on which Flags listens for changes.
+// Applications that update the flags table should notify it.
+const FlagsChannel = "sqlutil_flags"
+
+// NewFlags produces a new Flags with an empty cache.
+func NewFlags(db QueryerContext) *Flags {
+	return &Flags{db: db}
+}
+
+func (f *Flags) tableName() string {
+	if f.Table == "" {
+		return defaultFlagsTable
+	}
+	return f.Table
+}
+
+// Refresh reloads the cache from the database.
+func (f *Flags) Refresh(ctx context.Context) error {
+	const selQFmt = `SELECT name, value FROM %s`
+	vals := make(map[string]string)
+	err := ForQueryRows(ctx, f.db, fmt.Sprintf(selQFmt, f.tableName()), func(name, value string) {
+		vals[name] = value
+	})
+	if err != nil {
+		return fmt.Errorf("querying flags: %w", err)
+	}
+	f.mu.Lock()
+	f.vals = vals
+	f.mu.Unlock()
+	return nil
+}
+
+// Run calls Refresh every interval
+// (and on notification, if f has a Notifier)
+// until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil;
+// after an error the cache retains its previous contents.
+func (f *Flags) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	for {
+		if err := f.Refresh(ctx); err != nil && ctx.Err() == nil && onErr != nil {
+			onErr(err)
+		}
+		if waitFor(ctx, f.Notifier, FlagsChannel, interval) != nil {
+			return
+		}
+	}
+}
+
+// String returns the raw value of the named flag,
+// or def if it is not set.
+func (f *Flags) String(name, def string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if v, ok := f.vals[name]; ok {
+		return v
+	}
+	return def
+}
+
+func (f *Flags) lookup(name string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	v, ok := f.vals[name]
+	return v, ok
+}
+
+// Bool returns the value of the named flag as a boolean,
+// or def if it is not set or cannot be parsed.
+func (f *Flags) Bool(name string, def bool) bool {
+	v, ok := f.lookup(name)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// Percent returns the value of the named flag as a percentage from 0 to 100,
+// or def if it is not set or cannot be parsed.
+func (f *Flags) Percent(name string, def float64) float64 {
+	v, ok := f.lookup(name)
+	if !ok {
+		return def
+	}
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+	if err != nil || p < 0 || p > 100 {
+		return def
+	}
+	return p
+}
+
+// InPercentage tells whether subject
+// (e.g. a user ID)
+// falls within the percentage given by the named flag.
+// A given subject consistently falls in or out for a given flag and percentage,
+// and raising the percentage only adds subjects.
+// If the flag is not set or cannot be parsed,
+// the result is def.
+func (f *Flags) InPercentage(name, subject string, def bool) bool {
+	p := f.Percent(name, -1)
+	if p < 0 {
+		return def
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(subject))
+	return float64(h.Sum32()%10000) < p*100
+}
+
+// JSON parses the value of the named flag as JSON into dst.
+// It reports whether the flag is set and could be parsed;
+// if it is not set, dst is unchanged.
+func (f *Flags) JSON(name string, dst interface{}) bool {
+	v, ok := f.lookup(name)
+	if !ok {
+		return false
+	}
+	return json.Unmarshal([]byte(v), dst) == nil
+}
@@ -0,0 +1,71 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetOrCreate returns an existing row or inserts and returns a new one.
+// It runs selectQuery with selectArgs,
+// scanning the resulting row into dest
+// (which may be a single struct pointer, as in Row.Scan).
+// If there is no such row,
+// it runs insertQuery with insertArgs
+// and then selectQuery again.
+// If the insert fails with a uniqueness violation,
+// meaning a concurrent caller created the row first,
+// that row is returned instead.
+// The boolean result tells whether this call created the row.
+//
+// On Postgres,
+// a failed statement aborts the enclosing transaction,
+// so when db is a *sql.Tx
+// the insert is made in a savepoint,
+// which is rolled back on a uniqueness violation.
+func GetOrCreate(ctx context.Context, db QueryExecerContext, d Dialect, selectQuery string, selectArgs []interface{}, insertQuery string, insertArgs []interface{}, dest ...interface{}) (bool, error) {
+	err := QueryRowContext(ctx, db, selectQuery, selectArgs...).Scan(dest...)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, wrapf(err, "selecting existing row")
+	}
+
+	created, err := insertIgnoringConflict(ctx, db, d, insertQuery, insertArgs)
+	if err != nil {
+		return false, err
+	}
+
+	err = QueryRowContext(ctx, db, selectQuery, selectArgs...).Scan(dest...)
+	return created, wrapf(err, "selecting row after insert")
+}
+
+// insertIgnoringConflict executes insertQuery,
+// reporting whether it succeeded
+// and treating a uniqueness violation as an unsuccessful but error-free result.
+func insertIgnoringConflict(ctx context.Context, db QueryExecerContext, d Dialect, insertQuery string, insertArgs []interface{}) (bool, error) {
+	_, inTx := db.(*sql.Tx)
+	savepoint := inTx && d == Postgres
+
+	if savepoint {
+		if _, err := db.ExecContext(ctx, "SAVEPOINT sqlutil_get_or_create"); err != nil {
+			return false, fmt.Errorf("creating savepoint: %w", err)
+		}
+	}
+
+	_, err := db.ExecContext(ctx, insertQuery, insertArgs...)
+	switch {
+	case err == nil:
+		if savepoint {
+			_, err = db.ExecContext(ctx, "RELEASE SAVEPOINT sqlutil_get_or_create")
+		}
+		return true, wrapf(err, "releasing savepoint")
+
+	case isUniqueViolation(err):
+		if savepoint {
+			_, err = db.ExecContext(ctx, "ROLLBACK TO SAVEPOINT sqlutil_get_or_create")
+			return false, wrapf(err, "rolling back to savepoint")
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("inserting row: %w", err)
+}
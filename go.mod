@@ -1,5 +1,5 @@
 module github.com/bobg/sqlutil
 
-go 1.13
+go 1.21
 
-require github.com/pkg/errors v0.9.1
+require github.com/mattn/go-sqlite3 v1.14.22
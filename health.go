@@ -0,0 +1,287 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker monitors a database by pinging it,
+// tracking consecutive failures.
+// After Threshold consecutive failures its circuit breaker opens,
+// and Healthy reports false,
+// until a ping succeeds again.
+// While the breaker is open,
+// DBs produced by Guard fail fast with ErrUnhealthy
+// instead of piling up requests against an unavailable database.
+type HealthChecker struct {
+	db PingerContext
+
+	// Threshold is the number of consecutive failed pings that opens the breaker.
+	// The default if this is unspecified is 3.
+	Threshold int
+
+	// Timeout bounds each ping.
+	// The default if this is unspecified is 5 seconds.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	failures int
+	lastErr  error
+}
+
+const (
+	defaultHealthThreshold = 3
+	defaultHealthTimeout   = 5 * time.Second
+)
+
+// ErrUnhealthy is the error produced by a guarded DB
+// (see HealthChecker.Guard)
+// while the HealthChecker's circuit breaker is open.
+var ErrUnhealthy = errors.New("database unhealthy")
+
+// NewHealthChecker produces a new HealthChecker for db
+// (which is typically a *sql.DB).
+// It starts out healthy.
+func NewHealthChecker(db PingerContext) *HealthChecker {
+	return &HealthChecker{db: db}
+}
+
+func (h *HealthChecker) threshold() int {
+	if h.Threshold <= 0 {
+		return defaultHealthThreshold
+	}
+	return h.Threshold
+}
+
+func (h *HealthChecker) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return defaultHealthTimeout
+	}
+	return h.Timeout
+}
+
+// Check pings the database once and records the result.
+// It returns the ping's error.
+func (h *HealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+
+	err := h.db.PingContext(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failures++
+		h.lastErr = err
+	} else {
+		h.failures = 0
+		h.lastErr = nil
+	}
+	return err
+}
+
+// Run calls Check every interval until ctx is canceled.
+func (h *HealthChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Healthy tells whether the circuit breaker is closed,
+// i.e. fewer than Threshold consecutive pings have failed.
+func (h *HealthChecker) Healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures < h.threshold()
+}
+
+// ConsecutiveFailures returns the number of consecutive failed pings,
+// and the error from the latest one.
+func (h *HealthChecker) ConsecutiveFailures() (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures, h.lastErr
+}
+
+// Handler returns an http.Handler suitable for a readiness probe.
+// It responds with status 200 while h is healthy
+// and 503 otherwise.
+func (h *HealthChecker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if h.Healthy() {
+			w.Write([]byte("ok\n"))
+			return
+		}
+		http.Error(w, ErrUnhealthy.Error(), http.StatusServiceUnavailable)
+	})
+}
+
+// Guard produces a DB that fails with ErrUnhealthy while h's circuit breaker is open,
+// and otherwise passes operations through to db.
+// Note that QueryRowContext cannot report ErrUnhealthy
+// (since *sql.Row cannot carry an arbitrary error)
+// and is always passed through;
+// the package-level QueryRowContext function is guarded,
+// since it uses QueryContext.
+func (h *HealthChecker) Guard(db DB) *GuardedDB {
+	return &GuardedDB{DB: db, h: h}
+}
+
+// GuardedDB is the type of DB produced by HealthChecker.Guard.
+type GuardedDB struct {
+	DB
+	h *HealthChecker
+}
+
+// PrepareContext implements PreparerContext.
+func (g *GuardedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if !g.h.Healthy() {
+		return nil, ErrUnhealthy
+	}
+	return g.DB.PrepareContext(ctx, query)
+}
+
+// QueryContext implements QueryerContext.
+func (g *GuardedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if !g.h.Healthy() {
+		return nil, ErrUnhealthy
+	}
+	return g.DB.QueryContext(ctx, query, args...)
+}
+
+// ExecContext implements ExecerContext.
+func (g *GuardedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if !g.h.Healthy() {
+		return nil, ErrUnhealthy
+	}
+	return g.DB.ExecContext(ctx, query, args...)
+}
+
+// Begin begins a transaction.
+func (g *GuardedDB) Begin() (*sql.Tx, error) {
+	if !g.h.Healthy() {
+		return nil, ErrUnhealthy
+	}
+	return g.DB.Begin()
+}
+
+// HealthOptions are options for HealthHandler.
+// A nil *HealthOptions is equivalent to a zero one.
+type HealthOptions struct {
+	// Query is the probe query.
+	// Any rows it produces are discarded.
+	// The default if this is unspecified is "SELECT 1".
+	Query string
+
+	// Timeout bounds each probe.
+	// The default if this is unspecified is 5 seconds.
+	Timeout time.Duration
+
+	// Checker, if set, is a HealthChecker whose circuit-breaker state is included in the response.
+	// While its breaker is open,
+	// the handler reports the database unhealthy
+	// even if the probe succeeds.
+	Checker *HealthChecker
+}
+
+const defaultHealthQuery = "SELECT 1"
+
+func (o *HealthOptions) query() string {
+	if o == nil || o.Query == "" {
+		return defaultHealthQuery
+	}
+	return o.Query
+}
+
+func (o *HealthOptions) timeout() time.Duration {
+	if o == nil || o.Timeout <= 0 {
+		return defaultHealthTimeout
+	}
+	return o.Timeout
+}
+
+func (o *HealthOptions) checker() *HealthChecker {
+	if o == nil {
+		return nil
+	}
+	return o.Checker
+}
+
+// healthStatus is the JSON response of HealthHandler.
+type healthStatus struct {
+	Status   string  `json:"status"` // "ok" or "unhealthy"
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+
+	Breaker             string `json:"breaker,omitempty"` // "closed" or "open"
+	ConsecutiveFailures int    `json:"consecutive_failures,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// HealthHandler returns an http.Handler suitable for readiness and liveness probes.
+// On each request it runs a probe query against db,
+// and responds with a JSON status
+// (status, duration_seconds, and any error,
+// plus the circuit-breaker state if opts has a Checker)
+// and HTTP status 200 if the database is healthy,
+// 503 otherwise.
+func HealthHandler(db QueryerContext, opts *HealthOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), opts.timeout())
+		defer cancel()
+
+		start := time.Now()
+		err := probe(ctx, db, opts.query())
+
+		s := healthStatus{
+			Status:   "ok",
+			Duration: time.Since(start).Seconds(),
+		}
+		if err != nil {
+			s.Status = "unhealthy"
+			s.Error = RedactDSN(err.Error())
+		}
+		if h := opts.checker(); h != nil {
+			s.Breaker = "closed"
+			if !h.Healthy() {
+				s.Breaker = "open"
+				s.Status = "unhealthy"
+			}
+			var lastErr error
+			s.ConsecutiveFailures, lastErr = h.ConsecutiveFailures()
+			if lastErr != nil {
+				s.LastError = RedactDSN(lastErr.Error())
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if s.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(s)
+	})
+}
+
+func probe(ctx context.Context, db QueryerContext, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
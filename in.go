@@ -0,0 +1,138 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InList produces a parenthesized list of n placeholders,
+// numbered from first,
+// for use in an SQL IN clause:
+// InList(3, 2) is "($3, $4)".
+func InList(first, n int) string {
+	return inList(Postgres.Placeholder, first, n)
+}
+
+func inList(ph func(int) string, first, n int) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(ph(first + i))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// ForQueryRowsIn is like ForQueryRows for a query with an IN clause whose values are inVals.
+// The query is given as queryFmt,
+// in which the single %s is replaced by a parenthesized list of placeholders
+// (an InList, or the equivalent for the Dialect in ctx; see WithDialect).
+// The remaining args are the query's other arguments
+// (referred to as $1, $2, ...)
+// followed by the callback,
+// as in ForQueryRows.
+// The IN-list placeholders are numbered after the other arguments.
+//
+// If inVals would make the query exceed the placeholder limit
+// (MaxParams, or that of the Dialect in ctx; see WithDialect),
+// it is split into as many queries as needed,
+// run one after another,
+// and the callback receives the rows of all of them.
+// Any ordering within the result of each query does not extend across queries,
+// and in any case an IN clause does not order the rows to match inVals;
+// to get the rows in the order of inVals,
+// sort them with SortByIn.
+// If inVals is empty,
+// no query is run.
+func ForQueryRowsIn(ctx context.Context, db QueryerContext, queryFmt string, inVals []interface{}, args ...interface{}) error {
+	if len(args) == 0 {
+		return fmt.Errorf("too few arguments")
+	}
+	var (
+		queryArgs = args[:len(args)-1]
+		fn        = args[len(args)-1]
+	)
+	return splitIn(maxParams(ctx), placeholder(ctx), queryFmt, inVals, queryArgs, func(query string, batchArgs []interface{}) error {
+		return ForQueryRows(ctx, db, query, append(batchArgs, fn)...)
+	})
+}
+
+// QueryAll runs query and returns the single-column result as a slice.
+// If T is a struct type,
+// the result may have any number of columns,
+// which are scanned into each element by name
+// (see ForQueryRows).
+func QueryAll[T any](ctx context.Context, db QueryerContext, query string, args ...interface{}) ([]T, error) {
+	var result []T
+	err := ForQueryRows(ctx, db, query, append(args, func(v T) {
+		result = append(result, v)
+	})...)
+	return result, err
+}
+
+// QueryAllIn is like QueryAll for a query with an IN clause,
+// splitting oversized lists of inVals as ForQueryRowsIn does.
+// The result is not in the order of inVals;
+// use SortByIn for that.
+func QueryAllIn[T any](ctx context.Context, db QueryerContext, queryFmt string, inVals []interface{}, args ...interface{}) ([]T, error) {
+	var result []T
+	err := splitIn(maxParams(ctx), placeholder(ctx), queryFmt, inVals, args, func(query string, batchArgs []interface{}) error {
+		batch, err := QueryAll[T](ctx, db, query, batchArgs...)
+		result = append(result, batch...)
+		return err
+	})
+	return result, err
+}
+
+// splitIn calls fn with each query and argument list needed to cover inVals,
+// using at most limit placeholders per query,
+// written with ph.
+func splitIn(limit int, ph func(int) string, queryFmt string, inVals, args []interface{}, fn func(query string, args []interface{}) error) error {
+	perQuery := limit - len(args)
+	if perQuery < 1 {
+		return fmt.Errorf("too many arguments (%d) for placeholder limit (%d)", len(args), limit)
+	}
+	for len(inVals) > 0 {
+		batch := inVals
+		if len(batch) > perQuery {
+			batch = batch[:perQuery]
+		}
+		inVals = inVals[len(batch):]
+
+		var (
+			query     = fmt.Sprintf(queryFmt, inList(ph, len(args)+1, len(batch)))
+			batchArgs = make([]interface{}, 0, len(args)+len(batch))
+		)
+		batchArgs = append(batchArgs, args...)
+		batchArgs = append(batchArgs, batch...)
+		if err := fn(query, batchArgs); err != nil {
+			return fmt.Errorf("querying IN-list batch: %w", err)
+		}
+	}
+	return nil
+}
+
+// SortByIn sorts results into the order of inVals,
+// comparing each inVals element with the key of each result.
+// Results whose keys are not in inVals go last.
+// The sort is stable.
+func SortByIn[T any, K comparable](results []T, inVals []K, key func(T) K) {
+	pos := make(map[K]int, len(inVals))
+	for i, v := range inVals {
+		if _, ok := pos[v]; !ok {
+			pos[v] = i
+		}
+	}
+	rank := func(t T) int {
+		if p, ok := pos[key(t)]; ok {
+			return p
+		}
+		return len(inVals)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return rank(results[i]) < rank(results[j]) })
+}
@@ -0,0 +1,72 @@
+package sqlutil_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestQueryAllIn(t *testing.T) {
+	// More values than SQLite's 999 placeholders allow in one query.
+	const n = 1500
+
+	vals := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		vals = append(vals, fmt.Sprintf("(%d, %d)", i, i%3))
+	}
+	db := testdb.NewSQLite(t, testdb.DDL(
+		"CREATE TABLE nums (n INTEGER PRIMARY KEY, mod3 INTEGER NOT NULL)",
+		"INSERT INTO nums (n, mod3) VALUES "+strings.Join(vals, ", "),
+	))
+
+	inVals := make([]interface{}, 0, n)
+	for i := n; i > 0; i-- {
+		inVals = append(inVals, i)
+	}
+
+	ctx := sqlutil.WithDialect(context.Background(), sqlutil.SQLite)
+	got, err := sqlutil.QueryAllIn[int](ctx, db, "SELECT n FROM nums WHERE mod3 = ? AND n IN %s", inVals, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n/3 {
+		t.Fatalf("got %d results, want %d", len(got), n/3)
+	}
+
+	sqlutil.SortByIn(got, inVals, func(v int) interface{} { return v })
+	if got[0] != n || got[len(got)-1] != 3 {
+		t.Errorf("got results from %d to %d after SortByIn, want %d to 3", got[0], got[len(got)-1], n)
+	}
+}
+
+func TestQueryAllInPlaceholders(t *testing.T) {
+	cases := []struct {
+		d    sqlutil.Dialect
+		want string
+	}{
+		{sqlutil.Postgres, "SELECT n FROM nums WHERE mod3 = $1 AND n IN ($2, $3)"},
+		{sqlutil.MySQL, "SELECT n FROM nums WHERE mod3 = ? AND n IN (?, ?)"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.d.String(), func(t *testing.T) {
+			m := sqlmockutil.New()
+			defer m.Close()
+			m.AddRows(tc.want, []string{"n"}, [][]interface{}{{1}, {2}})
+
+			query := strings.Replace(tc.want, "(?, ?)", "%s", 1)
+			query = strings.Replace(query, "($2, $3)", "%s", 1)
+			got, err := sqlutil.QueryAllIn[int](sqlutil.WithDialect(context.Background(), tc.d), m.DB(), query, []interface{}{1, 2}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 {
+				t.Errorf("got %v, want [1 2]", got)
+			}
+		})
+	}
+}
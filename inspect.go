@@ -0,0 +1,207 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// TableInfo describes a table in a live database.
+type TableInfo struct {
+	Name    string
+	Columns []ColumnInfo
+
+	// PrimaryKey lists the primary-key columns, in key order.
+	PrimaryKey []string
+
+	// Indexes lists the table's indexes other than its primary key.
+	Indexes []IndexInfo
+}
+
+// ColumnInfo describes a column in a live table.
+type ColumnInfo struct {
+	Name string
+
+	// Type is the column's type as reported by the database,
+	// which may differ in spelling from how it was declared.
+	Type string
+
+	Nullable bool
+
+	// Default is the column's default-value expression,
+	// or nil if it has none.
+	Default *string
+}
+
+// IndexInfo describes an index on a live table.
+type IndexInfo struct {
+	Name string
+
+	// Columns lists the indexed columns, in index order.
+	// Expression columns are omitted.
+	Columns []string
+
+	Unique bool
+}
+
+// Inspect describes all the tables in db
+// (in the current schema, for Postgres,
+// or the current database, for MySQL).
+func Inspect(ctx context.Context, db QueryerContext, d Dialect) ([]*TableInfo, error) {
+	names, err := InspectTables(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*TableInfo, 0, len(names))
+	for _, name := range names {
+		info, err := InspectTable(ctx, db, d, name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// InspectTables returns the names of the tables in db
+// (in the current schema, for Postgres,
+// or the current database, for MySQL),
+// in sorted order.
+func InspectTables(ctx context.Context, db QueryerContext, d Dialect) ([]string, error) {
+	var q string
+	switch d {
+	case Postgres:
+		q = `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`
+	case MySQL:
+		q = `SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`
+	case SQLite:
+		q = `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`
+	default:
+		return nil, fmt.Errorf("unknown dialect %d", d)
+	}
+	var names []string
+	err := ForQueryRows(ctx, db, q, func(name string) {
+		names = append(names, name)
+	})
+	return names, wrapf(err, "querying tables")
+}
+
+// InspectTable describes the given table in db.
+// If the table does not exist,
+// the result has no columns.
+func InspectTable(ctx context.Context, db QueryerContext, d Dialect, table string) (*TableInfo, error) {
+	cols, err := InspectColumns(ctx, db, d, table)
+	if err != nil {
+		return nil, fmt.Errorf("querying columns: %w", err)
+	}
+	pk, err := inspectPrimaryKey(ctx, db, d, table)
+	if err != nil {
+		return nil, fmt.Errorf("querying primary key: %w", err)
+	}
+	indexes, err := inspectIndexes(ctx, db, d, table)
+	if err != nil {
+		return nil, fmt.Errorf("querying indexes: %w", err)
+	}
+	return &TableInfo{
+		Name:       table,
+		Columns:    cols,
+		PrimaryKey: pk,
+		Indexes:    indexes,
+	}, nil
+}
+
+// InspectColumns returns the columns of the given table in db, in order.
+// It returns no columns (and no error) if the table does not exist.
+func InspectColumns(ctx context.Context, db QueryerContext, d Dialect, table string) ([]ColumnInfo, error) {
+	var cols []ColumnInfo
+	switch d {
+	case Postgres, MySQL:
+		typeCol, schema := "data_type", "current_schema()"
+		if d == MySQL {
+			typeCol, schema = "column_type", "DATABASE()"
+		}
+		q := fmt.Sprintf(`SELECT column_name, %s, is_nullable, column_default FROM information_schema.columns WHERE table_schema = %s AND table_name = %s ORDER BY ordinal_position`, typeCol, schema, d.Placeholder(1))
+		err := ForQueryRows(ctx, db, q, table, func(name, typ, isNullable string, def sql.NullString) {
+			cols = append(cols, ColumnInfo{Name: name, Type: typ, Nullable: isNullable == "YES", Default: nullStringPtr(def)})
+		})
+		return cols, err
+
+	case SQLite:
+		const q = `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`
+		err := ForQueryRows(ctx, db, q, table, func(name, typ string, notnull bool, def sql.NullString, pk int) {
+			cols = append(cols, ColumnInfo{Name: name, Type: typ, Nullable: !notnull && pk == 0, Default: nullStringPtr(def)})
+		})
+		return cols, err
+	}
+	return nil, fmt.Errorf("unknown dialect %d", d)
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func inspectPrimaryKey(ctx context.Context, db QueryerContext, d Dialect, table string) ([]string, error) {
+	var q string
+	switch d {
+	case Postgres, MySQL:
+		schema := "current_schema()"
+		if d == MySQL {
+			schema = "DATABASE()"
+		}
+		q = fmt.Sprintf(`SELECT kcu.column_name FROM information_schema.table_constraints tc`+
+			` JOIN information_schema.key_column_usage kcu`+
+			` ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema AND tc.table_name = kcu.table_name`+
+			` WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = %s AND tc.table_name = %s`+
+			` ORDER BY kcu.ordinal_position`, schema, d.Placeholder(1))
+	case SQLite:
+		q = `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`
+	default:
+		return nil, fmt.Errorf("unknown dialect %d", d)
+	}
+	var cols []string
+	err := ForQueryRows(ctx, db, q, table, func(col string) {
+		cols = append(cols, col)
+	})
+	return cols, err
+}
+
+func inspectIndexes(ctx context.Context, db QueryerContext, d Dialect, table string) ([]IndexInfo, error) {
+	var q string
+	switch d {
+	case Postgres:
+		q = `SELECT i.relname, ix.indisunique, a.attname FROM pg_class t` +
+			` JOIN pg_namespace n ON n.oid = t.relnamespace` +
+			` JOIN pg_index ix ON ix.indrelid = t.oid` +
+			` JOIN pg_class i ON i.oid = ix.indexrelid` +
+			` JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true` +
+			` LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum` +
+			` WHERE n.nspname = current_schema() AND t.relname = $1 AND NOT ix.indisprimary` +
+			` ORDER BY i.relname, k.ord`
+	case MySQL:
+		q = `SELECT index_name, non_unique = 0, column_name FROM information_schema.statistics` +
+			` WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'` +
+			` ORDER BY index_name, seq_in_index`
+	case SQLite:
+		q = `SELECT il.name, il."unique", ii.name FROM pragma_index_list(?) il` +
+			` JOIN pragma_index_info(il.name) ii` +
+			` WHERE il.origin <> 'pk'` +
+			` ORDER BY il.name, ii.seqno`
+	default:
+		return nil, fmt.Errorf("unknown dialect %d", d)
+	}
+
+	var indexes []IndexInfo
+	err := ForQueryRows(ctx, db, q, table, func(name string, unique bool, col sql.NullString) {
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, IndexInfo{Name: name, Unique: unique})
+		}
+		if col.Valid {
+			idx := &indexes[len(indexes)-1]
+			idx.Columns = append(idx.Columns, col.String)
+		}
+	})
+	return indexes, err
+}
@@ -0,0 +1,177 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KV is a key-value store in a database table.
+// Like Lessor,
+// it's a wrapper around a database handle
+// that specifies the name of the table and its important columns.
+//
+// Set and CompareAndSwap use INSERT ... ON CONFLICT,
+// as supported by Postgres and SQLite.
+type KV struct {
+	db DB
+
+	// Table is the name of the db table holding key-value pairs.
+	// The default if this is unspecified is "kv".
+	Table string
+
+	// Name is the name of the column holding keys.
+	// The column must have a string-compatible type (like TEXT).
+	// It must be uniquely indexed (and would make a suitable PRIMARY KEY for the table).
+	// The default if this is unspecified is "name".
+	Name string
+
+	// Value is the name of the column holding values.
+	// The column must have a []byte-compatible type (like BLOB or BYTEA).
+	// The default if this is unspecified is "value".
+	Value string
+
+	// Exp is the name of the column holding the expiration times of keys with a TTL.
+	// The column must have a nullable time.Time-compatible type (like DATETIME).
+	// The default if this is unspecified is "exp".
+	Exp string
+}
+
+const (
+	defaultKVTable = "kv"
+	defaultKVValue = "value"
+)
+
+// ErrKeyNotFound is the error produced by KV.Get when the key does not exist or has expired.
+var ErrKeyNotFound = errors.New("key not found")
+
+// NewKV produces a new KV.
+func NewKV(db DB) *KV {
+	return &KV{db: db}
+}
+
+func (kv *KV) tableName() string {
+	if kv.Table == "" {
+		return defaultKVTable
+	}
+	return kv.Table
+}
+
+func (kv *KV) nameName() string {
+	if kv.Name == "" {
+		return defaultName
+	}
+	return kv.Name
+}
+
+func (kv *KV) valueName() string {
+	if kv.Value == "" {
+		return defaultKVValue
+	}
+	return kv.Value
+}
+
+func (kv *KV) expName() string {
+	if kv.Exp == "" {
+		return defaultExp
+	}
+	return kv.Exp
+}
+
+// expiry converts a TTL to a value for the Exp column.
+// A TTL of zero or less means no expiration.
+func expiry(now time.Time, ttl time.Duration) interface{} {
+	if ttl <= 0 {
+		return nil
+	}
+	return now.Add(ttl)
+}
+
+// Get returns the value of key.
+// If the key does not exist or has expired,
+// the error is ErrKeyNotFound.
+func (kv *KV) Get(ctx context.Context, key string) ([]byte, error) {
+	const selQFmt = `SELECT %[3]s FROM %[1]s WHERE %[2]s = $1 AND (%[4]s IS NULL OR %[4]s > $2)`
+	selQ := fmt.Sprintf(selQFmt, kv.tableName(), kv.nameName(), kv.valueName(), kv.expName())
+	var val []byte
+	err := kv.db.QueryRowContext(ctx, selQ, key, time.Now()).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	return val, wrapf(err, "querying database")
+}
+
+// Set sets the value of key.
+// If ttl is positive,
+// the key expires after that long;
+// otherwise it does not expire.
+func (kv *KV) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	const upsQFmt = `INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s) VALUES ($1, $2, $3)` +
+		` ON CONFLICT (%[2]s) DO UPDATE SET %[3]s = EXCLUDED.%[3]s, %[4]s = EXCLUDED.%[4]s`
+	upsQ := fmt.Sprintf(upsQFmt, kv.tableName(), kv.nameName(), kv.valueName(), kv.expName())
+	_, err := kv.db.ExecContext(ctx, upsQ, key, val, expiry(time.Now(), ttl))
+	return wrapf(err, "upserting into database")
+}
+
+// Delete deletes key.
+// It is not an error if the key does not exist.
+func (kv *KV) Delete(ctx context.Context, key string) error {
+	const delQFmt = `DELETE FROM %s WHERE %s = $1`
+	delQ := fmt.Sprintf(delQFmt, kv.tableName(), kv.nameName())
+	_, err := kv.db.ExecContext(ctx, delQ, key)
+	return wrapf(err, "deleting from database")
+}
+
+// CompareAndSwap sets the value of key to newVal,
+// with the given ttl (as in Set),
+// but only if its current value is oldVal.
+// An oldVal of nil means the key must not exist
+// (or must have expired).
+// The boolean result tells whether the swap happened.
+func (kv *KV) CompareAndSwap(ctx context.Context, key string, oldVal, newVal []byte, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	if oldVal == nil {
+		const delQFmt = `DELETE FROM %s WHERE %s = $1 AND %s < $2`
+		delQ := fmt.Sprintf(delQFmt, kv.tableName(), kv.nameName(), kv.expName())
+		if _, err := kv.db.ExecContext(ctx, delQ, key, now); err != nil {
+			return false, fmt.Errorf("deleting expired key: %w", err)
+		}
+
+		const insQFmt = `INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s) VALUES ($1, $2, $3) ON CONFLICT (%[2]s) DO NOTHING`
+		insQ := fmt.Sprintf(insQFmt, kv.tableName(), kv.nameName(), kv.valueName(), kv.expName())
+		res, err := kv.db.ExecContext(ctx, insQ, key, newVal, expiry(now, ttl))
+		if err != nil {
+			return false, fmt.Errorf("inserting into database: %w", err)
+		}
+		aff, err := res.RowsAffected()
+		return aff > 0, wrapf(err, "counting affected rows")
+	}
+
+	const updQFmt = `UPDATE %[1]s SET %[3]s = $1, %[4]s = $2 WHERE %[2]s = $3 AND %[3]s = $4 AND (%[4]s IS NULL OR %[4]s > $5)`
+	updQ := fmt.Sprintf(updQFmt, kv.tableName(), kv.nameName(), kv.valueName(), kv.expName())
+	res, err := kv.db.ExecContext(ctx, updQ, newVal, expiry(now, ttl), key, oldVal, now)
+	if err != nil {
+		return false, fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff > 0, wrapf(err, "counting affected rows")
+}
+
+// DeleteExpired deletes expired keys from the table.
+// Expired keys are never visible to Get,
+// but they occupy space until they are deleted
+// (or overwritten).
+func (kv *KV) DeleteExpired(ctx context.Context) error {
+	_, err := deleteExpired(ctx, kv.db, kv.tableName(), kv.expName(), time.Now())
+	return wrapf(err, "deleting expired keys")
+}
+
+// RunExpirer deletes expired keys every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func (kv *KV) RunExpirer(ctx context.Context, interval time.Duration, onErr func(error)) {
+	runExpirer(ctx, kv.db, kv.tableName(), kv.expName(), interval, onErr)
+}
@@ -0,0 +1,226 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// LagAwareDB is a DB that sends reads to a replica only when the replica is fresh enough.
+// Unlike RoutingDB,
+// it measures each replica's freshness with a heartbeat table:
+// WriteHeartbeat records the current time in the primary's heartbeat table,
+// and MeasureLag reads the replicated value back from each replica.
+// A read is sent to a replica only if
+// the replica's data is no older than the permitted staleness
+// (see MaxStaleness and WithMaxStaleness)
+// and,
+// for contexts produced by NewSession,
+// the replica has caught up with the session's latest write.
+// Otherwise the read goes to the primary.
+//
+// The heartbeat table must have these columns:
+//
+//	id  an integer primary key; only the row with id 1 is used
+//	ts  a time.Time-compatible type (like DATETIME)
+type LagAwareDB struct {
+	primary  DB
+	replicas []DB
+	asOf     []int64 // per replica, accessed atomically: UnixNano of the latest heartbeat seen there, or 0
+
+	// HeartbeatTable is the name of the heartbeat table.
+	// The default if this is unspecified is "heartbeat".
+	HeartbeatTable string
+
+	// MaxStaleness is the default for how far behind the primary a replica may be for reads.
+	// It can be overridden per context with WithMaxStaleness.
+	// A value of zero means reads always go to the primary
+	// unless overridden.
+	MaxStaleness time.Duration
+
+	next uint32 // accessed atomically
+}
+
+const defaultHeartbeatTable = "heartbeat"
+
+// NewLagAwareDB produces a new LagAwareDB with the given primary and replicas
+// and default maximum staleness.
+// Until MeasureLag is called,
+// all reads go to the primary.
+func NewLagAwareDB(primary DB, maxStaleness time.Duration, replicas ...DB) *LagAwareDB {
+	return &LagAwareDB{
+		primary:      primary,
+		replicas:     replicas,
+		asOf:         make([]int64, len(replicas)),
+		MaxStaleness: maxStaleness,
+	}
+}
+
+func (l *LagAwareDB) tableName() string {
+	if l.HeartbeatTable == "" {
+		return defaultHeartbeatTable
+	}
+	return l.HeartbeatTable
+}
+
+type session struct {
+	lastWrite int64 // accessed atomically: UnixNano
+}
+
+var (
+	sessionCtxkey   = ctxkeytype("session")
+	stalenessCtxkey = ctxkeytype("staleness")
+)
+
+// NewSession creates a child of the given context object that tracks its writes through LagAwareDB,
+// so that subsequent reads in the same context see them
+// (read-your-writes consistency).
+func NewSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionCtxkey, &session{})
+}
+
+// WithMaxStaleness creates a child of the given context object
+// in which LagAwareDB permits reads from replicas up to d behind the primary,
+// overriding its MaxStaleness.
+func WithMaxStaleness(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, stalenessCtxkey, d)
+}
+
+// WriteHeartbeat records the current time in the primary's heartbeat table.
+// Call it periodically
+// (or use Run).
+func (l *LagAwareDB) WriteHeartbeat(ctx context.Context) error {
+	now := time.Now()
+
+	const updQFmt = `UPDATE %s SET ts = $1 WHERE id = 1`
+	res, err := l.primary.ExecContext(ctx, fmt.Sprintf(updQFmt, l.tableName()), now)
+	if err != nil {
+		return fmt.Errorf("updating heartbeat: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff > 0 {
+		return nil
+	}
+	const insQFmt = `INSERT INTO %s (id, ts) VALUES (1, $1)`
+	_, err = l.primary.ExecContext(ctx, fmt.Sprintf(insQFmt, l.tableName()), now)
+	return wrapf(err, "inserting heartbeat")
+}
+
+// MeasureLag reads the heartbeat from each replica.
+// A replica whose heartbeat cannot be read is not used for reads
+// until a later MeasureLag succeeds.
+func (l *LagAwareDB) MeasureLag(ctx context.Context) {
+	const selQFmt = `SELECT ts FROM %s WHERE id = 1`
+	selQ := fmt.Sprintf(selQFmt, l.tableName())
+	for i, replica := range l.replicas {
+		var ts time.Time
+		var asOf int64
+		if err := replica.QueryRowContext(ctx, selQ).Scan(&ts); err == nil {
+			asOf = ts.UnixNano()
+		}
+		atomic.StoreInt64(&l.asOf[i], asOf)
+	}
+}
+
+// Lag returns how far behind the primary replica i was at the latest MeasureLag,
+// and whether that is known.
+func (l *LagAwareDB) Lag(i int) (time.Duration, bool) {
+	asOf := atomic.LoadInt64(&l.asOf[i])
+	if asOf == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, asOf)), true
+}
+
+// Run calls WriteHeartbeat and MeasureLag every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func (l *LagAwareDB) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.WriteHeartbeat(ctx); err != nil && onErr != nil {
+			onErr(err)
+		}
+		l.MeasureLag(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *LagAwareDB) reader(ctx context.Context) DB {
+	if IsForcePrimary(ctx) || len(l.replicas) == 0 {
+		return l.primary
+	}
+	staleness := l.MaxStaleness
+	if d, ok := ctx.Value(stalenessCtxkey).(time.Duration); ok {
+		staleness = d
+	}
+	if staleness <= 0 {
+		return l.primary
+	}
+	var lastWrite int64
+	if s, ok := ctx.Value(sessionCtxkey).(*session); ok {
+		lastWrite = atomic.LoadInt64(&s.lastWrite)
+	}
+	minAsOf := time.Now().Add(-staleness).UnixNano()
+
+	start := atomic.AddUint32(&l.next, 1)
+	for i := 0; i < len(l.replicas); i++ {
+		idx := (int(start) + i) % len(l.replicas)
+		asOf := atomic.LoadInt64(&l.asOf[idx])
+		if asOf != 0 && asOf >= minAsOf && asOf >= lastWrite {
+			return l.replicas[idx]
+		}
+	}
+	return l.primary
+}
+
+func (l *LagAwareDB) recordWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionCtxkey).(*session); ok {
+		atomic.StoreInt64(&s.lastWrite, time.Now().UnixNano())
+	}
+}
+
+// PrepareContext implements PreparerContext.
+// Statements are prepared on the primary.
+// Executing them does not count as a write for the context's session.
+func (l *LagAwareDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return l.primary.PrepareContext(ctx, query)
+}
+
+// QueryContext implements QueryerContext.
+func (l *LagAwareDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return l.reader(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (l *LagAwareDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return l.reader(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements ExecerContext.
+// Statements run on the primary,
+// and those that succeed count as writes for the context's session, if any.
+func (l *LagAwareDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := l.primary.ExecContext(ctx, query, args...)
+	if err == nil {
+		l.recordWrite(ctx)
+	}
+	return res, err
+}
+
+// Begin begins a transaction on the primary.
+// Writes in the transaction are not tracked by sessions.
+func (l *LagAwareDB) Begin() (*sql.Tx, error) {
+	return l.primary.Begin()
+}
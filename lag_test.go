@@ -0,0 +1,57 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func newLagDB(t *testing.T, who string) *sql.DB {
+	db := testdb.NewSQLite(t, testdb.DDL(
+		"CREATE TABLE heartbeat (id INTEGER PRIMARY KEY, ts DATETIME NOT NULL)",
+		"CREATE TABLE who (name TEXT NOT NULL)",
+		"INSERT INTO who (name) VALUES ('"+who+"')",
+	))
+	if _, err := db.Exec("INSERT INTO heartbeat (id, ts) VALUES (1, $1)", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLagAwareDB(t *testing.T) {
+	l := sqlutil.NewLagAwareDB(newLagDB(t, "primary"), time.Minute, newLagDB(t, "replica"))
+	l.MeasureLag(context.Background())
+	if _, ok := l.Lag(0); !ok {
+		t.Fatal("replica lag unknown after MeasureLag")
+	}
+
+	ctx := sqlutil.NewSession(context.Background())
+	assertReader := func(want string) {
+		t.Helper()
+		var got string
+		if err := l.QueryRowContext(ctx, "SELECT name FROM who").Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("read from %s, want %s", got, want)
+		}
+	}
+
+	assertReader("replica")
+
+	// A failed write does not pin the session to the primary.
+	if _, err := l.ExecContext(ctx, "INSERT INTO nonexistent (x) VALUES (1)"); err == nil {
+		t.Fatal("got no error inserting into a nonexistent table")
+	}
+	assertReader("replica")
+
+	// A successful one does, until the replica catches up.
+	if _, err := l.ExecContext(ctx, "INSERT INTO who (name) VALUES ('x')"); err != nil {
+		t.Fatal(err)
+	}
+	assertReader("primary")
+}
@@ -3,11 +3,12 @@ package sqlutil
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // Lessor is a provider of leases.
@@ -37,8 +38,42 @@ type Lessor struct {
 	// It must have a type capable of storing a 32-byte string.
 	// The default if this is unspecified is "key".
 	Key string
+
+	// LastSeen, if set, is the name of a column in the lease-info table
+	// holding the time of the lease holder's latest heartbeat
+	// (see Lease.KeepAlive),
+	// which is distinct from the lease's expiration.
+	// The column must have a time.Time-compatible type (like DATETIME).
+	// If this is unspecified,
+	// heartbeats are not recorded.
+	LastSeen string
+
+	// StaleAfter, if positive and LastSeen is set,
+	// is how long a lease may go without a heartbeat
+	// before it is considered abandoned.
+	// Acquire then takes over an abandoned lease
+	// as if it had expired,
+	// without waiting for its expiration.
+	StaleAfter time.Duration
+
+	// Notifier, if set, is notified on LeaseChannel when a lease is released,
+	// allowing AcquireWait to retry immediately instead of waiting for its next poll.
+	Notifier Notifier
+
+	// Now tells the current time,
+	// for deciding which leases have expired.
+	// The default if this is unspecified is time.Now.
+	// Tests may supply a fake clock.
+	Now func() time.Time
+
+	// Slog, if set, receives structured log records of lease activity.
+	// The default is the package-level logger set with SetSlog.
+	Slog *slog.Logger
 }
 
+// LeaseChannel is the Notifier channel on which Lessor announces released leases.
+const LeaseChannel = "sqlutil_leases"
+
 const (
 	defaultTable = "leases"
 	defaultName  = "name"
@@ -50,6 +85,13 @@ func NewLessor(db ExecerContext) *Lessor {
 	return &Lessor{db: db}
 }
 
+func (l *Lessor) now() time.Time {
+	if l.Now == nil {
+		return time.Now()
+	}
+	return l.Now()
+}
+
 func (l *Lessor) tableName() string {
 	if l.Table == "" {
 		return defaultTable
@@ -78,35 +120,166 @@ func (l *Lessor) keyName() string {
 	return l.Key
 }
 
+// heartbeat tells whether l records heartbeats.
+func (l *Lessor) heartbeat() bool {
+	return l.LastSeen != ""
+}
+
+// EnsureTable creates the lease-info table,
+// with the Lessor's table and column names,
+// if it does not already exist.
+func (l *Lessor) EnsureTable(ctx context.Context, d Dialect) error {
+	var (
+		table = d.QuoteIdent(l.tableName())
+		name  = d.QuoteIdent(l.nameName())
+		exp   = d.QuoteIdent(l.expName())
+		key   = d.QuoteIdent(l.keyName())
+		idx   = d.QuoteIdent(l.tableName() + "_" + l.expName() + "_idx")
+	)
+
+	expType := "TIMESTAMP WITH TIME ZONE"
+	switch d {
+	case MySQL:
+		expType = "DATETIME(6)"
+	case SQLite:
+		expType = "DATETIME"
+	}
+	var lastSeen string
+	if l.heartbeat() {
+		lastSeen = fmt.Sprintf(", %s %s", d.QuoteIdent(l.LastSeen), expType)
+	}
+
+	if d == MySQL {
+		// MySQL has no CREATE INDEX IF NOT EXISTS.
+		const createQFmt = `CREATE TABLE IF NOT EXISTS %s (%s VARCHAR(255) NOT NULL PRIMARY KEY, %s DATETIME(6) NOT NULL, %s VARCHAR(64) NOT NULL%s, INDEX %s (%s))`
+		if _, err := l.db.ExecContext(ctx, fmt.Sprintf(createQFmt, table, name, exp, key, lastSeen, idx, exp)); err != nil {
+			return fmt.Errorf("creating lease table: %w", err)
+		}
+		return nil
+	}
+
+	const createQFmt = `CREATE TABLE IF NOT EXISTS %s (%s TEXT NOT NULL PRIMARY KEY, %s %s NOT NULL, %s TEXT NOT NULL%s)`
+	if _, err := l.db.ExecContext(ctx, fmt.Sprintf(createQFmt, table, name, exp, expType, key, lastSeen)); err != nil {
+		return fmt.Errorf("creating lease table: %w", err)
+	}
+	const indexQFmt = `CREATE INDEX IF NOT EXISTS %s ON %s (%s)`
+	if _, err := l.db.ExecContext(ctx, fmt.Sprintf(indexQFmt, idx, table, exp)); err != nil {
+		return fmt.Errorf("creating lease table index: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes expired leases from the lease-info table.
+// Acquire does this too,
+// but long-lived processes that acquire leases rarely may wish to call RunExpirer instead.
+func (l *Lessor) DeleteExpired(ctx context.Context) error {
+	_, err := deleteExpired(ctx, l.db, l.tableName(), l.expName(), l.now())
+	return wrapf(err, "deleting stale leases")
+}
+
+// RunExpirer deletes expired leases every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func (l *Lessor) RunExpirer(ctx context.Context, interval time.Duration, onErr func(error)) {
+	runExpirer(ctx, l.db, l.tableName(), l.expName(), interval, onErr)
+}
+
 // Acquire attempts to acquire the lease named `name` from a Lessor.
 // This will fail (without blocking) if that lease is already held and unexpired.
+// The error then wraps ErrLeaseHeld
+// (if the database reports the conflict as a uniqueness violation, as the common drivers do).
 // If the lease is acquired,
 // it expires at `exp`.
 // It is also assigned a unique Key that is required in Renew and Release operations.
 func (l *Lessor) Acquire(ctx context.Context, name string, exp time.Time) (*Lease, error) {
-	const delQFmt = `DELETE FROM %s WHERE %s < $1`
-	delQ := fmt.Sprintf(delQFmt, l.tableName(), l.expName())
-	_, err := l.db.ExecContext(ctx, delQ, time.Now())
+	_, err := deleteExpired(ctx, l.db, l.tableName(), l.expName(), l.now())
 	if err != nil {
-		return nil, errors.Wrap(err, "deleting stale leases")
+		return nil, fmt.Errorf("deleting stale leases: %w", err)
+	}
+	if l.heartbeat() && l.StaleAfter > 0 {
+		_, err = deleteExpired(ctx, l.db, l.tableName(), l.LastSeen, l.now().Add(-l.StaleAfter))
+		if err != nil {
+			return nil, fmt.Errorf("deleting abandoned leases: %w", err)
+		}
 	}
 
-	var key [16]byte
-	_, err = rand.Reader.Read(key[:])
+	keyHex, err := newKey()
+	if err != nil {
+		return nil, fmt.Errorf("computing key: %w", err)
+	}
+
+	if l.heartbeat() {
+		const insQFmt = `INSERT INTO %s (%s, %s, %s, %s) VALUES ($1, $2, $3, $4)`
+		insQ := fmt.Sprintf(insQFmt, l.tableName(), l.nameName(), l.expName(), l.keyName(), l.LastSeen)
+		_, err = l.db.ExecContext(ctx, insQ, name, exp, keyHex, l.now())
+	} else {
+		const insQFmt = `INSERT INTO %s (%s, %s, %s) VALUES ($1, $2, $3)`
+		insQ := fmt.Sprintf(insQFmt, l.tableName(), l.nameName(), l.expName(), l.keyName())
+		_, err = l.db.ExecContext(ctx, insQ, name, exp, keyHex)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "computing key")
+		if isUniqueViolation(err) {
+			err = fmt.Errorf("%w: %w", ErrLeaseHeld, err)
+		}
+		slogger(l.Slog).LogAttrs(ctx, slog.LevelDebug, "lease not acquired", slog.String("lease", name), slog.String("err", err.Error()))
+		return nil, fmt.Errorf("inserting into database: %w", err)
 	}
-	keyHex := hex.EncodeToString(key[:])
+	slogger(l.Slog).LogAttrs(ctx, slog.LevelDebug, "lease acquired", slog.String("lease", name), slog.Time("exp", exp))
 
-	const insQFmt = `INSERT INTO %s (%s, %s, %s) VALUES ($1, $2, $3)`
-	insQ := fmt.Sprintf(insQFmt, l.tableName(), l.nameName(), l.expName(), l.keyName())
-	_, err = l.db.ExecContext(ctx, insQ, name, exp, keyHex)
-	return &Lease{
+	lease := &Lease{
 		Lessor: l,
 		Name:   name,
 		Exp:    exp,
 		Key:    keyHex,
-	}, errors.Wrap(err, "inserting into database")
+	}
+	debugLeaseHeld(lease, exp)
+	return lease, nil
+}
+
+var (
+	// ErrLeaseHeld is the error produced by Acquire when the lease is held by someone else.
+	ErrLeaseHeld = errors.New("lease held")
+
+	// ErrLeaseNotHeld is the error produced by Renew when the lease is expired or otherwise no longer held.
+	ErrLeaseNotHeld = errors.New("lease not held")
+)
+
+// newKey produces a random 32-character hex string.
+func newKey() (string, error) {
+	var key [16]byte
+	_, err := rand.Reader.Read(key[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key[:]), nil
+}
+
+// AcquireWait is like Acquire,
+// but if the lease is already held it retries,
+// waiting between attempts according to the retry policy p
+// (which may be nil),
+// until it succeeds,
+// the policy's attempts are exhausted,
+// or ctx is canceled.
+// Only ErrLeaseHeld is retried
+// (p's Retryable classifier is not consulted);
+// any other error from Acquire is returned at once.
+// If the Lessor has a Notifier,
+// AcquireWait also retries whenever a lease is released.
+// Each attempt requests a lease expiring dur after the time of the attempt.
+func (l *Lessor) AcquireWait(ctx context.Context, name string, dur time.Duration, p *RetryPolicy) (*Lease, error) {
+	for n := 1; ; n++ {
+		lease, err := l.Acquire(ctx, name, l.now().Add(dur))
+		if err == nil {
+			return lease, nil
+		}
+		if !errors.Is(err, ErrLeaseHeld) || !p.more(n) {
+			return nil, err
+		}
+		if waitFor(ctx, l.Notifier, LeaseChannel, p.Delay(n)) != nil {
+			return nil, fmt.Errorf("%s: %w", err, ctx.Err())
+		}
+	}
 }
 
 // Lease is the type of a lease acquired from a Lessor.
@@ -132,16 +305,54 @@ func (l *Lease) Renew(ctx context.Context, exp time.Time) error {
 		l.Lessor.keyName(),
 		l.Lessor.expName(),
 	)
-	res, err := l.Lessor.db.ExecContext(ctx, updQ, exp, l.Name, l.Key, time.Now())
+	res, err := l.Lessor.db.ExecContext(ctx, updQ, exp, l.Name, l.Key, l.Lessor.now())
+	if err != nil {
+		return fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff == 0 {
+		slogger(l.Lessor.Slog).LogAttrs(ctx, slog.LevelWarn, "lease not renewed", slog.String("lease", l.Name))
+		debugLeaseGone(l)
+		return ErrLeaseNotHeld
+	}
+	slogger(l.Lessor.Slog).LogAttrs(ctx, slog.LevelDebug, "lease renewed", slog.String("lease", l.Name), slog.Time("exp", exp))
+	debugLeaseHeld(l, exp)
+	return nil
+}
+
+// KeepAlive records a heartbeat for the lease,
+// updating its LastSeen column
+// (which must be configured in the Lessor)
+// without changing its expiration.
+// It fails with ErrLeaseNotHeld if the lease is expired or otherwise not held.
+func (l *Lease) KeepAlive(ctx context.Context) error {
+	if !l.Lessor.heartbeat() {
+		return errors.New("lessor has no LastSeen column")
+	}
+	const updQFmt = `UPDATE %s SET %s = $1 WHERE %s = $2 AND %s = $3 AND %s > $4`
+	updQ := fmt.Sprintf(
+		updQFmt,
+		l.Lessor.tableName(),
+		l.Lessor.LastSeen,
+		l.Lessor.nameName(),
+		l.Lessor.keyName(),
+		l.Lessor.expName(),
+	)
+	now := l.Lessor.now()
+	res, err := l.Lessor.db.ExecContext(ctx, updQ, now, l.Name, l.Key, now)
 	if err != nil {
-		return errors.Wrap(err, "updating database")
+		return fmt.Errorf("updating database: %w", err)
 	}
 	aff, err := res.RowsAffected()
 	if err != nil {
-		return errors.Wrap(err, "counting affected rows")
+		return fmt.Errorf("counting affected rows: %w", err)
 	}
 	if aff == 0 {
-		return errors.New("could not renew")
+		debugLeaseGone(l)
+		return ErrLeaseNotHeld
 	}
 	return nil
 }
@@ -156,7 +367,80 @@ func (l *Lease) Release(ctx context.Context) error {
 		l.Lessor.keyName(),
 	)
 	_, err := l.Lessor.db.ExecContext(ctx, delQ, l.Name, l.Key)
-	return errors.Wrap(err, "deleting from database")
+	if err != nil {
+		return fmt.Errorf("deleting from database: %w", err)
+	}
+	slogger(l.Lessor.Slog).LogAttrs(ctx, slog.LevelDebug, "lease released", slog.String("lease", l.Name))
+	debugLeaseGone(l)
+	if l.Lessor.Notifier != nil {
+		return wrapf(l.Lessor.Notifier.Notify(ctx, LeaseChannel, l.Name), "notifying")
+	}
+	return nil
+}
+
+// LeaseInfo describes a lease listed by Lessor.List.
+// It omits the lease's key.
+type LeaseInfo struct {
+	Name string    `json:"name"`
+	Exp  time.Time `json:"exp"`
+
+	// LastSeen is the time of the holder's latest heartbeat
+	// (see Lease.KeepAlive).
+	// It is the zero time if the Lessor has no LastSeen column.
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+// List returns the unexpired leases in the lease-info table,
+// in order of name.
+// The Lessor's database handle must be a QueryerContext.
+func (l *Lessor) List(ctx context.Context) ([]LeaseInfo, error) {
+	db, ok := l.db.(QueryerContext)
+	if !ok {
+		return nil, fmt.Errorf("listing leases requires a QueryerContext, not %T", l.db)
+	}
+	var result []LeaseInfo
+	if l.heartbeat() {
+		const selQFmt = `SELECT %[2]s, %[3]s, %[4]s FROM %[1]s WHERE %[3]s >= $1 ORDER BY %[2]s`
+		selQ := fmt.Sprintf(selQFmt, l.tableName(), l.nameName(), l.expName(), l.LastSeen)
+		err := ForQueryRows(ctx, db, selQ, l.now(), func(name string, exp time.Time, lastSeen sql.NullTime) {
+			result = append(result, LeaseInfo{Name: name, Exp: exp, LastSeen: lastSeen.Time})
+		})
+		return result, wrapf(err, "querying leases")
+	}
+	const selQFmt = `SELECT %[2]s, %[3]s FROM %[1]s WHERE %[3]s >= $1 ORDER BY %[2]s`
+	selQ := fmt.Sprintf(selQFmt, l.tableName(), l.nameName(), l.expName())
+	err := ForQueryRows(ctx, db, selQ, l.now(), func(name string, exp time.Time) {
+		result = append(result, LeaseInfo{Name: name, Exp: exp})
+	})
+	return result, wrapf(err, "querying leases")
+}
+
+// Revoke forcibly releases the lease with the given name,
+// whoever holds it.
+// The holder's subsequent Renew fails with ErrLeaseNotHeld.
+// (But note that a holder relying on Lease.Context is not interrupted.)
+// If no such lease is held,
+// the error is ErrLeaseNotHeld.
+func (l *Lessor) Revoke(ctx context.Context, name string) error {
+	const delQFmt = `DELETE FROM %s WHERE %s = $1`
+	delQ := fmt.Sprintf(delQFmt, l.tableName(), l.nameName())
+	res, err := l.db.ExecContext(ctx, delQ, name)
+	if err != nil {
+		return fmt.Errorf("deleting from database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff == 0 {
+		return ErrLeaseNotHeld
+	}
+	slogger(l.Slog).LogAttrs(ctx, slog.LevelWarn, "lease revoked", slog.String("lease", name))
+	debugLeaseGone(&Lease{Lessor: l, Name: name})
+	if l.Notifier != nil {
+		return wrapf(l.Notifier.Notify(ctx, LeaseChannel, name), "notifying")
+	}
+	return nil
 }
 
 // Context produces a context object with a deadline equal to the lease's expiration time.
@@ -0,0 +1,136 @@
+package sqlutil_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+// newLessor produces a Lessor on a new SQLite database,
+// with a fake clock.
+func newLessor(t *testing.T) (*sqlutil.Lessor, *testdb.FakeClock) {
+	clock := testdb.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := sqlutil.NewLessor(testdb.NewSQLite(t, testdb.LessorTable(sqlutil.NewLessor(nil))))
+	l.Now = clock.Now
+	return l, clock
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	l, clock := newLessor(t)
+
+	lease, err := l.Acquire(ctx, "x", clock.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.Acquire(ctx, "x", clock.Now().Add(time.Minute))
+	if !errors.Is(err, sqlutil.ErrLeaseHeld) {
+		t.Errorf("got error %v acquiring a held lease, want %v", err, sqlutil.ErrLeaseHeld)
+	}
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		t.Errorf("got error %v acquiring a held lease, want one wrapping the driver error", err)
+	}
+	if err := lease.Renew(ctx, clock.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lease, err = l.Acquire(ctx, "x", clock.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("acquiring a released lease: %s", err)
+	}
+
+	// Let the lease expire.
+	clock.Advance(2 * time.Minute)
+	if err := lease.Renew(ctx, clock.Now().Add(time.Minute)); !errors.Is(err, sqlutil.ErrLeaseNotHeld) {
+		t.Errorf("got error %v renewing an expired lease, want %v", err, sqlutil.ErrLeaseNotHeld)
+	}
+	if _, err := l.Acquire(ctx, "x", clock.Now().Add(time.Minute)); err != nil {
+		t.Errorf("acquiring an expired lease: %s", err)
+	}
+}
+
+func TestLeaseHeartbeat(t *testing.T) {
+	ctx := context.Background()
+
+	clock := testdb.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := &sqlutil.Lessor{LastSeen: "last_seen"}
+	l := sqlutil.NewLessor(testdb.NewSQLite(t, testdb.LessorTable(cfg)))
+	l.Now, l.LastSeen, l.StaleAfter = clock.Now, "last_seen", 10*time.Second
+
+	lease, err := l.Acquire(ctx, "x", clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(5 * time.Second)
+	if err := lease.KeepAlive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(5 * time.Second)
+	if _, err := l.Acquire(ctx, "x", clock.Now().Add(time.Hour)); !errors.Is(err, sqlutil.ErrLeaseHeld) {
+		t.Errorf("got error %v acquiring a live lease, want %v", err, sqlutil.ErrLeaseHeld)
+	}
+
+	// Stop heartbeating.
+	clock.Advance(time.Minute)
+	if _, err := l.Acquire(ctx, "x", clock.Now().Add(time.Hour)); err != nil {
+		t.Errorf("acquiring an abandoned lease: %s", err)
+	}
+	if err := lease.KeepAlive(ctx); !errors.Is(err, sqlutil.ErrLeaseNotHeld) {
+		t.Errorf("got error %v from KeepAlive on a lost lease, want %v", err, sqlutil.ErrLeaseNotHeld)
+	}
+}
+
+func TestAcquireWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("held", func(t *testing.T) {
+		l, clock := newLessor(t)
+		if _, err := l.Acquire(ctx, "x", clock.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		p := &sqlutil.RetryPolicy{MaxAttempts: 3, Base: time.Millisecond, Jitter: -1}
+		if _, err := l.AcquireWait(ctx, "x", time.Minute, p); !errors.Is(err, sqlutil.ErrLeaseHeld) {
+			t.Errorf("got error %v, want %v", err, sqlutil.ErrLeaseHeld)
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		// No lease table.
+		l := sqlutil.NewLessor(testdb.NewSQLite(t))
+		_, err := l.AcquireWait(ctx, "x", time.Minute, nil)
+		if err == nil || errors.Is(err, sqlutil.ErrLeaseHeld) || ctx.Err() != nil {
+			t.Errorf("got error %v (context error %v), want an immediate failure", err, ctx.Err())
+		}
+	})
+}
+
+func TestLeaseToken(t *testing.T) {
+	l := sqlutil.NewLessor(nil)
+	secret := []byte("secret")
+
+	for _, key := range []string{"abc", strings.Repeat("k", 300)} {
+		lease := &sqlutil.Lease{Lessor: l, Name: "x", Exp: time.Unix(1700000000, 0), Key: key}
+		got, err := l.ParseToken(secret, lease.Token(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != lease.Name || got.Key != lease.Key || !got.Exp.Equal(lease.Exp) {
+			t.Errorf("got lease %+v from token, want %+v", got, lease)
+		}
+	}
+
+	token := (&sqlutil.Lease{Lessor: l, Name: "x", Key: "abc"}).Token(secret)
+	if _, err := l.ParseToken([]byte("wrong"), token); !errors.Is(err, sqlutil.ErrInvalidToken) {
+		t.Errorf("got error %v with the wrong secret, want %v", err, sqlutil.ErrInvalidToken)
+	}
+}
@@ -0,0 +1,94 @@
+package sqlutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is the error produced by ParseToken when a token is malformed
+// or its signature does not match.
+var ErrInvalidToken = errors.New("invalid lease token")
+
+// Token produces a compact string encoding l's Name, Exp, and Key,
+// signed with an HMAC using secret,
+// so that the lease can be handed to another process
+// (e.g. in an HTTP header or a queue message)
+// which can verify it with ParseToken.
+// The signature also covers the Lessor's table name,
+// so a token is valid only for a Lessor using the same table.
+//
+// The token is signed, not encrypted:
+// its contents,
+// including the lease key,
+// are readable by anyone who sees it.
+func (l *Lease) Token(secret []byte) string {
+	var payload bytes.Buffer
+	binary.Write(&payload, binary.BigEndian, l.Exp.UnixNano())
+	payload.Write(binary.AppendUvarint(nil, uint64(len(l.Key))))
+	payload.WriteString(l.Key)
+	payload.WriteString(l.Name)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload.Bytes()) + "." + enc.EncodeToString(l.Lessor.tokenMAC(secret, payload.Bytes()))
+}
+
+// ParseToken verifies a token produced by Lease.Token with the same secret
+// and returns the lease it encodes,
+// with l as its Lessor.
+// If the token is malformed or its signature does not match,
+// the error is ErrInvalidToken.
+//
+// ParseToken does not check that the lease is still held;
+// Renew and Release fail if it is not.
+func (l *Lessor) ParseToken(secret []byte, token string) (*Lease, error) {
+	enc := base64.RawURLEncoding
+
+	payloadStr, macStr, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	payload, err := enc.DecodeString(payloadStr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	mac, err := enc.DecodeString(macStr)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(mac, l.tokenMAC(secret, payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	if len(payload) < 9 {
+		return nil, ErrInvalidToken
+	}
+	exp := int64(binary.BigEndian.Uint64(payload))
+	keyLen, n := binary.Uvarint(payload[8:])
+	if n <= 0 {
+		return nil, ErrInvalidToken
+	}
+	rest := payload[8+n:]
+	if uint64(len(rest)) < keyLen {
+		return nil, ErrInvalidToken
+	}
+	return &Lease{
+		Lessor: l,
+		Name:   string(rest[keyLen:]),
+		Exp:    time.Unix(0, exp),
+		Key:    string(rest[:keyLen]),
+	}, nil
+}
+
+func (l *Lessor) tokenMAC(secret, payload []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(l.tableName()))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return h.Sum(nil)
+}
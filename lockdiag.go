@@ -0,0 +1,251 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockWaitError is the error produced by LockDiagnosticsDB
+// for a statement that failed after waiting longer than the lock-wait threshold,
+// or that failed with a deadlock.
+// It carries the blocking information captured while the statement was waiting
+// (or just after the deadlock).
+type LockWaitError struct {
+	Err error
+
+	// Waited is how long the statement ran before failing.
+	Waited time.Duration
+
+	// Info describes the blocking sessions or the latest deadlock,
+	// in a dialect-specific format
+	// (see CaptureLockInfo).
+	Info string
+}
+
+func (e *LockWaitError) Error() string {
+	return fmt.Sprintf("%s (after %s; lock info: %s)", e.Err, e.Waited, e.Info)
+}
+
+// Unwrap returns the underlying error.
+func (e *LockWaitError) Unwrap() error {
+	return e.Err
+}
+
+// LockDiagnosticsDB is a DB that helps debug lock contention.
+// When a statement runs longer than Threshold,
+// it captures blocking information using a separate diagnostic handle
+// (since the statement's own connection is busy).
+// If the statement then fails,
+// or if any statement fails with a deadlock,
+// the error is a *LockWaitError carrying that information.
+type LockDiagnosticsDB struct {
+	DB
+
+	// Diag is used to query lock information.
+	// It should be a separate pool
+	// (such as a *sql.DB)
+	// able to supply a connection while DB's are blocked.
+	Diag QueryerContext
+
+	Dialect Dialect
+
+	// Threshold is how long a statement may run before blocking information is captured.
+	// The default if this is unspecified is 1 second.
+	Threshold time.Duration
+}
+
+const defaultLockWaitThreshold = time.Second
+
+func (l *LockDiagnosticsDB) threshold() time.Duration {
+	if l.Threshold <= 0 {
+		return defaultLockWaitThreshold
+	}
+	return l.Threshold
+}
+
+// NewLockDiagnosticsDB produces a new LockDiagnosticsDB.
+func NewLockDiagnosticsDB(db DB, diag QueryerContext, d Dialect, threshold time.Duration) *LockDiagnosticsDB {
+	return &LockDiagnosticsDB{DB: db, Diag: diag, Dialect: d, Threshold: threshold}
+}
+
+// watch runs op,
+// capturing lock information if it runs longer than the threshold,
+// and decorating its error if appropriate.
+func (l *LockDiagnosticsDB) watch(ctx context.Context, op func() error) error {
+	var (
+		start  = time.Now()
+		infoCh = make(chan string, 1)
+		done   = make(chan struct{})
+	)
+	go func() {
+		timer := time.NewTimer(l.threshold())
+		defer timer.Stop()
+		select {
+		case <-done:
+			infoCh <- ""
+		case <-timer.C:
+			infoCh <- l.capture(ctx)
+		}
+	}()
+
+	err := op()
+	close(done)
+	if err == nil {
+		return nil
+	}
+	info := <-infoCh
+	if info == "" && isDeadlock(err) {
+		info = l.capture(ctx)
+	}
+	if info == "" {
+		return err
+	}
+	return &LockWaitError{Err: err, Waited: time.Since(start), Info: info}
+}
+
+func (l *LockDiagnosticsDB) capture(ctx context.Context) string {
+	// The caller's context may be the reason for the failure;
+	// don't let it prevent the capture.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := CaptureLockInfo(ctx, l.Diag, l.Dialect)
+	if err != nil {
+		return "capturing lock info: " + err.Error()
+	}
+	return info
+}
+
+func isDeadlock(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "40P01" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "deadlock")
+}
+
+// ExecContext implements ExecerContext.
+func (l *LockDiagnosticsDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := l.watch(ctx, func() (err error) {
+		res, err = l.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// QueryContext implements QueryerContext.
+// Only the wait for the query to start producing rows is watched.
+func (l *LockDiagnosticsDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := l.watch(ctx, func() (err error) {
+		rows, err = l.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext implements QueryerContext.
+// If the query's error is decorated with lock information,
+// the Row's Scan method returns the *LockWaitError.
+func (l *LockDiagnosticsDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+	err := l.watch(ctx, func() error {
+		row = l.DB.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	var lwErr *LockWaitError
+	if errors.As(err, &lwErr) {
+		return errRow(err)
+	}
+	return row
+}
+
+// PrepareContext implements PreparerContext.
+func (l *LockDiagnosticsDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	var stmt *sql.Stmt
+	err := l.watch(ctx, func() (err error) {
+		stmt, err = l.DB.PrepareContext(ctx, query)
+		return err
+	})
+	return stmt, err
+}
+
+// CaptureLockInfo describes the current lock contention in db.
+// For Postgres,
+// it lists each blocked session with the sessions blocking it,
+// from pg_stat_activity and pg_blocking_pids.
+// For MySQL,
+// it returns the LATEST DETECTED DEADLOCK and TRANSACTIONS sections of SHOW ENGINE INNODB STATUS.
+// SQLite has no such information.
+func CaptureLockInfo(ctx context.Context, db QueryerContext, d Dialect) (string, error) {
+	switch d {
+	case Postgres:
+		const q = `SELECT blocked.pid, blocked.query, blocking.pid, blocking.state, COALESCE(blocking.query, ''),` +
+			` COALESCE(EXTRACT(EPOCH FROM now() - blocking.xact_start), 0)` +
+			` FROM pg_stat_activity blocked` +
+			` JOIN LATERAL unnest(pg_blocking_pids(blocked.pid)) AS b(pid) ON true` +
+			` JOIN pg_stat_activity blocking ON blocking.pid = b.pid` +
+			` ORDER BY blocked.pid, blocking.pid`
+		var lines []string
+		err := ForQueryRows(ctx, db, q, func(blockedPID int64, blockedQuery string, blockingPID int64, state sql.NullString, blockingQuery string, xactSecs float64) {
+			lines = append(lines, fmt.Sprintf("pid %d (%q) blocked by pid %d [%s, xact %.1fs] (%q)", blockedPID, blockedQuery, blockingPID, state.String, xactSecs, blockingQuery))
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(lines) == 0 {
+			return "no blocked sessions", nil
+		}
+		return strings.Join(lines, "\n"), nil
+
+	case MySQL:
+		var typ, name, status string
+		if err := QueryRowContext(ctx, db, `SHOW ENGINE INNODB STATUS`).Scan(&typ, &name, &status); err != nil {
+			return "", err
+		}
+		sections := innodbSections(status)
+		var parts []string
+		for _, h := range []string{"LATEST DETECTED DEADLOCK", "TRANSACTIONS"} {
+			if s, ok := sections[h]; ok {
+				parts = append(parts, h+":\n"+s)
+			}
+		}
+		return strings.Join(parts, "\n"), nil
+	}
+	return "", fmt.Errorf("lock info not available for %s", d)
+}
+
+// innodbSections splits the output of SHOW ENGINE INNODB STATUS into sections by heading.
+// Headings are lines set off above and below by lines of dashes.
+func innodbSections(status string) map[string]string {
+	var (
+		lines    = strings.Split(status, "\n")
+		sections = make(map[string]string)
+		heading  string
+		body     []string
+	)
+	isDashes := func(s string) bool {
+		s = strings.TrimSpace(s)
+		return len(s) > 2 && strings.Trim(s, "-") == ""
+	}
+	for i := 0; i < len(lines); i++ {
+		if i+2 < len(lines) && isDashes(lines[i]) && isDashes(lines[i+2]) && !isDashes(lines[i+1]) {
+			if heading != "" {
+				sections[heading] = strings.TrimSpace(strings.Join(body, "\n"))
+			}
+			heading, body = strings.TrimSpace(lines[i+1]), nil
+			i += 2
+			continue
+		}
+		body = append(body, lines[i])
+	}
+	if heading != "" {
+		sections[heading] = strings.TrimSpace(strings.Join(body, "\n"))
+	}
+	return sections
+}
@@ -0,0 +1,63 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+// countingDiag is a diagnostic handle that counts its queries.
+type countingDiag struct {
+	sqlutil.QueryerContext
+	n atomic.Int32
+}
+
+func (c *countingDiag) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.n.Add(1)
+	return c.QueryerContext.QueryContext(ctx, query, args...)
+}
+
+func (c *countingDiag) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c.n.Add(1)
+	return c.QueryerContext.QueryRowContext(ctx, query, args...)
+}
+
+func TestLockDiagnosticsDB(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewSQLite(t, testdb.DDL("CREATE TABLE t (x INTEGER)"))
+	diag := &countingDiag{QueryerContext: db}
+
+	// With the default threshold,
+	// quick statements capture nothing.
+	l := sqlutil.NewLockDiagnosticsDB(db, diag, sqlutil.Postgres, 0)
+	var n int
+	if err := l.QueryRowContext(ctx, "SELECT COUNT(*) FROM t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ExecContext(ctx, "INSERT INTO t (x) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := diag.n.Load(); got != 0 {
+		t.Errorf("got %d diagnostic queries for quick statements, want 0", got)
+	}
+
+	// An error mentioning a deadlock captures lock info,
+	// including for QueryRowContext and PrepareContext.
+	var lwErr *sqlutil.LockWaitError
+	if err := l.QueryRowContext(ctx, "SELECT * FROM deadlock").Scan(&n); !errors.As(err, &lwErr) {
+		t.Errorf("got error %v from QueryRowContext, want a *LockWaitError", err)
+	}
+	if _, err := l.PrepareContext(ctx, "SELECT * FROM deadlock"); !errors.As(err, &lwErr) {
+		t.Errorf("got error %v from PrepareContext, want a *LockWaitError", err)
+	}
+	if got := diag.n.Load(); got != 2 {
+		t.Errorf("got %d diagnostic queries, want 2", got)
+	}
+}
@@ -0,0 +1,78 @@
+package sqlutil_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestArgColumns(t *testing.T) {
+	cases := []struct {
+		query string
+		want  map[int]string
+	}{{
+		query: "SELECT * FROM users WHERE name = $1 AND u.password = $2",
+		want:  map[int]string{1: "name", 2: "password"},
+	}, {
+		query: "SELECT * FROM users WHERE name = ? AND note <> '?' AND password = ?",
+		want:  map[int]string{1: "name", 2: "password"},
+	}, {
+		query: "INSERT INTO users (name, password) VALUES (?, ?)",
+		want:  map[int]string{1: "name", 2: "password"},
+	}, {
+		query: `SELECT data ? 'k' FROM t WHERE password = $1`,
+		want:  map[int]string{1: "password"},
+	}}
+	for _, tc := range cases {
+		got := sqlutil.ArgColumns(tc.query)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("ArgColumns(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+// countingRedactor counts its calls.
+type countingRedactor struct {
+	p     *sqlutil.RedactPolicy
+	calls int
+}
+
+func (r *countingRedactor) RedactArg(query string, n int, arg interface{}) interface{} {
+	r.calls++
+	return r.p.RedactArg(query, n, arg)
+}
+
+func TestLoggingDBRedact(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewSQLite(t, testdb.DDL("CREATE TABLE users (name TEXT, password TEXT)"))
+
+	var buf bytes.Buffer
+	r := &countingRedactor{p: &sqlutil.RedactPolicy{Columns: []string{"password"}}}
+	l := &sqlutil.LoggingDB{
+		DB:       db,
+		Slog:     slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Redactor: r,
+	}
+	if _, err := l.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?)", "alice", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "hunter2") || !strings.Contains(out, "alice") {
+		t.Errorf("got log output %q, want alice but not her password", out)
+	}
+
+	// With debug logging disabled, no redaction is needed.
+	r.calls = 0
+	l.Slog = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if _, err := l.ExecContext(ctx, "INSERT INTO users (name, password) VALUES (?, ?)", "bob", "swordfish"); err != nil {
+		t.Fatal(err)
+	}
+	if r.calls != 0 {
+		t.Errorf("redactor called %d times for a disabled log level, want 0", r.calls)
+	}
+}
@@ -0,0 +1,233 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Maintenance performs operations commonly run by database operators:
+// vacuuming and analyzing tables,
+// reporting index bloat,
+// and finding and canceling long-running queries.
+type Maintenance struct {
+	db DB
+
+	// Dialect is the database's SQL dialect.
+	Dialect Dialect
+}
+
+// NewMaintenance produces a new Maintenance.
+func NewMaintenance(db DB, d Dialect) *Maintenance {
+	return &Maintenance{db: db, Dialect: d}
+}
+
+// Vacuum reclaims the space of dead rows in the given table,
+// or in the whole database if table is "",
+// and, if analyze is true,
+// updates the planner's statistics for it.
+// On Postgres this is VACUUM [ANALYZE].
+// On MySQL it is OPTIMIZE TABLE
+// (followed by ANALYZE TABLE),
+// which requires a table.
+// On SQLite it is VACUUM
+// (followed by ANALYZE),
+// which applies only to the whole database.
+//
+// Vacuuming cannot run inside a transaction,
+// so db should not be a *sql.Tx.
+func (m *Maintenance) Vacuum(ctx context.Context, table string, analyze bool) error {
+	var q string
+	switch m.Dialect {
+	case Postgres:
+		q = "VACUUM"
+		if analyze {
+			q += " ANALYZE"
+		}
+		if table != "" {
+			q += " " + m.Dialect.QuoteIdent(table)
+		}
+		analyze = false
+
+	case MySQL:
+		if table == "" {
+			return fmt.Errorf("vacuuming requires a table for %s", m.Dialect)
+		}
+		q = "OPTIMIZE TABLE " + m.Dialect.QuoteIdent(table)
+
+	case SQLite:
+		if table != "" {
+			return fmt.Errorf("vacuuming a single table is not available for %s", m.Dialect)
+		}
+		q = "VACUUM"
+
+	default:
+		return fmt.Errorf("unknown dialect %d", m.Dialect)
+	}
+	if err := m.exec(ctx, q); err != nil {
+		return fmt.Errorf("vacuuming: %w", err)
+	}
+	if analyze {
+		return m.Analyze(ctx, table)
+	}
+	return nil
+}
+
+// Analyze updates the planner's statistics for the given table,
+// or for the whole database if table is ""
+// (which is not available for MySQL).
+func (m *Maintenance) Analyze(ctx context.Context, table string) error {
+	var q string
+	switch m.Dialect {
+	case Postgres, SQLite:
+		q = "ANALYZE"
+		if table != "" {
+			q += " " + m.Dialect.QuoteIdent(table)
+		}
+
+	case MySQL:
+		if table == "" {
+			return fmt.Errorf("analyzing requires a table for %s", m.Dialect)
+		}
+		q = "ANALYZE TABLE " + m.Dialect.QuoteIdent(table)
+
+	default:
+		return fmt.Errorf("unknown dialect %d", m.Dialect)
+	}
+	return wrapf(m.exec(ctx, q), "analyzing")
+}
+
+// exec executes q,
+// discarding any rows it produces
+// (as MySQL's OPTIMIZE TABLE and ANALYZE TABLE do).
+func (m *Maintenance) exec(ctx context.Context, q string) error {
+	if m.Dialect != MySQL {
+		_, err := m.db.ExecContext(ctx, q)
+		return err
+	}
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// IndexBloat describes an index in a report from Maintenance.IndexBloat.
+type IndexBloat struct {
+	Table, Index string
+
+	// Size is the index's size in bytes.
+	Size int64
+
+	// LeafDensity is the average fullness of the index's leaf pages,
+	// as a percentage.
+	LeafDensity float64
+
+	// Wasted is the estimated number of bytes that rebuilding the index would reclaim,
+	// relative to the default B-tree fill factor of 90%.
+	Wasted int64
+}
+
+// IndexBloat reports the size and estimated bloat of each B-tree index in the current schema,
+// largest first.
+// It is available only for Postgres,
+// and requires the pgstattuple extension
+// (CREATE EXTENSION pgstattuple).
+func (m *Maintenance) IndexBloat(ctx context.Context) ([]IndexBloat, error) {
+	if m.Dialect != Postgres {
+		return nil, fmt.Errorf("index bloat not available for %s", m.Dialect)
+	}
+	const q = `SELECT t.relname, i.relname, pg_relation_size(i.oid), (pgstatindex(i.oid::regclass)).avg_leaf_density` +
+		` FROM pg_index x` +
+		` JOIN pg_class i ON i.oid = x.indexrelid` +
+		` JOIN pg_class t ON t.oid = x.indrelid` +
+		` JOIN pg_namespace n ON n.oid = t.relnamespace` +
+		` JOIN pg_am a ON a.oid = i.relam` +
+		` WHERE n.nspname = current_schema() AND a.amname = 'btree'` +
+		` ORDER BY 3 DESC`
+
+	const fillFactor = 90
+
+	var result []IndexBloat
+	err := ForQueryRows(ctx, m.db, q, func(table, index string, size int64, density float64) {
+		b := IndexBloat{Table: table, Index: index, Size: size, LeafDensity: density}
+		if !math.IsNaN(density) && density < fillFactor {
+			b.Wasted = int64(float64(size) * (1 - density/fillFactor))
+		}
+		result = append(result, b)
+	})
+	return result, wrapf(err, "querying index statistics")
+}
+
+// RunningQuery describes a query in a report from Maintenance.LongRunning.
+type RunningQuery struct {
+	// ID identifies the session running the query,
+	// for use with Maintenance.Cancel.
+	// It is the backend PID in Postgres
+	// and the connection ID in MySQL.
+	ID int64
+
+	User     string
+	State    string
+	Query    string
+	Duration time.Duration
+}
+
+// LongRunning lists the queries (other than its own) that have been running for at least min,
+// longest first.
+// It is not available for SQLite.
+func (m *Maintenance) LongRunning(ctx context.Context, min time.Duration) ([]RunningQuery, error) {
+	var q string
+	switch m.Dialect {
+	case Postgres:
+		q = `SELECT pid, COALESCE(usename, ''), COALESCE(state, ''), query, EXTRACT(EPOCH FROM now() - query_start)` +
+			` FROM pg_stat_activity` +
+			` WHERE state <> 'idle' AND pid <> pg_backend_pid() AND query_start <= now() - $1 * INTERVAL '1 second'` +
+			` ORDER BY query_start`
+	case MySQL:
+		q = `SELECT id, user, command, COALESCE(info, ''), time` +
+			` FROM information_schema.processlist` +
+			` WHERE command <> 'Sleep' AND id <> CONNECTION_ID() AND time >= ?` +
+			` ORDER BY time DESC`
+	default:
+		return nil, fmt.Errorf("running queries not available for %s", m.Dialect)
+	}
+	var result []RunningQuery
+	err := ForQueryRows(ctx, m.db, q, min.Seconds(), func(id int64, user, state, query string, secs float64) {
+		result = append(result, RunningQuery{
+			ID:       id,
+			User:     user,
+			State:    state,
+			Query:    query,
+			Duration: time.Duration(secs * float64(time.Second)),
+		})
+	})
+	return result, wrapf(err, "querying running queries")
+}
+
+// Cancel cancels the query running in the session with the given ID
+// (see RunningQuery),
+// leaving the session itself connected.
+// It is not available for SQLite.
+func (m *Maintenance) Cancel(ctx context.Context, id int64) error {
+	switch m.Dialect {
+	case Postgres:
+		var ok bool
+		if err := m.db.QueryRowContext(ctx, `SELECT pg_cancel_backend($1)`, id).Scan(&ok); err != nil {
+			return fmt.Errorf("canceling query: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("no session %d", id)
+		}
+		return nil
+
+	case MySQL:
+		_, err := m.db.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", id))
+		return wrapf(err, "canceling query")
+	}
+	return fmt.Errorf("canceling queries not available for %s", m.Dialect)
+}
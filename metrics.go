@@ -0,0 +1,69 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Metrics receives measurements from this package.
+// Implementations publish them to a metrics system
+// (see the sqlutilprom package for Prometheus).
+// Methods must be safe for concurrent use.
+type Metrics interface {
+	// ObserveQuery records a statement:
+	// its operation ("prepare", "query", "queryrow", or "exec"),
+	// its name
+	// (from QueryName, or "" if it has none),
+	// how long it took,
+	// and its error, if any.
+	ObserveQuery(op, name string, d time.Duration, err error)
+
+	// ObservePoolStats records a sample of the connection-pool statistics of the *sql.DB registered with PoolStats under dbName.
+	ObservePoolStats(dbName string, stats sql.DBStats)
+}
+
+// MetricsDB is a DB that reports each statement it sends to the underlying DB to a Metrics.
+type MetricsDB struct {
+	DB
+	Metrics Metrics
+}
+
+// NewMetricsDB produces a MetricsDB wrapping db and reporting to m.
+func NewMetricsDB(db DB, m Metrics) *MetricsDB {
+	return &MetricsDB{DB: db, Metrics: m}
+}
+
+// PrepareContext implements PreparerContext.
+func (m *MetricsDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := m.DB.PrepareContext(ctx, query)
+	m.Metrics.ObserveQuery("prepare", QueryName(ctx), time.Since(start), err)
+	return stmt, err
+}
+
+// QueryContext implements QueryerContext.
+func (m *MetricsDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	m.Metrics.ObserveQuery("query", QueryName(ctx), time.Since(start), err)
+	return rows, err
+}
+
+// QueryRowContext implements QueryerContext.
+// Since *sql.Row defers errors until Scan,
+// no error is reported.
+func (m *MetricsDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := m.DB.QueryRowContext(ctx, query, args...)
+	m.Metrics.ObserveQuery("queryrow", QueryName(ctx), time.Since(start), nil)
+	return row
+}
+
+// ExecContext implements ExecerContext.
+func (m *MetricsDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	m.Metrics.ObserveQuery("exec", QueryName(ctx), time.Since(start), err)
+	return res, err
+}
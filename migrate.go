@@ -3,7 +3,12 @@ package sqlutil
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
 )
 
 var ErrMisorderedMigrations = errors.New("misordered migrations")
@@ -63,3 +68,299 @@ func Migrate(ctx context.Context, db DB, migrations []string) error {
 
 	return nil
 }
+
+// Migration is a versioned database migration for use with a Migrator.
+// Each direction is given either as SQL (Up, Down)
+// or as a Go function (UpFunc, DownFunc),
+// which takes precedence if both are present.
+// Each runs inside its own transaction.
+type Migration struct {
+	// Version orders migrations.
+	// Versions must be unique within a Migrator.
+	Version int64
+
+	// Name is a human-readable description of the migration.
+	Name string
+
+	Up     string
+	UpFunc func(context.Context, *sql.Tx) error
+
+	// Down and DownFunc undo the migration.
+	// They are optional;
+	// a migration without them cannot be rolled back.
+	Down     string
+	DownFunc func(context.Context, *sql.Tx) error
+}
+
+func (m Migration) run(ctx context.Context, tx *sql.Tx, up bool) error {
+	q, fn := m.Up, m.UpFunc
+	if !up {
+		q, fn = m.Down, m.DownFunc
+	}
+	if fn != nil {
+		return fn(ctx, tx)
+	}
+	if q == "" {
+		if up {
+			return nil
+		}
+		return fmt.Errorf("migration %d has no down migration", m.Version)
+	}
+	_, err := tx.ExecContext(ctx, q)
+	return err
+}
+
+// Migrator applies and rolls back versioned migrations,
+// tracking the applied versions in a database table.
+//
+// The versions table must have these columns:
+//
+//	version     a 64-bit integer type (like BIGINT), uniquely indexed
+//	applied_at  a time.Time-compatible type (like DATETIME)
+type Migrator struct {
+	db DB
+
+	// Table is the name of the db table holding applied migration versions.
+	// The default if this is unspecified is "schema_migrations".
+	Table string
+
+	// Lessor, if set, is used to acquire a lease before applying or rolling back migrations,
+	// so that concurrent Migrators
+	// (e.g. in multiple replicas of a newly deployed service)
+	// cannot race to run the same migration.
+	// A Migrator that finds the lease held waits for it.
+	Lessor *Lessor
+
+	// LeaseName is the name of the lease acquired from Lessor.
+	// The default if this is unspecified is "sqlutil.migrate".
+	LeaseName string
+
+	// LeaseDuration is how long the lease lasts.
+	// Migrations must complete within this time;
+	// the context in which they run has a deadline at the lease's expiration.
+	// The default if this is unspecified is 10 minutes.
+	LeaseDuration time.Duration
+
+	// LeaseRetry governs how a Migrator waits for a lease held by another Migrator.
+	// The default if this is unspecified is to retry every second.
+	LeaseRetry *RetryPolicy
+
+	// Slog, if set, receives structured log records of migrations applied and rolled back.
+	// The default is the package-level logger set with SetSlog.
+	Slog *slog.Logger
+
+	migrations []Migration // sorted by version
+}
+
+const (
+	defaultMigrationsTable        = "schema_migrations"
+	defaultMigrationLeaseName     = "sqlutil.migrate"
+	defaultMigrationLeaseDuration = 10 * time.Minute
+)
+
+var defaultMigrationLeaseRetry = &RetryPolicy{Base: time.Second, Max: time.Second, Jitter: -1}
+
+// NewMigrator produces a new Migrator.
+func NewMigrator(db DB) *Migrator {
+	return &Migrator{db: db}
+}
+
+func (m *Migrator) tableName() string {
+	if m.Table == "" {
+		return defaultMigrationsTable
+	}
+	return m.Table
+}
+
+// EnsureTable creates m's versions table,
+// if it does not already exist,
+// with column types suited to the given dialect.
+func (m *Migrator) EnsureTable(ctx context.Context, d Dialect) error {
+	appliedType := "TIMESTAMP WITH TIME ZONE"
+	switch d {
+	case MySQL:
+		appliedType = "DATETIME(6)"
+	case SQLite:
+		appliedType = "DATETIME"
+	}
+	const createQFmt = `CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, applied_at %s NOT NULL)`
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(createQFmt, d.QuoteIdent(m.tableName()), appliedType))
+	return wrapf(err, "creating versions table")
+}
+
+// lock acquires m's lease,
+// if m has a Lessor,
+// and returns a context with a deadline at the lease's expiration,
+// plus a function that releases the lease.
+func (m *Migrator) lock(ctx context.Context) (context.Context, func(), error) {
+	if m.Lessor == nil {
+		return ctx, func() {}, nil
+	}
+	name := m.LeaseName
+	if name == "" {
+		name = defaultMigrationLeaseName
+	}
+	dur := m.LeaseDuration
+	if dur <= 0 {
+		dur = defaultMigrationLeaseDuration
+	}
+	retry := m.LeaseRetry
+	if retry == nil {
+		retry = defaultMigrationLeaseRetry
+	}
+	lease, err := m.Lessor.AcquireWait(ctx, name, dur, retry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquiring migration lease: %w", err)
+	}
+	leaseCtx, cancel := lease.Context(ctx)
+	return leaseCtx, func() {
+		cancel()
+		lease.Release(ctx)
+	}, nil
+}
+
+// Register adds migrations to m.
+// It is an error to register a version more than once.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, mig := range migrations {
+		i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= mig.Version })
+		if i < len(m.migrations) && m.migrations[i].Version == mig.Version {
+			return fmt.Errorf("duplicate migration version %d", mig.Version)
+		}
+		m.migrations = append(m.migrations, Migration{})
+		copy(m.migrations[i+1:], m.migrations[i:])
+		m.migrations[i] = mig
+	}
+	return nil
+}
+
+// Applied returns the versions of the migrations that have been applied,
+// in ascending order.
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+	const selQFmt = `SELECT version FROM %s ORDER BY version`
+	selQ := fmt.Sprintf(selQFmt, m.tableName())
+	var versions []int64
+	err := ForQueryRows(ctx, m.db, selQ, func(v int64) {
+		versions = append(versions, v)
+	})
+	return versions, wrapf(err, "querying applied versions")
+}
+
+// Pending returns the registered migrations that have not been applied,
+// in ascending version order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isApplied := make(map[int64]bool, len(applied))
+	for _, v := range applied {
+		isApplied[v] = true
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if !isApplied[mig.Version] {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations in ascending version order,
+// each in its own transaction.
+// It stops at the first failure.
+// If m has a Lessor,
+// Up holds m's lease while it runs.
+func (m *Migrator) Up(ctx context.Context) error {
+	ctx, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	const insQFmt = `INSERT INTO %s (version, applied_at) VALUES ($1, $2)`
+	insQ := fmt.Sprintf(insQFmt, m.tableName())
+
+	for _, mig := range pending {
+		start := time.Now()
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if err := mig.run(ctx, tx, true); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, insQ, mig.Version, time.Now())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		m.logMigration(ctx, "migration applied", mig, start)
+	}
+	return nil
+}
+
+// Down rolls back the n most recently applied migrations
+// (by version),
+// each in its own transaction.
+// It stops at the first failure.
+// Every applied migration rolled back must be registered with m.
+// If m has a Lessor,
+// Down holds m's lease while it runs.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	ctx, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	const delQFmt = `DELETE FROM %s WHERE version = $1`
+	delQ := fmt.Sprintf(delQFmt, m.tableName())
+
+	for i := len(applied) - 1; i >= 0 && n > 0; i, n = i-1, n-1 {
+		v := applied[i]
+		j := sort.Search(len(m.migrations), func(j int) bool { return m.migrations[j].Version >= v })
+		if j == len(m.migrations) || m.migrations[j].Version != v {
+			return fmt.Errorf("applied migration %d is not registered", v)
+		}
+		mig := m.migrations[j]
+		start := time.Now()
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if err := mig.run(ctx, tx, false); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, delQ, mig.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("rolling back migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		m.logMigration(ctx, "migration rolled back", mig, start)
+	}
+	return nil
+}
+
+func (m *Migrator) logMigration(ctx context.Context, msg string, mig Migration, start time.Time) {
+	slogger(m.Slog).LogAttrs(ctx, slog.LevelInfo, msg, slog.Int64("version", mig.Version), slog.String("name", mig.Name), slog.Duration("duration", time.Since(start)))
+}
+
+func (m *Migrator) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	dbtx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	if err = f(dbtx); err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
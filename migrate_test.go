@@ -0,0 +1,88 @@
+package sqlutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewSQLite(t)
+
+	m := sqlutil.NewMigrator(db)
+	if err := m.EnsureTable(ctx, sqlutil.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	err := m.Register(
+		sqlutil.Migration{Version: 2, Up: "ALTER TABLE a ADD COLUMN y INTEGER", Down: "ALTER TABLE a DROP COLUMN y"},
+		sqlutil.Migration{Version: 1, Up: "CREATE TABLE a (x INTEGER)", Down: "DROP TABLE a"},
+		sqlutil.Migration{Version: 3, Up: "INSERT INTO a (x, y) VALUES (1, 2)"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2, 3)
+	testdb.AssertExists(t, db, "a", "x = 1 AND y = 2")
+
+	// Migration 3 has no down migration.
+	if err := m.Down(ctx, 1); err == nil {
+		t.Error("got no error rolling back a migration without a down migration")
+	}
+	assertApplied(t, m, 1, 2, 3)
+
+	if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1)
+	if _, err := db.Exec("INSERT INTO a (x, y) VALUES (1, 2)"); err == nil {
+		t.Error("column y still exists after rolling back migration 2")
+	}
+
+	// Now migration 3 is pending again, and applying it depends on migration 2.
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Version != 2 || pending[1].Version != 3 {
+		t.Errorf("got %d pending migrations, want versions 2 and 3", len(pending))
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, m, 1, 2, 3)
+}
+
+func TestMigratorRegisterDuplicate(t *testing.T) {
+	m := sqlutil.NewMigrator(nil)
+	err := m.Register(sqlutil.Migration{Version: 1}, sqlutil.Migration{Version: 1})
+	if err == nil {
+		t.Error("got no error registering duplicate versions")
+	}
+}
+
+func assertApplied(t *testing.T, m *sqlutil.Migrator, want ...int64) {
+	t.Helper()
+
+	got, err := m.Applied(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got applied versions %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got applied versions %v, want %v", got, want)
+		}
+	}
+}
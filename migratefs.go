@@ -0,0 +1,83 @@
+package sqlutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+// LoadMigrations reads migrations from the files in directory dir of fsys,
+// which may be an embed.FS.
+// Files are named NNN_description.up.sql and NNN_description.down.sql,
+// where NNN is the migration's version
+// (with any number of digits)
+// and description is its name.
+// The .down.sql file for a version is optional.
+// Other files in dir are ignored.
+// The result is in ascending version order.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		byVersion = make(map[int64]*Migration)
+		hasUp     = make(map[int64]bool)
+	)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version in %s: %s", entry.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+			hasUp[version] = true
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if !hasUp[mig.Version] {
+			return nil, fmt.Errorf("migration version %d has no .up.sql file", mig.Version)
+		}
+		result = append(result, *mig)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// RegisterFS registers the migrations found by LoadMigrations in directory dir of fsys.
+func (m *Migrator) RegisterFS(fsys fs.FS, dir string) error {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return err
+	}
+	return m.Register(migrations...)
+}
@@ -0,0 +1,173 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Notifier delivers wake-up notifications on named channels,
+// so that waiters
+// (such as Lessor.AcquireWait and Queue.DequeueWait)
+// can react immediately instead of polling on an interval.
+// Notifications are hints:
+// a waiter must still check the database for the condition it is waiting for.
+type Notifier interface {
+	// Notify sends a notification with the given payload on the named channel.
+	Notify(ctx context.Context, channel, payload string) error
+
+	// Wait blocks until a notification arrives on the named channel
+	// or ctx is canceled
+	// (in which case it returns ctx.Err()).
+	Wait(ctx context.Context, channel string) error
+}
+
+// waitFor waits on channel using n,
+// or simply sleeps if n is nil,
+// for at most poll.
+// It returns a non-nil error only if ctx is canceled.
+func waitFor(ctx context.Context, n Notifier, channel string, poll time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, poll)
+	defer cancel()
+
+	if n != nil {
+		n.Wait(waitCtx, channel)
+	} else {
+		<-waitCtx.Done()
+	}
+	return ctx.Err()
+}
+
+// waiters is a registry of goroutines waiting for notifications,
+// shared by the Notifier implementations.
+type waiters struct {
+	mu sync.Mutex
+	m  map[string][]chan struct{}
+}
+
+func (w *waiters) wait(ctx context.Context, channel string) error {
+	ch := make(chan struct{})
+	w.mu.Lock()
+	if w.m == nil {
+		w.m = make(map[string][]chan struct{})
+	}
+	w.m[channel] = append(w.m[channel], ch)
+	w.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		w.mu.Lock()
+		chans := w.m[channel]
+		for i, c := range chans {
+			if c == ch {
+				w.m[channel] = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		w.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (w *waiters) wake(channel string) {
+	w.mu.Lock()
+	chans := w.m[channel]
+	delete(w.m, channel)
+	w.mu.Unlock()
+
+	for _, ch := range chans {
+		close(ch)
+	}
+}
+
+// LocalNotifier is a Notifier that delivers notifications only within the current process.
+// Waiters in other processes are not woken,
+// so it is suitable as a fallback where the database has no notification mechanism:
+// components using it fall back to polling for changes made elsewhere.
+type LocalNotifier struct {
+	w waiters
+}
+
+// NewLocalNotifier produces a new LocalNotifier.
+func NewLocalNotifier() *LocalNotifier {
+	return &LocalNotifier{}
+}
+
+// Notify implements Notifier.
+func (n *LocalNotifier) Notify(_ context.Context, channel, _ string) error {
+	n.w.wake(channel)
+	return nil
+}
+
+// Wait implements Notifier.
+func (n *LocalNotifier) Wait(ctx context.Context, channel string) error {
+	return n.w.wait(ctx, channel)
+}
+
+// PGListenConn is a dedicated Postgres connection capable of receiving notifications.
+// database/sql has no way to receive notifications,
+// so this must be adapted from a driver-specific type,
+// such as a *pgx.Conn
+// (whose Exec and WaitForNotification methods need only light wrapping).
+type PGListenConn interface {
+	// ExecContext executes a statement (LISTEN) on the connection.
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+	// WaitForNotification blocks until a notification arrives on any channel the connection is listening to.
+	WaitForNotification(ctx context.Context) (channel, payload string, err error)
+}
+
+// PGNotifier is a Notifier using Postgres LISTEN/NOTIFY.
+// It sends notifications with pg_notify through db
+// and receives them on conn,
+// in its Run method.
+type PGNotifier struct {
+	db       ExecerContext
+	conn     PGListenConn
+	channels []string
+	w        waiters
+}
+
+// NewPGNotifier produces a new PGNotifier.
+// Notifications are sent with db
+// and received with conn,
+// which must not be used for anything else.
+// Waiters can be woken only for the channels listed here.
+func NewPGNotifier(db ExecerContext, conn PGListenConn, channels ...string) *PGNotifier {
+	return &PGNotifier{db: db, conn: conn, channels: channels}
+}
+
+// Notify implements Notifier.
+func (n *PGNotifier) Notify(ctx context.Context, channel, payload string) error {
+	_, err := n.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return wrapf(err, "sending notification")
+}
+
+// Wait implements Notifier.
+func (n *PGNotifier) Wait(ctx context.Context, channel string) error {
+	return n.w.wait(ctx, channel)
+}
+
+// Run listens on n's channels and wakes waiters as notifications arrive,
+// until ctx is canceled or receiving fails.
+func (n *PGNotifier) Run(ctx context.Context) error {
+	for _, channel := range n.channels {
+		if _, err := n.conn.ExecContext(ctx, "LISTEN "+Postgres.QuoteIdent(channel)); err != nil {
+			return fmt.Errorf("listening on %s: %w", channel, err)
+		}
+	}
+	for {
+		channel, _, err := n.conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return wrapf(err, "waiting for notification")
+		}
+		n.w.wake(channel)
+	}
+}
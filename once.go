@@ -0,0 +1,142 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	onceTable       = "once_tasks"
+	onceLeasePrefix = "sqlutil.once:"
+)
+
+// OnceLeaseDuration is how long Once holds its lease while running a task.
+// The task must complete within this time;
+// the context in which it runs has a deadline at the lease's expiration.
+var OnceLeaseDuration = 10 * time.Minute
+
+// OnceLeaseRetry governs how Once and OnceTx wait for a lease held by a concurrent caller.
+// If it is nil,
+// they retry every second until the holder's lease must have expired
+// (OnceLeaseDuration from the first attempt),
+// and then give up with ErrLeaseHeld.
+var OnceLeaseRetry *RetryPolicy
+
+func onceLeaseRetry() *RetryPolicy {
+	if OnceLeaseRetry != nil {
+		return OnceLeaseRetry
+	}
+	return &RetryPolicy{Base: time.Second, Max: time.Second, Jitter: -1, MaxAttempts: int(OnceLeaseDuration/time.Second) + 2}
+}
+
+// Once runs fn,
+// unless a task with the given name has already completed successfully,
+// so that the task runs to completion once even when many processes call Once concurrently
+// (e.g. at startup).
+// While fn runs,
+// Once holds a lease
+// (from the Lessor in ctx, if any, see WithLessor, or else from a default Lessor for db),
+// and concurrent callers wait for it
+// (see OnceLeaseRetry).
+// If fn fails,
+// its error is returned and the task is not marked done,
+// so a later call to Once will run it again.
+//
+// The task is marked done after fn returns,
+// in a separate statement;
+// if that fails,
+// or the lease expired while fn ran
+// (letting another caller start the task),
+// fn may run again.
+// So Once guarantees only at-least-once execution,
+// and fn should be idempotent.
+// For a task whose effects are confined to db,
+// OnceTx gives exactly-once execution.
+//
+// Completed tasks are recorded in a table named once_tasks with these columns:
+//
+//	name     a string-compatible type, uniquely indexed
+//	done_at  a time.Time-compatible type (like DATETIME)
+func Once(ctx context.Context, db DB, taskName string, fn func(context.Context) error) error {
+	return once(ctx, db, taskName, func(leaseCtx context.Context) error {
+		if err := fn(leaseCtx); err != nil {
+			return err
+		}
+		return markOnceDone(ctx, db, taskName)
+	})
+}
+
+// OnceTx is like Once,
+// but it runs fn in a transaction
+// in which the task is also marked done,
+// so that fn's effects on the database and the done marker are committed together
+// or not at all.
+// The task therefore completes exactly once.
+func OnceTx(ctx context.Context, db DB, taskName string, fn func(context.Context, *sql.Tx) error) error {
+	return once(ctx, db, taskName, func(ctx context.Context) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		if err := markOnceDone(ctx, tx, taskName); err != nil {
+			return err
+		}
+		return wrapf(tx.Commit(), "committing transaction")
+	})
+}
+
+// once calls run,
+// holding the task's lease,
+// unless the task is already done.
+// The context passed to run has a deadline at the lease's expiration.
+func once(ctx context.Context, db DB, taskName string, run func(context.Context) error) error {
+	done, err := onceDone(ctx, db, taskName)
+	if err != nil || done {
+		return err
+	}
+
+	lessor, ok := ctx.Value(lessorCtxkey).(*Lessor)
+	if !ok {
+		lessor = NewLessor(db)
+	}
+	lease, err := lessor.AcquireWait(ctx, onceLeasePrefix+taskName, OnceLeaseDuration, onceLeaseRetry())
+	if err != nil {
+		return fmt.Errorf("acquiring lease: %w", err)
+	}
+	defer lease.Release(ctx)
+
+	// Another process may have completed the task while we waited for the lease.
+	done, err = onceDone(ctx, db, taskName)
+	if err != nil || done {
+		return err
+	}
+
+	leaseCtx, cancel := lease.Context(ctx)
+	defer cancel()
+
+	return run(leaseCtx)
+}
+
+func markOnceDone(ctx context.Context, db ExecerContext, taskName string) error {
+	const insQFmt = `INSERT INTO %s (name, done_at) VALUES ($1, $2)`
+	_, err := db.ExecContext(ctx, fmt.Sprintf(insQFmt, onceTable), taskName, time.Now())
+	return wrapf(err, "marking task done")
+}
+
+func onceDone(ctx context.Context, db QueryerContext, taskName string) (bool, error) {
+	const selQFmt = `SELECT 1 FROM %s WHERE name = $1`
+	var one int
+	err := db.QueryRowContext(ctx, fmt.Sprintf(selQFmt, onceTable), taskName).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, wrapf(err, "checking task")
+}
@@ -0,0 +1,83 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func newOnceDB(t *testing.T) *sql.DB {
+	return testdb.NewSQLite(t,
+		testdb.DDL("CREATE TABLE once_tasks (name TEXT PRIMARY KEY, done_at DATETIME)"),
+		testdb.LessorTable(sqlutil.NewLessor(nil)),
+	)
+}
+
+func TestOnce(t *testing.T) {
+	ctx := context.Background()
+	db := newOnceDB(t)
+
+	var (
+		calls   int
+		errFail = errors.New("fail")
+	)
+	fail := func(context.Context) error {
+		calls++
+		return errFail
+	}
+	succeed := func(context.Context) error {
+		calls++
+		return nil
+	}
+
+	if err := sqlutil.Once(ctx, db, "task", fail); !errors.Is(err, errFail) {
+		t.Fatalf("got error %v, want %v", err, errFail)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sqlutil.Once(ctx, db, "task", succeed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("task ran %d times, want 2 (one failure, one success)", calls)
+	}
+	testdb.AssertExists(t, db, "once_tasks", "name = $1", "task")
+	testdb.AssertRowCount(t, db, "leases", "", 0)
+}
+
+func TestOnceTx(t *testing.T) {
+	ctx := context.Background()
+	db := newOnceDB(t)
+	if _, err := db.Exec("CREATE TABLE t (x INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	errFail := errors.New("fail")
+	err := sqlutil.OnceTx(ctx, db, "task", func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO t (x) VALUES (1)"); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("got error %v, want %v", err, errFail)
+	}
+	testdb.AssertRowCount(t, db, "t", "", 0)
+	testdb.AssertNotExists(t, db, "once_tasks", "name = $1", "task")
+
+	for i := 0; i < 2; i++ {
+		err = sqlutil.OnceTx(ctx, db, "task", func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO t (x) VALUES (2)")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	testdb.AssertRowCount(t, db, "t", "", 1)
+	testdb.AssertExists(t, db, "once_tasks", "name = $1", "task")
+}
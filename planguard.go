@@ -0,0 +1,276 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Plan is the query plan of a named query,
+// as recorded by a PlanGuard.
+// It is JSON-serializable,
+// so that baselines can be stored
+// (e.g. in testdata files)
+// and restored with PlanGuard.SetBaseline.
+type Plan struct {
+	Query string `json:"query"`
+
+	// Text is the database's EXPLAIN output,
+	// one line per row.
+	Text string `json:"text"`
+
+	// SeqScans lists the tables the plan reads with full (sequential) scans,
+	// sorted and without duplicates.
+	SeqScans []string `json:"seq_scans,omitempty"`
+}
+
+// PlanRegression describes a named query whose plan,
+// compared with its baseline,
+// has sequential scans of tables it formerly read through indexes.
+type PlanRegression struct {
+	Name              string
+	Baseline, Current Plan
+
+	// NewSeqScans lists the tables scanned sequentially in Current but not in Baseline.
+	NewSeqScans []string
+}
+
+func (r PlanRegression) String() string {
+	return fmt.Sprintf("plan regression in query %s: new sequential scans of %s\nbaseline plan:\n%s\ncurrent plan:\n%s", r.Name, strings.Join(r.NewSeqScans, ", "), r.Baseline.Text, r.Current.Text)
+}
+
+// PlanGuard is a DB that records the EXPLAIN output of named queries
+// (see WithQueryName)
+// and detects plan regressions.
+// The first time it sees a statement with a given name,
+// it explains the statement
+// (with the same arguments)
+// before running it.
+// If there is a baseline plan for that name
+// (see SetBaseline),
+// and the new plan has sequential scans that the baseline lacks,
+// PlanGuard calls OnRegression.
+// Otherwise the new plan becomes the baseline.
+//
+// Statements without names are passed through unexamined.
+// Explaining costs an extra round trip per name,
+// so PlanGuard is meant mainly for tests and staging environments.
+type PlanGuard struct {
+	DB
+
+	// Dialect is the database's SQL dialect,
+	// which determines how statements are explained.
+	Dialect Dialect
+
+	// OnRegression, if set, is called when a plan regression is detected.
+	// In tests, see testdb.FailOnPlanRegression.
+	OnRegression func(PlanRegression)
+
+	mu       sync.Mutex
+	checked  map[string]bool
+	baseline map[string]Plan
+	current  map[string]Plan
+}
+
+// NewPlanGuard produces a new PlanGuard wrapping db.
+func NewPlanGuard(db DB, d Dialect, onRegression func(PlanRegression)) *PlanGuard {
+	return &PlanGuard{DB: db, Dialect: d, OnRegression: onRegression}
+}
+
+// SetBaseline sets the baseline plans against which new plans are compared,
+// keyed by query name.
+// It also forgets which names have been checked,
+// so each is explained again on its next use.
+func (g *PlanGuard) SetBaseline(plans map[string]Plan) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.baseline = make(map[string]Plan, len(plans))
+	for name, p := range plans {
+		g.baseline[name] = p
+	}
+	g.checked = nil
+}
+
+// Plans returns the plans recorded during this PlanGuard's lifetime,
+// keyed by query name.
+// Passing them to SetBaseline
+// (e.g. after storing them)
+// makes them the baseline.
+func (g *PlanGuard) Plans() map[string]Plan {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	result := make(map[string]Plan, len(g.current))
+	for name, p := range g.current {
+		result[name] = p
+	}
+	return result
+}
+
+// QueryContext implements QueryerContext.
+func (g *PlanGuard) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	g.check(ctx, query, args)
+	return g.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (g *PlanGuard) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	g.check(ctx, query, args)
+	return g.DB.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements ExecerContext.
+func (g *PlanGuard) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	g.check(ctx, query, args)
+	return g.DB.ExecContext(ctx, query, args...)
+}
+
+func (g *PlanGuard) check(ctx context.Context, query string, args []interface{}) {
+	name := QueryName(ctx)
+	if name == "" {
+		return
+	}
+
+	g.mu.Lock()
+	if g.checked[name] {
+		g.mu.Unlock()
+		return
+	}
+	if g.checked == nil {
+		g.checked = make(map[string]bool)
+	}
+	g.checked[name] = true
+	g.mu.Unlock()
+
+	plan, err := Explain(ctx, g.DB, g.Dialect, query, args...)
+	if err != nil {
+		slogger(nil).LogAttrs(ctx, slog.LevelWarn, "explaining query", slog.String("name", name), slog.String("err", err.Error()))
+		return
+	}
+
+	g.mu.Lock()
+	if g.current == nil {
+		g.current = make(map[string]Plan)
+	}
+	g.current[name] = plan
+	baseline, ok := g.baseline[name]
+	if !ok {
+		if g.baseline == nil {
+			g.baseline = make(map[string]Plan)
+		}
+		g.baseline[name] = plan
+	}
+	g.mu.Unlock()
+
+	if !ok || g.OnRegression == nil {
+		return
+	}
+	if newScans := setDiff(plan.SeqScans, baseline.SeqScans); len(newScans) > 0 {
+		g.OnRegression(PlanRegression{
+			Name:        name,
+			Baseline:    baseline,
+			Current:     plan,
+			NewSeqScans: newScans,
+		})
+	}
+}
+
+// Explain produces the plan of a statement without running it.
+// For Postgres this uses EXPLAIN,
+// for MySQL EXPLAIN
+// (in which a full scan has access type ALL),
+// and for SQLite EXPLAIN QUERY PLAN.
+func Explain(ctx context.Context, db QueryerContext, d Dialect, query string, args ...interface{}) (Plan, error) {
+	prefix := "EXPLAIN "
+	if d == SQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	rows, err := db.QueryContext(ctx, prefix+query, args...)
+	if err != nil {
+		return Plan{}, fmt.Errorf("explaining query: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return Plan{}, fmt.Errorf("getting columns: %w", err)
+	}
+
+	var (
+		lines []string
+		scans = make(map[string]bool)
+		vals  = make([]sql.NullString, len(cols))
+		ptrs  = make([]interface{}, len(cols))
+	)
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return Plan{}, fmt.Errorf("scanning plan: %w", err)
+		}
+		row := make(map[string]string, len(cols))
+		strs := make([]string, len(cols))
+		for i, col := range cols {
+			row[strings.ToLower(col)] = vals[i].String
+			strs[i] = vals[i].String
+		}
+
+		switch d {
+		case Postgres:
+			line := strs[0]
+			lines = append(lines, line)
+			if _, after, ok := strings.Cut(line, "Seq Scan on "); ok {
+				scans[firstWord(after)] = true
+			}
+
+		case MySQL:
+			lines = append(lines, strings.Join(strs, "\t"))
+			if row["type"] == "ALL" && row["table"] != "" {
+				scans[row["table"]] = true
+			}
+
+		case SQLite:
+			detail := row["detail"]
+			lines = append(lines, detail)
+			if after, ok := strings.CutPrefix(detail, "SCAN "); ok && !strings.Contains(detail, " USING ") {
+				scans[firstWord(strings.TrimPrefix(after, "TABLE "))] = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Plan{}, fmt.Errorf("iterating over plan: %w", err)
+	}
+
+	plan := Plan{Query: query, Text: strings.Join(lines, "\n")}
+	for table := range scans {
+		plan.SeqScans = append(plan.SeqScans, table)
+	}
+	sort.Strings(plan.SeqScans)
+	return plan, nil
+}
+
+func firstWord(s string) string {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// setDiff returns the elements of a not in b.
+func setDiff(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	var result []string
+	for _, s := range a {
+		if !inB[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// PoolStats periodically samples the connection-pool statistics
+// (open connections, connections in use, waits for a connection, and so on)
+// of registered *sql.DB handles
+// and publishes them to a Metrics,
+// optionally logging a warning when connection waits grow too long.
+type PoolStats struct {
+	// Metrics, if set, receives each sample.
+	Metrics Metrics
+
+	// Logger, if set, receives warnings about connection waits.
+	Logger Logger
+
+	// WaitThreshold is the average time spent waiting for a connection,
+	// per wait,
+	// between samples,
+	// above which a warning is logged.
+	// The default if this is unspecified is 100ms.
+	WaitThreshold time.Duration
+
+	mu   sync.Mutex
+	dbs  map[string]*sql.DB
+	last map[string]sql.DBStats
+}
+
+const defaultPoolWaitThreshold = 100 * time.Millisecond
+
+// NewPoolStats produces a new PoolStats publishing to m.
+func NewPoolStats(m Metrics) *PoolStats {
+	return &PoolStats{
+		Metrics: m,
+		dbs:     make(map[string]*sql.DB),
+		last:    make(map[string]sql.DBStats),
+	}
+}
+
+// Add registers db to be sampled under the given name.
+func (p *PoolStats) Add(name string, db *sql.DB) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dbs == nil {
+		p.dbs = make(map[string]*sql.DB)
+		p.last = make(map[string]sql.DBStats)
+	}
+	p.dbs[name] = db
+}
+
+// Sample samples each registered handle once.
+func (p *PoolStats) Sample() {
+	threshold := p.WaitThreshold
+	if threshold <= 0 {
+		threshold = defaultPoolWaitThreshold
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, db := range p.dbs {
+		stats := db.Stats()
+		if p.Metrics != nil {
+			p.Metrics.ObservePoolStats(name, stats)
+		}
+		if prev, ok := p.last[name]; ok && p.Logger != nil {
+			waits := stats.WaitCount - prev.WaitCount
+			if waits > 0 {
+				avg := (stats.WaitDuration - prev.WaitDuration) / time.Duration(waits)
+				if avg > threshold {
+					p.Logger.Printf("db %s: %d waits for a connection averaging %s (%d of %d open connections in use)", name, waits, avg, stats.InUse, stats.OpenConnections)
+				}
+			}
+		}
+		p.last[name] = stats
+	}
+}
+
+// Run calls Sample every interval until ctx is canceled.
+func (p *PoolStats) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Sample()
+		}
+	}
+}
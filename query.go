@@ -3,10 +3,10 @@ package sqlutil
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
-
-	"github.com/pkg/errors"
+	"sync"
 )
 
 // The code in this file is adapted from similar code in
@@ -50,7 +50,34 @@ var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
 // arguments is not reused between calls.  The callback may return a
 // single error-type value.  If any invocation yields a non-nil
 // result, ForQueryRows will abort and return it.
+//
+// If the callback takes a single struct argument
+// (other than a time.Time or sql.Scanner),
+// each row is scanned into the struct's fields by column name,
+// mapping fields to columns as described in the package documentation.
+// How mismatches between columns and fields are handled
+// is controlled by StructScanOptions
+// (see WithStructScanOptions);
+// by default they are errors.
 func ForQueryRows(ctx context.Context, db QueryerContext, query string, args ...interface{}) error {
+	return forQueryRows(ctx, db, false, query, args)
+}
+
+// ForQueryRowsReuse is like ForQueryRows,
+// but the space for the callback's arguments is allocated once and reused for every row,
+// eliminating per-row allocations.
+// This changes the aliasing guarantee of ForQueryRows:
+// any reference-typed value the callback receives
+// (e.g. a pointer or a sql.RawBytes)
+// may be overwritten when the next row is scanned,
+// so the callback must fully consume its arguments before returning
+// and must not retain them.
+// It is suited to high-throughput scans like aggregations and streaming copies.
+func ForQueryRowsReuse(ctx context.Context, db QueryerContext, query string, args ...interface{}) error {
+	return forQueryRows(ctx, db, true, query, args)
+}
+
+func forQueryRows(ctx context.Context, db QueryerContext, reuse bool, query string, args []interface{}) error {
 	if len(args) == 0 {
 		return fmt.Errorf("too few arguments")
 	}
@@ -77,26 +104,66 @@ func ForQueryRows(ctx context.Context, db QueryerContext, query string, args ...
 
 	fnVal := reflect.ValueOf(fnArg)
 
-	argPtrVals := make([]reflect.Value, 0, fnType.NumIn())
-	scanArgs := make([]interface{}, 0, fnType.NumIn())
-	fnArgs := make([]reflect.Value, 0, fnType.NumIn())
+	var ss *structScanner
+	if fnType.NumIn() == 1 && isScanStruct(fnType.In(0)) {
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if ss, err = newStructScanner(fnType.In(0), cols, structScanOptions(ctx)); err != nil {
+			return err
+		}
+	}
+
+	sc := scratchPool.Get().(*scratch)
+	defer sc.release()
+
+	argPtrVals := sc.argPtrVals[:0]
+	scanArgs := sc.scanArgs[:0]
+	fnArgs := sc.fnArgs[:0]
+	defer func() {
+		// Keep any growth for the next caller.
+		sc.argPtrVals, sc.scanArgs, sc.fnArgs = argPtrVals, scanArgs, fnArgs
+	}()
 
 	for rows.Next() {
-		argPtrVals = argPtrVals[:0]
-		scanArgs = scanArgs[:0]
-		fnArgs = fnArgs[:0]
-		for i := 0; i < fnType.NumIn(); i++ {
-			argType := fnType.In(i)
-			argPtrVal := reflect.New(argType)
-			argPtrVals = append(argPtrVals, argPtrVal)
-			scanArgs = append(scanArgs, argPtrVal.Interface())
+		if !reuse || len(argPtrVals) == 0 {
+			argPtrVals = argPtrVals[:0]
+			scanArgs = scanArgs[:0]
+			fnArgs = fnArgs[:0]
+			for i := 0; i < fnType.NumIn(); i++ {
+				argType := fnType.In(i)
+				argPtrVal := reflect.New(argType)
+				argPtrVals = append(argPtrVals, argPtrVal)
+				if ss == nil {
+					scanArgs = append(scanArgs, argPtrVal.Interface())
+				}
+			}
+			if ss != nil {
+				scanArgs = append(scanArgs, ss.dests(argPtrVals[0].Elem())...)
+			}
+		} else {
+			for _, argPtrVal := range argPtrVals {
+				elem := argPtrVal.Elem()
+				elem.Set(reflect.Zero(elem.Type()))
+			}
 		}
 		err = rows.Scan(scanArgs...)
 		if err != nil {
 			return err
 		}
-		for _, argPtrVal := range argPtrVals {
-			fnArgs = append(fnArgs, argPtrVal.Elem())
+		if ss != nil {
+			ss.finish(argPtrVals[0].Elem(), scanArgs)
+		}
+		if !reuse || len(fnArgs) == 0 {
+			fnArgs = fnArgs[:0]
+			for _, argPtrVal := range argPtrVals {
+				fnArgs = append(fnArgs, argPtrVal.Elem())
+			}
+		}
+		if ctx.Err() != nil && strictHook() != nil {
+			reportStrict(StrictViolation{Kind: CallbackAfterCancel, Query: query})
+			return ctx.Err()
 		}
 		res := fnVal.Call(fnArgs)
 		if fnType.NumOut() == 1 && !res[0].IsNil() {
@@ -106,11 +173,62 @@ func ForQueryRows(ctx context.Context, db QueryerContext, query string, args ...
 	return rows.Err()
 }
 
+// scratch holds the slices ForQueryRows builds per call,
+// pooled to spare hot paths the garbage.
+type scratch struct {
+	argPtrVals []reflect.Value
+	scanArgs   []interface{}
+	fnArgs     []reflect.Value
+}
+
+var scratchPool = sync.Pool{
+	New: func() interface{} { return new(scratch) },
+}
+
+// release clears sc's slices,
+// so that the pool does not keep scanned values alive,
+// and returns sc to the pool.
+func (sc *scratch) release() {
+	for i := range sc.argPtrVals {
+		sc.argPtrVals[i] = reflect.Value{}
+	}
+	for i := range sc.scanArgs {
+		sc.scanArgs[i] = nil
+	}
+	for i := range sc.fnArgs {
+		sc.fnArgs[i] = reflect.Value{}
+	}
+	sc.argPtrVals, sc.scanArgs, sc.fnArgs = sc.argPtrVals[:0], sc.scanArgs[:0], sc.fnArgs[:0]
+	scratchPool.Put(sc)
+}
+
 // QueryRowContext is just like the db.QueryRowContext method but additionally detects whether the query produces more than one row.
 // In that case the Row.Scan method returns ErrMultipleRows.
 func QueryRowContext(ctx context.Context, db QueryerContext, query string, args ...interface{}) *Row {
 	rows, err := db.QueryContext(ctx, query, args...)
-	return &Row{rows: rows, err: err}
+	r := &Row{rows: rows, err: err, scanOpts: structScanOptions(ctx)}
+	if strictHook() != nil && rows != nil {
+		r.scanned = make(chan struct{})
+		go r.watch(ctx, query)
+	}
+	return r
+}
+
+// GetRow runs query,
+// which must produce a single row,
+// and scans it into a value of type T:
+// by column name if T is a struct type
+// (other than time.Time or a sql.Scanner, as in Row.Scan),
+// and otherwise as the row's single column.
+// Like Row.Scan,
+// it returns sql.ErrNoRows if there is no row
+// and ErrMultipleRows
+// (along with the first row's value)
+// if there is more than one.
+func GetRow[T any](ctx context.Context, db QueryerContext, query string, args ...interface{}) (T, error) {
+	var v T
+	err := QueryRowContext(ctx, db, query, args...).Scan(&v)
+	return v, err
 }
 
 // ErrMultipleRows is the error produced by Row.Scan when the query has produced more than one row.
@@ -120,8 +238,12 @@ var ErrMultipleRows = errors.New("multiple rows")
 // It is the same as "database/sql".Rows,
 // except that it can return the ErrMultipleRows error.
 type Row struct {
-	rows *sql.Rows
-	err  error
+	rows     *sql.Rows
+	err      error
+	scanOpts StructScanOptions
+
+	scanned  chan struct{} // in strict mode, closed by Scan
+	scanOnce sync.Once
 }
 
 // Err returns the error in r, if any.
@@ -134,22 +256,58 @@ func (r *Row) Err() error {
 // Note that when this function returns ErrMultipleRows,
 // the pointers are populated anyway,
 // with values from the first row of query results.
+//
+// If the sole argument is a pointer to a struct
+// (other than a time.Time or sql.Scanner),
+// the row is scanned into the struct's fields by column name,
+// as ForQueryRows does for a callback taking a struct,
+// subject to the StructScanOptions in the context passed to QueryRowContext.
 func (r *Row) Scan(dest ...interface{}) error {
+	if r.scanned != nil {
+		r.scanOnce.Do(func() { close(r.scanned) })
+	}
+
 	if r.rows == nil {
 		return r.err
 	}
 
-	defer r.rows.Close()
+	rows := r.rows
+	defer rows.Close()
 
-	if !r.rows.Next() {
+	if !rows.Next() {
 		return sql.ErrNoRows
 	}
-	err := r.rows.Scan(dest...)
-	if err != nil {
+	if err := scanRow(rows, dest, r.scanOpts); err != nil {
 		return err
 	}
-	if r.rows.Next() {
+	if rows.Next() {
 		return ErrMultipleRows
 	}
 	return nil
 }
+
+// scanRow scans the current row of rows into dest,
+// by column name if dest is a single pointer to a struct.
+func scanRow(rows *sql.Rows, dest []interface{}, opts StructScanOptions) error {
+	if len(dest) != 1 {
+		return rows.Scan(dest...)
+	}
+	v := reflect.ValueOf(dest[0])
+	if v.Kind() != reflect.Ptr || v.IsNil() || !isScanStruct(v.Type().Elem()) {
+		return rows.Scan(dest...)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	ss, err := newStructScanner(v.Type().Elem(), cols, opts)
+	if err != nil {
+		return err
+	}
+	dests := ss.dests(v.Elem())
+	if err = rows.Scan(dests...); err != nil {
+		return err
+	}
+	ss.finish(v.Elem(), dests)
+	return nil
+}
@@ -0,0 +1,420 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Queue is a job queue stored in a database table.
+// Like Lessor,
+// it's a wrapper around a database handle
+// that specifies the name of the table holding the queue's jobs.
+//
+// The table must have these columns:
+//
+//	id        an auto-assigned integer primary key
+//	payload   a []byte-compatible type (like BLOB or BYTEA)
+//	priority  an integer; higher values are dequeued first
+//	run_at    a time.Time-compatible type (like DATETIME); the job is not dequeued before this time
+//	attempts  an integer, defaulting to 0
+//	state     a string-compatible type, defaulting to 'ready'
+//	claim_key a string-compatible type capable of storing a 32-byte string, nullable
+//
+// For performance, an index should be defined on (state, run_at).
+type Queue struct {
+	db DB
+
+	// Table is the name of the db table holding the queue's jobs.
+	// The default if this is unspecified is "jobs".
+	Table string
+
+	// MaxAttempts is the number of times a job may be dequeued
+	// before a failure (via Nack) sends it to the dead-letter state.
+	// A job that has been dequeued this many times
+	// and whose last claim lapsed without an Ack or Nack
+	// (e.g. because its worker crashed)
+	// is likewise dead-lettered instead of being dequeued again.
+	// The default if this is unspecified is 5.
+	MaxAttempts int
+
+	// SkipLocked, if true, causes Dequeue to claim jobs with a single
+	// UPDATE ... WHERE id = (SELECT ... FOR UPDATE SKIP LOCKED) RETURNING ... statement.
+	// This requires a database that supports FOR UPDATE SKIP LOCKED and RETURNING,
+	// such as Postgres.
+	// Otherwise Dequeue claims jobs lease-style,
+	// with an UPDATE conditioned on the job's previous state.
+	SkipLocked bool
+
+	// Retry, if set, governs the delays used by Job.NackBackoff.
+	Retry *RetryPolicy
+
+	// Notifier, if set, is notified on the Queue's Channel when a job is enqueued,
+	// allowing DequeueWait to claim it immediately instead of waiting for its next poll.
+	Notifier Notifier
+
+	// Slog, if set, receives structured log records of queue activity.
+	// The default is the package-level logger set with SetSlog.
+	Slog *slog.Logger
+}
+
+const (
+	defaultQueueTable  = "jobs"
+	defaultMaxAttempts = 5
+
+	// Job states.
+	jobReady = "ready"
+	jobDead  = "dead"
+)
+
+// ErrNoJobs is the error produced by Queue.Dequeue when no job is ready.
+var ErrNoJobs = errors.New("no jobs ready")
+
+// ErrJobNotClaimed is the error produced by Ack and Nack when the job's claim has lapsed
+// (its visibility timeout passed and another worker claimed it).
+var ErrJobNotClaimed = errors.New("job no longer claimed")
+
+// ErrJobNotDead is the error produced by RetryDead when the job is not in the dead-letter state.
+var ErrJobNotDead = errors.New("job not dead-lettered")
+
+// NewQueue produces a new Queue.
+func NewQueue(db DB) *Queue {
+	return &Queue{db: db}
+}
+
+func (q *Queue) tableName() string {
+	if q.Table == "" {
+		return defaultQueueTable
+	}
+	return q.Table
+}
+
+func (q *Queue) maxAttempts() int {
+	if q.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return q.MaxAttempts
+}
+
+// Channel is the Notifier channel on which q announces newly enqueued jobs.
+func (q *Queue) Channel() string {
+	return "sqlutil_queue_" + q.tableName()
+}
+
+// Enqueue adds a job to the queue.
+// The job will not be dequeued before runAt.
+// Among ready jobs,
+// those with higher priority are dequeued first.
+func (q *Queue) Enqueue(ctx context.Context, payload []byte, priority int, runAt time.Time) error {
+	const insQFmt = `INSERT INTO %s (payload, priority, run_at, attempts, state) VALUES ($1, $2, $3, 0, $4)`
+	insQ := fmt.Sprintf(insQFmt, q.tableName())
+	_, err := q.db.ExecContext(ctx, insQ, payload, priority, runAt, jobReady)
+	if err != nil {
+		return fmt.Errorf("inserting into database: %w", err)
+	}
+	slogger(q.Slog).LogAttrs(ctx, slog.LevelDebug, "job enqueued", slog.String("queue", q.tableName()), slog.Int("priority", priority), slog.Time("run_at", runAt))
+	if q.Notifier != nil {
+		return wrapf(q.Notifier.Notify(ctx, q.Channel(), ""), "notifying")
+	}
+	return nil
+}
+
+// EnqueueBatch adds a job to the queue for each of payloads,
+// all with the same priority and runAt,
+// using BulkInsert
+// (and hence a native bulk-loading protocol if q's db handle is a CopyFromer).
+func (q *Queue) EnqueueBatch(ctx context.Context, payloads [][]byte, priority int, runAt time.Time) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(payloads))
+	for _, payload := range payloads {
+		rows = append(rows, []interface{}{payload, priority, runAt, 0, jobReady})
+	}
+	if err := BulkInsert(ctx, q.db, q.tableName(), []string{"payload", "priority", "run_at", "attempts", "state"}, rows); err != nil {
+		return err
+	}
+	slogger(q.Slog).LogAttrs(ctx, slog.LevelDebug, "jobs enqueued", slog.String("queue", q.tableName()), slog.Int("jobs", len(payloads)), slog.Int("priority", priority), slog.Time("run_at", runAt))
+	if q.Notifier != nil {
+		return wrapf(q.Notifier.Notify(ctx, q.Channel(), ""), "notifying")
+	}
+	return nil
+}
+
+// Dequeue claims the next ready job in the queue.
+// The job is invisible to other callers of Dequeue for the duration of the visibility timeout,
+// after which (unless it is Acked or Nacked) it becomes ready again.
+// If no job is ready,
+// the error is ErrNoJobs.
+func (q *Queue) Dequeue(ctx context.Context, visibility time.Duration) (*Job, error) {
+	if err := q.deadLetterExhausted(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, fmt.Errorf("computing key: %w", err)
+	}
+	var job *Job
+	if q.SkipLocked {
+		job, err = q.dequeueSkipLocked(ctx, visibility, key)
+	} else {
+		job, err = q.dequeueClaim(ctx, visibility, key)
+	}
+	switch {
+	case errors.Is(err, ErrNoJobs):
+		debugState.dequeueMisses.Add(1)
+	case err == nil:
+		debugState.dequeues.Add(1)
+		slogger(q.Slog).LogAttrs(ctx, slog.LevelDebug, "job dequeued", slog.String("queue", q.tableName()), slog.Int64("id", job.ID), slog.Int("attempts", job.Attempts))
+	}
+	return job, err
+}
+
+// deadLetterExhausted moves ready jobs that have used up their attempts
+// (whose last claim lapsed without an Ack or Nack)
+// to the dead-letter state.
+func (q *Queue) deadLetterExhausted(ctx context.Context) error {
+	const updQFmt = `UPDATE %s SET state = $1, claim_key = NULL WHERE state = $2 AND run_at <= $3 AND attempts >= $4`
+	updQ := fmt.Sprintf(updQFmt, q.tableName())
+	res, err := q.db.ExecContext(ctx, updQ, jobDead, jobReady, time.Now(), q.maxAttempts())
+	if err != nil {
+		return fmt.Errorf("dead-lettering exhausted jobs: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff > 0 {
+		slogger(q.Slog).LogAttrs(ctx, slog.LevelWarn, "exhausted jobs dead-lettered", slog.String("queue", q.tableName()), slog.Int64("jobs", aff))
+	}
+	return nil
+}
+
+// Depth returns the number of jobs in the queue that are ready to be dequeued.
+// The result is also recorded in DebugSnapshot.
+func (q *Queue) Depth(ctx context.Context) (int64, error) {
+	const countQFmt = `SELECT COUNT(*) FROM %s WHERE state = $1 AND run_at <= $2 AND attempts < $3`
+	countQ := fmt.Sprintf(countQFmt, q.tableName())
+	var n int64
+	if err := q.db.QueryRowContext(ctx, countQ, jobReady, time.Now(), q.maxAttempts()).Scan(&n); err != nil {
+		return 0, fmt.Errorf("counting ready jobs: %w", err)
+	}
+	debugQueueDepth(q.tableName(), n)
+	return n, nil
+}
+
+// DequeueWait is like Dequeue,
+// but if no job is ready it retries,
+// waiting between attempts according to the retry policy p
+// (which may be nil),
+// until it claims a job,
+// the policy's attempts are exhausted
+// (in which case the error is ErrNoJobs),
+// or ctx is canceled.
+// Errors other than ErrNoJobs are returned immediately.
+// If q has a Notifier,
+// DequeueWait also retries whenever a job is enqueued.
+func (q *Queue) DequeueWait(ctx context.Context, visibility time.Duration, p *RetryPolicy) (*Job, error) {
+	for n := 1; ; n++ {
+		job, err := q.Dequeue(ctx, visibility)
+		if !errors.Is(err, ErrNoJobs) || !p.more(n) {
+			return job, err
+		}
+		if err = waitFor(ctx, q.Notifier, q.Channel(), p.Delay(n)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (q *Queue) dequeueSkipLocked(ctx context.Context, visibility time.Duration, key string) (*Job, error) {
+	const updQFmt = `UPDATE %[1]s SET run_at = $1, claim_key = $2, attempts = attempts + 1` +
+		` WHERE id = (SELECT id FROM %[1]s WHERE state = $3 AND run_at <= $4 AND attempts < $5 ORDER BY priority DESC, run_at LIMIT 1 FOR UPDATE SKIP LOCKED)` +
+		` RETURNING id, payload, priority, attempts`
+	updQ := fmt.Sprintf(updQFmt, q.tableName())
+
+	now := time.Now()
+	job := &Job{Queue: q, Key: key, Visible: now.Add(visibility)}
+	err := q.db.QueryRowContext(ctx, updQ, job.Visible, key, jobReady, now, q.maxAttempts()).Scan(&job.ID, &job.Payload, &job.Priority, &job.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoJobs
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claiming job: %w", err)
+	}
+	return job, nil
+}
+
+// dequeueMaxCandidates is the number of candidate jobs dequeueClaim considers
+// before giving up because of contention with other dequeuers.
+const dequeueMaxCandidates = 10
+
+func (q *Queue) dequeueClaim(ctx context.Context, visibility time.Duration, key string) (*Job, error) {
+	const selQFmt = `SELECT id, payload, priority, attempts, run_at FROM %s WHERE state = $1 AND run_at <= $2 AND attempts < $3 ORDER BY priority DESC, run_at LIMIT %d`
+	selQ := fmt.Sprintf(selQFmt, q.tableName(), dequeueMaxCandidates)
+
+	const updQFmt = `UPDATE %s SET run_at = $1, claim_key = $2, attempts = attempts + 1 WHERE id = $3 AND state = $4 AND run_at = $5`
+	updQ := fmt.Sprintf(updQFmt, q.tableName())
+
+	now := time.Now()
+
+	var candidates []*Job
+	var runAts []time.Time
+	err := ForQueryRows(ctx, q.db, selQ, jobReady, now, q.maxAttempts(), func(id int64, payload []byte, priority, attempts int, runAt time.Time) {
+		candidates = append(candidates, &Job{Queue: q, ID: id, Payload: payload, Priority: priority, Attempts: attempts})
+		runAts = append(runAts, runAt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("finding candidate jobs: %w", err)
+	}
+
+	visible := now.Add(visibility)
+	for i, job := range candidates {
+		res, err := q.db.ExecContext(ctx, updQ, visible, key, job.ID, jobReady, runAts[i])
+		if err != nil {
+			return nil, fmt.Errorf("claiming job: %w", err)
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("counting affected rows: %w", err)
+		}
+		if aff == 0 {
+			// Claimed by someone else.
+			continue
+		}
+		job.Attempts++
+		job.Key = key
+		job.Visible = visible
+		return job, nil
+	}
+	return nil, ErrNoJobs
+}
+
+// Job is the type of a job dequeued from a Queue.
+type Job struct {
+	Queue    *Queue `json:"-"`
+	ID       int64
+	Payload  []byte
+	Priority int
+
+	// Attempts is the number of times the job has been dequeued,
+	// including this one.
+	Attempts int
+
+	// Key identifies this claim on the job.
+	// It is required in Ack and Nack operations.
+	Key string
+
+	// Visible is the time at which the job becomes ready again
+	// if it is neither Acked nor Nacked.
+	Visible time.Time
+}
+
+// Ack removes a successfully processed job from the queue.
+// It fails if the job's claim has expired and it has been dequeued by someone else.
+func (j *Job) Ack(ctx context.Context) error {
+	const delQFmt = `DELETE FROM %s WHERE id = $1 AND claim_key = $2`
+	delQ := fmt.Sprintf(delQFmt, j.Queue.tableName())
+	res, err := j.Queue.db.ExecContext(ctx, delQ, j.ID, j.Key)
+	if err != nil {
+		return fmt.Errorf("deleting from database: %w", err)
+	}
+	if err = j.checkClaim(res); err != nil {
+		return err
+	}
+	slogger(j.Queue.Slog).LogAttrs(ctx, slog.LevelDebug, "job acked", slog.String("queue", j.Queue.tableName()), slog.Int64("id", j.ID))
+	return nil
+}
+
+// Nack returns a job that failed processing to the queue,
+// to be retried after the given delay.
+// If the job has reached the Queue's MaxAttempts,
+// it is instead moved to the dead-letter state,
+// where Dequeue will not find it.
+// Nack fails if the job's claim has expired and it has been dequeued by someone else.
+func (j *Job) Nack(ctx context.Context, delay time.Duration) error {
+	const updQFmt = `UPDATE %s SET state = $1, run_at = $2, claim_key = NULL WHERE id = $3 AND claim_key = $4`
+	updQ := fmt.Sprintf(updQFmt, j.Queue.tableName())
+
+	state := jobReady
+	if j.Attempts >= j.Queue.maxAttempts() {
+		state = jobDead
+	}
+	res, err := j.Queue.db.ExecContext(ctx, updQ, state, time.Now().Add(delay), j.ID, j.Key)
+	if err != nil {
+		return fmt.Errorf("updating database: %w", err)
+	}
+	if err = j.checkClaim(res); err != nil {
+		return err
+	}
+	msg := "job nacked"
+	if state == jobDead {
+		msg = "job dead-lettered"
+	}
+	slogger(j.Queue.Slog).LogAttrs(ctx, slog.LevelWarn, msg, slog.String("queue", j.Queue.tableName()), slog.Int64("id", j.ID), slog.Int("attempts", j.Attempts), slog.Duration("delay", delay))
+	return nil
+}
+
+// NackBackoff is like Nack,
+// with a delay chosen by the Queue's Retry policy
+// according to the number of attempts so far.
+func (j *Job) NackBackoff(ctx context.Context) error {
+	return j.Nack(ctx, j.Queue.Retry.Delay(j.Attempts))
+}
+
+// Dead tells whether the job has reached its Queue's MaxAttempts,
+// meaning a Nack will send it to the dead-letter state.
+func (j *Job) Dead() bool {
+	return j.Attempts >= j.Queue.maxAttempts()
+}
+
+// DeadJobs returns up to limit jobs in the dead-letter state,
+// in order of ID.
+func (q *Queue) DeadJobs(ctx context.Context, limit int) ([]*Job, error) {
+	const selQFmt = `SELECT id, payload, priority, attempts FROM %s WHERE state = $1 ORDER BY id LIMIT %d`
+	selQ := fmt.Sprintf(selQFmt, q.tableName(), limit)
+	var jobs []*Job
+	err := ForQueryRows(ctx, q.db, selQ, jobDead, func(id int64, payload []byte, priority, attempts int) {
+		jobs = append(jobs, &Job{Queue: q, ID: id, Payload: payload, Priority: priority, Attempts: attempts})
+	})
+	return jobs, wrapf(err, "querying dead jobs")
+}
+
+// RetryDead returns the dead-lettered job with the given ID to the ready state,
+// with its attempts reset to zero.
+// If there is no such job in the dead-letter state,
+// the error is ErrJobNotDead.
+func (q *Queue) RetryDead(ctx context.Context, id int64) error {
+	const updQFmt = `UPDATE %s SET state = $1, run_at = $2, attempts = 0, claim_key = NULL WHERE id = $3 AND state = $4`
+	updQ := fmt.Sprintf(updQFmt, q.tableName())
+	res, err := q.db.ExecContext(ctx, updQ, jobReady, time.Now(), id, jobDead)
+	if err != nil {
+		return fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff == 0 {
+		return ErrJobNotDead
+	}
+	slogger(q.Slog).LogAttrs(ctx, slog.LevelInfo, "dead job retried", slog.String("queue", q.tableName()), slog.Int64("id", id))
+	if q.Notifier != nil {
+		return wrapf(q.Notifier.Notify(ctx, q.Channel(), ""), "notifying")
+	}
+	return nil
+}
+
+func (j *Job) checkClaim(res sql.Result) error {
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("counting affected rows: %w", err)
+	}
+	if aff == 0 {
+		return ErrJobNotClaimed
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package sqlutil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func newQueue(t *testing.T) *sqlutil.Queue {
+	return sqlutil.NewQueue(testdb.NewSQLite(t, testdb.DDL(
+		`CREATE TABLE jobs (
+			id INTEGER PRIMARY KEY,
+			payload BLOB,
+			priority INTEGER NOT NULL,
+			run_at DATETIME NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			state TEXT NOT NULL DEFAULT 'ready',
+			claim_key TEXT
+		)`,
+	)))
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	q := newQueue(t)
+
+	past := time.Now().Add(-time.Minute)
+	if err := q.Enqueue(ctx, []byte("low"), 1, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnqueueBatch(ctx, [][]byte{[]byte("high")}, 2, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(ctx, []byte("later"), 3, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	depth, err := q.Depth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth != 2 {
+		t.Errorf("got depth %d, want 2", depth)
+	}
+
+	job, err := q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Payload) != "high" || job.Attempts != 1 {
+		t.Errorf("got job %q with %d attempts, want high with 1", job.Payload, job.Attempts)
+	}
+	if err := job.Nack(ctx, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Ack(ctx); !errors.Is(err, sqlutil.ErrJobNotClaimed) {
+		t.Errorf("got error %v acking a nacked job, want %v", err, sqlutil.ErrJobNotClaimed)
+	}
+
+	job, err = q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Payload) != "high" || job.Attempts != 2 {
+		t.Errorf("got job %q with %d attempts, want high with 2", job.Payload, job.Attempts)
+	}
+	if err := job.Ack(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if job, err = q.Dequeue(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Payload) != "low" {
+		t.Errorf("got job %q, want low", job.Payload)
+	}
+	if _, err := q.Dequeue(ctx, time.Minute); !errors.Is(err, sqlutil.ErrNoJobs) {
+		t.Errorf("got error %v with no ready jobs, want %v", err, sqlutil.ErrNoJobs)
+	}
+}
+
+func TestQueueMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("nack", func(t *testing.T) {
+		q := newQueue(t)
+		q.MaxAttempts = 2
+		if err := q.Enqueue(ctx, []byte("x"), 0, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 2; i++ {
+			job, err := q.Dequeue(ctx, time.Minute)
+			if err != nil {
+				t.Fatalf("attempt %d: %s", i, err)
+			}
+			if job.Dead() != (i == 2) {
+				t.Errorf("attempt %d: got Dead() = %v", i, job.Dead())
+			}
+			if err := job.Nack(ctx, -time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := q.Dequeue(ctx, time.Minute); !errors.Is(err, sqlutil.ErrNoJobs) {
+			t.Errorf("got error %v after the last attempt, want %v", err, sqlutil.ErrNoJobs)
+		}
+		assertDeadJobs(t, q, 1)
+	})
+
+	t.Run("lapsed claim", func(t *testing.T) {
+		q := newQueue(t)
+		q.MaxAttempts = 2
+		if err := q.Enqueue(ctx, []byte("x"), 0, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The worker "crashes" each time: the job is neither acked nor nacked,
+		// and its (negative) visibility timeout lapses at once.
+		for i := 1; i <= 2; i++ {
+			if _, err := q.Dequeue(ctx, -time.Second); err != nil {
+				t.Fatalf("attempt %d: %s", i, err)
+			}
+		}
+		if _, err := q.Dequeue(ctx, -time.Second); !errors.Is(err, sqlutil.ErrNoJobs) {
+			t.Errorf("got error %v after the last attempt, want %v", err, sqlutil.ErrNoJobs)
+		}
+		if depth, err := q.Depth(ctx); err != nil || depth != 0 {
+			t.Errorf("got depth %d (error %v), want 0", depth, err)
+		}
+		jobs := assertDeadJobs(t, q, 1)
+
+		if err := q.RetryDead(ctx, jobs[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		job, err := q.Dequeue(ctx, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Attempts != 1 {
+			t.Errorf("got %d attempts after RetryDead, want 1", job.Attempts)
+		}
+		if err := q.RetryDead(ctx, job.ID); !errors.Is(err, sqlutil.ErrJobNotDead) {
+			t.Errorf("got error %v retrying a live job, want %v", err, sqlutil.ErrJobNotDead)
+		}
+	})
+}
+
+func assertDeadJobs(t *testing.T, q *sqlutil.Queue, want int) []*sqlutil.Job {
+	t.Helper()
+
+	jobs, err := q.DeadJobs(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != want {
+		t.Fatalf("got %d dead jobs, want %d", len(jobs), want)
+	}
+	return jobs
+}
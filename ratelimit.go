@@ -0,0 +1,140 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateLimiter implements fixed-window rate limits persisted in a database table,
+// so that limits can be shared among many processes.
+// Each key may be allowed up to Limit times in each Window-long interval.
+//
+// The rate-limit table must have these columns:
+//
+//	name          a string-compatible type, uniquely indexed
+//	window_start  a time.Time-compatible type
+//	hits          an integer
+type RateLimiter struct {
+	db DB
+
+	// Table is the name of the db table holding rate-limit info.
+	// The default if this is unspecified is "rate_limits".
+	Table string
+
+	// Limit is the number of events allowed per key per window.
+	// If it is zero or less,
+	// no events are allowed.
+	Limit int
+
+	// Window is the length of each rate-limiting interval.
+	// Windows are aligned to multiples of Window since the zero time
+	// (as with time.Time.Truncate).
+	// It must be positive.
+	Window time.Duration
+}
+
+const defaultRateLimitTable = "rate_limits"
+
+// NewRateLimiter produces a new RateLimiter allowing limit events per key in each window.
+func NewRateLimiter(db DB, limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{db: db, Limit: limit, Window: window}
+}
+
+func (r *RateLimiter) tableName() string {
+	if r.Table == "" {
+		return defaultRateLimitTable
+	}
+	return r.Table
+}
+
+// Allow records an event for key and tells whether it is within the limit.
+// An event that is not allowed is not counted.
+func (r *RateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	if r.Window <= 0 {
+		return false, fmt.Errorf("rate limit window %s is not positive", r.Window)
+	}
+	if r.Limit <= 0 {
+		return false, nil
+	}
+
+	windowStart := time.Now().Truncate(r.Window)
+
+	// Common case: the row exists and is in the current window.
+	const incrQFmt = `UPDATE %s SET hits = hits + 1 WHERE name = $1 AND window_start = $2 AND hits < $3`
+	incrQ := fmt.Sprintf(incrQFmt, r.tableName())
+	ok, err := r.execAffected(ctx, incrQ, key, windowStart, r.Limit)
+	if err != nil || ok {
+		return ok, wrapf(err, "incrementing hits")
+	}
+
+	// The row may exist from an earlier window.
+	const resetQFmt = `UPDATE %s SET window_start = $1, hits = 1 WHERE name = $2 AND window_start < $1`
+	resetQ := fmt.Sprintf(resetQFmt, r.tableName())
+	ok, err = r.execAffected(ctx, resetQ, windowStart, key)
+	if err != nil || ok {
+		return ok, wrapf(err, "starting new window")
+	}
+
+	// The row may not exist at all.
+	const insQFmt = `INSERT INTO %s (name, window_start, hits) VALUES ($1, $2, 1)`
+	insQ := fmt.Sprintf(insQFmt, r.tableName())
+	_, insErr := r.db.ExecContext(ctx, insQ, key, windowStart)
+	if insErr == nil {
+		return true, nil
+	}
+
+	// The insert failed.
+	// Perhaps another process inserted the row concurrently.
+	ok, err = r.execAffected(ctx, incrQ, key, windowStart, r.Limit)
+	if err != nil || ok {
+		return ok, wrapf(err, "incrementing hits")
+	}
+	const selQFmt = `SELECT hits FROM %s WHERE name = $1`
+	selQ := fmt.Sprintf(selQFmt, r.tableName())
+	var hits int
+	err = r.db.QueryRowContext(ctx, selQ, key).Scan(&hits)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, wrapf(insErr, "inserting into database")
+	}
+	// The row exists and the limit has been reached.
+	return false, wrapf(err, "querying hits")
+}
+
+func (r *RateLimiter) execAffected(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("counting affected rows: %w", err)
+	}
+	return aff > 0, nil
+}
+
+// Wait blocks until an event for key is allowed,
+// then records it.
+// It returns early with ctx.Err() if ctx is canceled first.
+func (r *RateLimiter) Wait(ctx context.Context, key string) error {
+	for {
+		ok, err := r.Allow(ctx, key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(r.Window).Add(r.Window).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
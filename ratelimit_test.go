@@ -0,0 +1,45 @@
+package sqlutil_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewSQLite(t, testdb.DDL("CREATE TABLE rate_limits (name TEXT PRIMARY KEY, window_start DATETIME NOT NULL, hits INTEGER NOT NULL)"))
+
+	r := sqlutil.NewRateLimiter(db, 2, time.Hour)
+	for i, want := range []bool{true, true, false, false} {
+		ok, err := r.Allow(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want {
+			t.Errorf("event %d: got allowed = %v, want %v", i+1, ok, want)
+		}
+	}
+	testdb.AssertExists(t, db, "rate_limits", "name = 'a' AND hits = 2")
+
+	if ok, err := r.Allow(ctx, "b"); err != nil || !ok {
+		t.Errorf("got (%v, %v) for a new key, want (true, nil)", ok, err)
+	}
+
+	r.Limit = 0
+	if ok, err := r.Allow(ctx, "c"); err != nil || ok {
+		t.Errorf("got (%v, %v) with a zero limit, want (false, nil)", ok, err)
+	}
+	testdb.AssertNotExists(t, db, "rate_limits", "name = 'c'")
+
+	r.Limit, r.Window = 2, 0
+	if _, err := r.Allow(ctx, "a"); err == nil {
+		t.Error("got no error with a zero window")
+	}
+	if err := r.Wait(ctx, "a"); err == nil {
+		t.Error("got no error from Wait with a zero window")
+	}
+}
@@ -0,0 +1,188 @@
+package sqlutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// deleteExpired deletes the rows of table whose expCol is earlier than now.
+// It returns the number of rows deleted.
+func deleteExpired(ctx context.Context, db ExecerContext, table, expCol string, now time.Time) (int64, error) {
+	const delQFmt = `DELETE FROM %s WHERE %s < $1`
+	delQ := fmt.Sprintf(delQFmt, table, expCol)
+	res, err := db.ExecContext(ctx, delQ, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// runExpirer calls deleteExpired every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func runExpirer(ctx context.Context, db ExecerContext, table, expCol string, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := deleteExpired(ctx, db, table, expCol, time.Now()); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
+
+// Reaper deletes expired rows from registered tables,
+// generalizing the expiry of leases, sessions, and key-value entries to any table with a timestamp column.
+// Rows are deleted in chunks with DeleteWhereChunked,
+// so that reaping a large backlog does not hold locks on
+// (or generate replication traffic for)
+// many rows at once.
+//
+// If the Reaper has a Lessor,
+// each pass holds a lease,
+// so that when many processes run the same Reaper
+// only one of them reaps at a time.
+type Reaper struct {
+	db     DB
+	lessor *Lessor
+
+	// LeaseName is the name of the lease acquired from the Lessor.
+	// The default if this is unspecified is "sqlutil.reaper".
+	LeaseName string
+
+	// LeaseDuration is how long the lease lasts.
+	// A pass stops with an error if its lease expires,
+	// and the next one resumes where it left off.
+	// The default if this is unspecified is 1 minute.
+	LeaseDuration time.Duration
+
+	// ChunkSize is the maximum number of rows deleted by each statement.
+	// The default if this is unspecified is 1000.
+	ChunkSize int
+
+	// Slog, if set, receives structured log records of the rows reaped.
+	// The default is the package-level logger set with SetSlog.
+	Slog *slog.Logger
+
+	mu      sync.Mutex
+	targets []reapTarget
+}
+
+type reapTarget struct {
+	table, col string
+	retention  time.Duration
+	opts       *ChunkOptions
+}
+
+const defaultReaperLeaseName = "sqlutil.reaper"
+
+// NewReaper produces a new Reaper.
+// If lessor is non-nil,
+// the Reaper coordinates with other processes through a lease obtained from it.
+func NewReaper(db DB, lessor *Lessor) *Reaper {
+	return &Reaper{db: db, lessor: lessor}
+}
+
+func (r *Reaper) leaseName() string {
+	if r.LeaseName == "" {
+		return defaultReaperLeaseName
+	}
+	return r.LeaseName
+}
+
+func (r *Reaper) leaseDuration() time.Duration {
+	if r.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return r.LeaseDuration
+}
+
+// Register adds a table to the Reaper.
+// Its rows whose col
+// (a time.Time-compatible column)
+// is more than retention in the past are expired.
+// A retention of zero expires rows as soon as col is in the past,
+// as for an expiration-time column.
+// The opts,
+// which may be nil,
+// are passed to DeleteWhereChunked;
+// they name the table's key column.
+func (r *Reaper) Register(table, col string, retention time.Duration, opts *ChunkOptions) {
+	r.mu.Lock()
+	r.targets = append(r.targets, reapTarget{table: table, col: col, retention: retention, opts: opts})
+	r.mu.Unlock()
+}
+
+// Reap deletes the expired rows of each registered table, once.
+// It returns the total number of rows deleted,
+// or zero and a nil error if another process holds the Reaper's lease.
+// A failure in one table does not prevent reaping the others;
+// the errors for all tables are joined with errors.Join.
+func (r *Reaper) Reap(ctx context.Context) (int64, error) {
+	if r.lessor != nil {
+		lease, err := r.lessor.Acquire(ctx, r.leaseName(), time.Now().Add(r.leaseDuration()))
+		if errors.Is(err, ErrLeaseHeld) {
+			// Another process is reaping.
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("acquiring reaper lease: %w", err)
+		}
+		defer lease.Release(ctx)
+
+		var cancel context.CancelFunc
+		ctx, cancel = lease.Context(ctx)
+		defer cancel()
+	}
+
+	r.mu.Lock()
+	targets := make([]reapTarget, len(r.targets))
+	copy(targets, r.targets)
+	r.mu.Unlock()
+
+	var (
+		total int64
+		errs  []error
+	)
+	for _, t := range targets {
+		start := time.Now()
+		cutoff := start.Add(-t.retention)
+		n, err := DeleteWhereChunked(ctx, r.db, t.table, t.col+" < $1", []interface{}{cutoff}, r.ChunkSize, t.opts)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reaping %s: %w", t.table, err))
+		}
+		if n > 0 {
+			slogger(r.Slog).LogAttrs(ctx, slog.LevelInfo, "rows reaped", slog.String("table", t.table), slog.Int64("rows", n), slog.Duration("duration", time.Since(start)))
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// Run calls Reap every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func (r *Reaper) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reap(ctx); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
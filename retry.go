@@ -0,0 +1,197 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy governs how an operation is retried:
+// how many times,
+// how long to wait between attempts,
+// and which errors are worth retrying.
+// It is used by Retry, WithTxRetry, Lessor.AcquireWait, Queue.DequeueWait, and Job.NackBackoff.
+// A nil *RetryPolicy is equivalent to a zero-valued one,
+// which retries retryable errors indefinitely
+// (until the context is canceled),
+// with exponential backoff from 100ms to 10s and 20% jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// A value of zero or less means no limit.
+	MaxAttempts int
+
+	// Base is the delay after the first failed attempt.
+	// The default if this is unspecified is 100ms.
+	Base time.Duration
+
+	// Max caps the delay between attempts.
+	// The default if this is unspecified is 10s.
+	Max time.Duration
+
+	// Multiplier is the factor by which the delay grows after each failed attempt.
+	// The default if this is unspecified is 2.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction of it,
+	// in either direction,
+	// so that many clients retrying at once do not stay in lockstep.
+	// The default if this is unspecified is 0.2.
+	// Use a negative value for no jitter.
+	Jitter float64
+
+	// Retryable tells whether an error is worth retrying.
+	// The default if this is unspecified is IsRetryable.
+	// (Lessor.AcquireWait and Queue.DequeueWait do not consult this;
+	// they retry only when the lease is held or no job is ready, respectively.)
+	Retryable func(error) bool
+}
+
+const (
+	defaultRetryBase       = 100 * time.Millisecond
+	defaultRetryMax        = 10 * time.Second
+	defaultRetryMultiplier = 2
+	defaultRetryJitter     = 0.2
+)
+
+// Delay returns how long to wait after attempt number n (starting at 1) fails.
+func (p *RetryPolicy) Delay(n int) time.Duration {
+	var (
+		base       = defaultRetryBase
+		max        = defaultRetryMax
+		multiplier = float64(defaultRetryMultiplier)
+		jitter     = defaultRetryJitter
+	)
+	if p != nil {
+		if p.Base > 0 {
+			base = p.Base
+		}
+		if p.Max > 0 {
+			max = p.Max
+		}
+		if p.Multiplier > 0 {
+			multiplier = p.Multiplier
+		}
+		if p.Jitter != 0 {
+			jitter = p.Jitter
+		}
+	}
+
+	d := float64(base)
+	for i := 1; i < n && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		d += d * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// more tells whether another attempt is allowed after attempt number n.
+func (p *RetryPolicy) more(n int) bool {
+	return p == nil || p.MaxAttempts <= 0 || n < p.MaxAttempts
+}
+
+// ShouldRetry tells whether to retry after attempt number n (starting at 1) fails with err.
+func (p *RetryPolicy) ShouldRetry(n int, err error) bool {
+	if !p.more(n) {
+		return false
+	}
+	if p != nil && p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// IsRetryable is the default classifier for RetryPolicy.
+// It reports true for errors marked with MarkRetryable,
+// for driver.ErrBadConn,
+// for errors with a Temporary method returning true,
+// and for errors with a SQLState method
+// (like those of the pgx driver)
+// reporting a serialization failure (40001) or deadlock (40P01).
+// It reports false for context cancellation and deadline errors.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrRetryable) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) && temp.Temporary() {
+		return true
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		switch state.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+	return false
+}
+
+// sleep waits for d or until ctx is canceled,
+// in which case it returns ctx.Err().
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Retry calls fn until it succeeds,
+// its error is not retryable,
+// the policy's attempts are exhausted,
+// or ctx is canceled.
+// It returns the error from the last attempt.
+func Retry(ctx context.Context, p *RetryPolicy, fn func(context.Context) error) error {
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil || !p.ShouldRetry(n, err) {
+			if err != nil && n > 1 {
+				debugState.retryGiveUps.Add(1)
+			}
+			return err
+		}
+		if sleep(ctx, p.Delay(n)) != nil {
+			debugState.retryGiveUps.Add(1)
+			return err
+		}
+		debugState.retries.Add(1)
+	}
+}
+
+// WithTxRetry calls fn in a transaction,
+// committing it if fn returns nil and rolling it back otherwise.
+// If fn or the commit fails with a retryable error
+// (such as a serialization failure),
+// the whole transaction is retried according to the policy.
+func WithTxRetry(ctx context.Context, db DB, p *RetryPolicy, fn func(*sql.Tx) error) error {
+	return Retry(ctx, p, func(ctx context.Context) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err = fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,99 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	p := &sqlutil.RetryPolicy{MaxAttempts: 3, Base: time.Millisecond, Jitter: -1}
+
+	t.Run("succeeds", func(t *testing.T) {
+		var n int
+		err := sqlutil.Retry(ctx, p, func(context.Context) error {
+			n++
+			if n < 3 {
+				return driver.ErrBadConn
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Errorf("got %d attempts, want 3", n)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		var n int
+		err := sqlutil.Retry(ctx, p, func(context.Context) error {
+			n++
+			return sqlutil.MarkRetryable(errors.New("again"))
+		})
+		if !errors.Is(err, sqlutil.ErrRetryable) {
+			t.Errorf("got error %v, want a retryable error", err)
+		}
+		if n != 3 {
+			t.Errorf("got %d attempts, want 3", n)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		var (
+			n       int
+			errFail = errors.New("fail")
+		)
+		err := sqlutil.Retry(ctx, p, func(context.Context) error {
+			n++
+			return errFail
+		})
+		if !errors.Is(err, errFail) {
+			t.Errorf("got error %v, want %v", err, errFail)
+		}
+		if n != 1 {
+			t.Errorf("got %d attempts, want 1", n)
+		}
+	})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := &sqlutil.RetryPolicy{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond, Jitter: -1}
+	want := []time.Duration{10, 20, 40, 50, 50}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w*time.Millisecond {
+			t.Errorf("Delay(%d) = %s, want %s", i+1, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("x"), false},
+		{driver.ErrBadConn, true},
+		{sqlutil.MarkRetryable(errors.New("x")), true},
+		{context.Canceled, false},
+		{sqlStateError("40001"), true},
+		{sqlStateError("23505"), false},
+	}
+	for _, tc := range cases {
+		if got := sqlutil.IsRetryable(tc.err); got != tc.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
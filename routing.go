@@ -0,0 +1,130 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// RoutingDB is a DB that sends reads to replicas and everything else to a primary.
+// QueryContext and QueryRowContext go to a healthy replica,
+// chosen round-robin.
+// ExecContext, PrepareContext, and Begin go to the primary.
+// If there are no healthy replicas,
+// or the context was produced by ForcePrimary,
+// reads go to the primary too.
+type RoutingDB struct {
+	primary  DB
+	replicas []DB
+	healthy  []int32 // accessed atomically; nonzero means healthy
+	next     uint32  // accessed atomically
+}
+
+// NewRoutingDB produces a RoutingDB with the given primary and replicas.
+// All replicas are initially considered healthy.
+func NewRoutingDB(primary DB, replicas ...DB) *RoutingDB {
+	healthy := make([]int32, len(replicas))
+	for i := range healthy {
+		healthy[i] = 1
+	}
+	return &RoutingDB{
+		primary:  primary,
+		replicas: replicas,
+		healthy:  healthy,
+	}
+}
+
+var forcePrimaryCtxkey = ctxkeytype("forceprimary")
+
+// ForcePrimary creates a child of the given context object
+// that causes RoutingDB to send reads to the primary.
+// Use it for read-after-write cases where replica lag would produce stale results.
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryCtxkey, true)
+}
+
+// IsForcePrimary tells whether ctx
+// (or some parent of ctx)
+// was produced by ForcePrimary.
+func IsForcePrimary(ctx context.Context) bool {
+	f, _ := ctx.Value(forcePrimaryCtxkey).(bool)
+	return f
+}
+
+// Primary returns the primary DB.
+func (r *RoutingDB) Primary() DB {
+	return r.primary
+}
+
+func (r *RoutingDB) reader(ctx context.Context) DB {
+	if IsForcePrimary(ctx) || len(r.replicas) == 0 {
+		return r.primary
+	}
+	start := atomic.AddUint32(&r.next, 1)
+	for i := 0; i < len(r.replicas); i++ {
+		idx := (int(start) + i) % len(r.replicas)
+		if atomic.LoadInt32(&r.healthy[idx]) != 0 {
+			return r.replicas[idx]
+		}
+	}
+	return r.primary
+}
+
+// CheckHealth pings each replica that implements PingerContext
+// and records whether it is healthy.
+// Replicas that do not implement PingerContext are always considered healthy.
+func (r *RoutingDB) CheckHealth(ctx context.Context) {
+	for i, replica := range r.replicas {
+		p, ok := replica.(PingerContext)
+		if !ok {
+			continue
+		}
+		var h int32
+		if err := p.PingContext(ctx); err == nil {
+			h = 1
+		}
+		atomic.StoreInt32(&r.healthy[i], h)
+	}
+}
+
+// RunHealthChecks calls CheckHealth every interval until ctx is canceled.
+// It returns ctx.Err().
+func (r *RoutingDB) RunHealthChecks(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PrepareContext implements PreparerContext.
+func (r *RoutingDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return r.primary.PrepareContext(ctx, query)
+}
+
+// QueryContext implements QueryerContext.
+func (r *RoutingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.reader(ctx).QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (r *RoutingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.reader(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements ExecerContext.
+func (r *RoutingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+// Begin begins a transaction on the primary.
+func (r *RoutingDB) Begin() (*sql.Tx, error) {
+	return r.primary.Begin()
+}
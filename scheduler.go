@@ -0,0 +1,218 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Scheduler runs registered jobs on schedules stored in a database table.
+// It uses a Lessor to ensure that,
+// when many processes run the same Scheduler,
+// exactly one of them fires each job at each scheduled time.
+//
+// The schedules table must have these columns:
+//
+//	name      a string-compatible type, uniquely indexed
+//	spec      a string-compatible type holding the schedule specification (see ParseSchedule)
+//	last_run  a time.Time-compatible type, nullable
+//	next_run  a time.Time-compatible type
+type Scheduler struct {
+	db     DB
+	lessor *Lessor
+
+	// Table is the name of the db table holding schedules.
+	// The default if this is unspecified is "schedules".
+	Table string
+
+	// LeaseDuration is how long a job's lease lasts while the job runs.
+	// The context passed to the job's callback has a deadline at the lease's expiration.
+	// The default if this is unspecified is 1 minute.
+	LeaseDuration time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
+}
+
+type scheduledJob struct {
+	spec  string
+	sched Schedule
+	fn    func(context.Context) error
+}
+
+const (
+	defaultSchedulerTable = "schedules"
+	defaultLeaseDuration  = time.Minute
+
+	schedulerLeasePrefix = "sqlutil.scheduler:"
+)
+
+// NewScheduler produces a new Scheduler.
+// It coordinates with other processes through leases obtained from lessor.
+func NewScheduler(db DB, lessor *Lessor) *Scheduler {
+	return &Scheduler{
+		db:     db,
+		lessor: lessor,
+		jobs:   make(map[string]*scheduledJob),
+	}
+}
+
+func (s *Scheduler) tableName() string {
+	if s.Table == "" {
+		return defaultSchedulerTable
+	}
+	return s.Table
+}
+
+func (s *Scheduler) leaseDuration() time.Duration {
+	if s.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return s.LeaseDuration
+}
+
+// Register adds a job to the Scheduler.
+// Its schedule is given by spec (see ParseSchedule).
+// The job's row in the schedules table is created or updated the next time Run polls.
+func (s *Scheduler) Register(name, spec string, fn func(context.Context) error) error {
+	sched, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("parsing schedule for %s: %w", name, err)
+	}
+	s.mu.Lock()
+	s.jobs[name] = &scheduledJob{spec: spec, sched: sched, fn: fn}
+	s.mu.Unlock()
+	return nil
+}
+
+// Run polls the schedules table every pollInterval,
+// running each registered job that is due,
+// until ctx is canceled.
+// Errors from individual jobs are passed to onErr,
+// which may be nil.
+// Run returns ctx.Err(),
+// or an error if polling the database fails.
+func (s *Scheduler) Run(ctx context.Context, pollInterval time.Duration, onErr func(name string, err error)) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Poll(ctx, onErr); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll runs each registered job that is due, once.
+// Errors from individual jobs are passed to onErr,
+// which may be nil.
+func (s *Scheduler) Poll(ctx context.Context, onErr func(name string, err error)) error {
+	s.mu.Lock()
+	jobs := make(map[string]*scheduledJob, len(s.jobs))
+	for name, job := range s.jobs {
+		jobs[name] = job
+	}
+	s.mu.Unlock()
+
+	for name, job := range jobs {
+		if err := s.sync(ctx, name, job); err != nil {
+			return fmt.Errorf("syncing schedule for %s: %w", name, err)
+		}
+		ran, err := s.runIfDue(ctx, name, job)
+		if err != nil && ran && onErr != nil {
+			onErr(name, err)
+		} else if err != nil && !ran {
+			return wrapf(err, "checking schedule for %s", name)
+		}
+	}
+	return nil
+}
+
+// sync makes sure the job's row exists and has the current spec.
+func (s *Scheduler) sync(ctx context.Context, name string, job *scheduledJob) error {
+	const selQFmt = `SELECT spec FROM %s WHERE name = $1`
+	selQ := fmt.Sprintf(selQFmt, s.tableName())
+
+	var spec string
+	err := s.db.QueryRowContext(ctx, selQ, name).Scan(&spec)
+	if errors.Is(err, sql.ErrNoRows) {
+		const insQFmt = `INSERT INTO %s (name, spec, next_run) VALUES ($1, $2, $3)`
+		insQ := fmt.Sprintf(insQFmt, s.tableName())
+		_, err = s.db.ExecContext(ctx, insQ, name, job.spec, job.sched.Next(time.Now()))
+		if err != nil {
+			// Perhaps a concurrent insert by another process.
+			// Check again.
+			err = s.db.QueryRowContext(ctx, selQ, name).Scan(&spec)
+		} else {
+			spec = job.spec
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if spec == job.spec {
+		return nil
+	}
+
+	const updQFmt = `UPDATE %s SET spec = $1, next_run = $2 WHERE name = $3`
+	updQ := fmt.Sprintf(updQFmt, s.tableName())
+	_, err = s.db.ExecContext(ctx, updQ, job.spec, job.sched.Next(time.Now()), name)
+	return err
+}
+
+// runIfDue runs the job if its next_run time has arrived and its lease can be acquired.
+// The boolean result tells whether the job's callback was invoked,
+// and so whether a non-nil error came from the callback.
+func (s *Scheduler) runIfDue(ctx context.Context, name string, job *scheduledJob) (bool, error) {
+	const selQFmt = `SELECT next_run FROM %s WHERE name = $1`
+	selQ := fmt.Sprintf(selQFmt, s.tableName())
+
+	var nextRun time.Time
+	if err := s.db.QueryRowContext(ctx, selQ, name).Scan(&nextRun); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if nextRun.IsZero() || nextRun.After(now) {
+		return false, nil
+	}
+
+	lease, err := s.lessor.Acquire(ctx, schedulerLeasePrefix+name, now.Add(s.leaseDuration()))
+	if errors.Is(err, ErrLeaseHeld) {
+		// Another process holds the lease and is running the job.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("acquiring lease: %w", err)
+	}
+	defer lease.Release(ctx)
+
+	// Check again now that the lease is held,
+	// in case another process ran the job and released its lease in the meantime.
+	if err := s.db.QueryRowContext(ctx, selQ, name).Scan(&nextRun); err != nil {
+		return false, err
+	}
+	if nextRun.IsZero() || nextRun.After(now) {
+		return false, nil
+	}
+
+	// Advance next_run before running the job.
+	// A job that fails is not retried until its next scheduled time.
+	const updQFmt = `UPDATE %s SET last_run = $1, next_run = $2 WHERE name = $3`
+	updQ := fmt.Sprintf(updQFmt, s.tableName())
+	if _, err := s.db.ExecContext(ctx, updQ, now, job.sched.Next(now), name); err != nil {
+		return false, err
+	}
+
+	jobCtx, cancel := lease.Context(ctx)
+	defer cancel()
+
+	return true, job.fn(jobCtx)
+}
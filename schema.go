@@ -0,0 +1,155 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaError is the error produced by ValidateSchema
+// when a table does not match a struct type.
+type SchemaError struct {
+	Table    string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("table %s does not match: %s", e.Table, strings.Join(e.Problems, "; "))
+}
+
+// ValidateSchema checks that the live table in db has a column for each field of the struct that v points to
+// (or the struct v itself),
+// with a compatible type and the same nullability,
+// as determined by the fields' `sql` struct tags
+// (see the package documentation and TableSQL).
+// Columns in the table with no corresponding field are allowed.
+//
+// Types are compared loosely,
+// by family (integer, floating-point, string, bytes, time, and boolean),
+// since databases report types differently from how they are declared.
+//
+// If the table does not match,
+// the error is a *SchemaError.
+func ValidateSchema(ctx context.Context, db QueryerContext, d Dialect, table string, v interface{}) error {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return fmt.Errorf("nil value")
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return err
+	}
+
+	cols, err := InspectColumns(ctx, db, d, table)
+	if err != nil {
+		return fmt.Errorf("inspecting table %s: %w", table, err)
+	}
+	if len(cols) == 0 {
+		return &SchemaError{Table: table, Problems: []string{"table does not exist or has no columns"}}
+	}
+	byName := make(map[string]ColumnInfo, len(cols))
+	for _, col := range cols {
+		byName[strings.ToLower(col.Name)] = col
+	}
+
+	var problems []string
+	for _, f := range fields {
+		col, ok := byName[strings.ToLower(f.column)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing column %s", f.column))
+			continue
+		}
+
+		typ, nullable := f.typ, f.nullable
+		if typ.Kind() == reflect.Ptr {
+			typ, nullable = typ.Elem(), true
+		}
+		if base, ok := nullTypes[typ]; ok {
+			typ, nullable = base, true
+		}
+		nullable = nullable && !f.pk
+
+		wantType := f.dbType
+		if wantType == "" {
+			wantType, err = columnType(d, typ)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.name, err)
+			}
+		}
+		if !typesCompatible(d, wantType, col.Type) {
+			problems = append(problems, fmt.Sprintf("column %s has type %s, want %s", f.column, col.Type, wantType))
+		}
+		if col.Nullable != nullable {
+			if nullable {
+				problems = append(problems, fmt.Sprintf("column %s is NOT NULL, want nullable", f.column))
+			} else {
+				problems = append(problems, fmt.Sprintf("column %s is nullable, want NOT NULL", f.column))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &SchemaError{Table: table, Problems: problems}
+	}
+	return nil
+}
+
+// typeFamily classifies a database column type.
+func typeFamily(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	switch {
+	case strings.HasPrefix(typ, "tinyint(1)"), strings.HasPrefix(typ, "bool"):
+		return "bool"
+	case isIntType(typ):
+		return "int"
+	case strings.HasPrefix(typ, "real"), strings.HasPrefix(typ, "float"), strings.HasPrefix(typ, "double"),
+		strings.HasPrefix(typ, "numeric"), strings.HasPrefix(typ, "decimal"):
+		return "float"
+	case strings.Contains(typ, "char"), strings.Contains(typ, "text"), strings.Contains(typ, "clob"):
+		return "string"
+	case strings.Contains(typ, "blob"), strings.HasPrefix(typ, "bytea"), strings.Contains(typ, "binary"):
+		return "bytes"
+	case strings.HasPrefix(typ, "timestamp"), strings.HasPrefix(typ, "datetime"), strings.HasPrefix(typ, "date"), strings.HasPrefix(typ, "time"):
+		return "time"
+	}
+	return typ
+}
+
+// intTypes are the base names of integer column types.
+var intTypes = map[string]bool{
+	"int": true, "integer": true, "tinyint": true, "smallint": true, "mediumint": true, "bigint": true,
+	"int2": true, "int4": true, "int8": true,
+	"serial": true, "smallserial": true, "bigserial": true, "serial2": true, "serial4": true, "serial8": true,
+}
+
+// isIntType tells whether typ
+// (in lower case)
+// is an integer type,
+// judging by its base name:
+// the part before any length or modifiers,
+// as in "int(11)" or "bigint unsigned".
+func isIntType(typ string) bool {
+	base := typ
+	if i := strings.IndexFunc(typ, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') }); i >= 0 {
+		base = typ[:i]
+	}
+	return intTypes[base]
+}
+
+// typesCompatible tells whether a live column type is compatible with the wanted type.
+func typesCompatible(d Dialect, want, got string) bool {
+	wf, gf := typeFamily(want), typeFamily(got)
+	if wf == gf {
+		return true
+	}
+	if d != Postgres {
+		// MySQL and SQLite store booleans as integers.
+		if (wf == "bool" && gf == "int") || (wf == "int" && gf == "bool") {
+			return true
+		}
+	}
+	return false
+}
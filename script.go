@@ -0,0 +1,117 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// ExecFile reads the SQL script at path in fsys
+// and executes it with ExecScript.
+// This is convenient for loading schema and seed data from testdata directories.
+func ExecFile(ctx context.Context, db ExecerContext, fsys fs.FS, path string) error {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return wrapf(ExecScript(ctx, db, string(b)), "%s", path)
+}
+
+// ExecScript splits sqlText into statements with SplitStatements
+// and executes them in order,
+// stopping at the first error.
+func ExecScript(ctx context.Context, db ExecerContext, sqlText string) error {
+	for i, stmt := range SplitStatements(sqlText) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("executing statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// SplitStatements splits sqlText into statements at semicolons.
+// Semicolons inside string literals, quoted identifiers, comments,
+// and Postgres dollar-quoted strings
+// (as in function bodies: $$ ... $$ or $tag$ ... $tag$)
+// do not split statements.
+// The statements are trimmed of surrounding whitespace,
+// and any that are empty
+// (or contain only comments)
+// are omitted.
+//
+// Statements whose bodies contain bare semicolons,
+// like MySQL triggers with BEGIN ... END blocks,
+// are not supported.
+func SplitStatements(sqlText string) []string {
+	var (
+		result     []string
+		start      int
+		hasContent bool
+	)
+	add := func(end int) {
+		if hasContent {
+			result = append(result, strings.TrimSpace(sqlText[start:end]))
+		}
+		start, hasContent = end+1, false
+	}
+	for i := 0; i < len(sqlText); {
+		c := sqlText[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sqlText, i, c)
+			hasContent = true
+		case c == '-' && strings.HasPrefix(sqlText[i:], "--"):
+			if j := strings.IndexByte(sqlText[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(sqlText)
+			}
+		case c == '/' && strings.HasPrefix(sqlText[i:], "/*"):
+			if j := strings.Index(sqlText[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(sqlText)
+			}
+		case c == '$':
+			i = skipDollarQuoted(sqlText, i)
+			hasContent = true
+		case c == ';':
+			add(i)
+			i++
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasContent = true
+			}
+			i++
+		}
+	}
+	add(len(sqlText))
+	return result
+}
+
+// skipDollarQuoted returns the index just past the dollar-quoted string beginning at s[i],
+// or just past the $ if it does not begin one
+// (e.g. when it is a $1 placeholder
+// or part of an identifier).
+func skipDollarQuoted(s string, i int) int {
+	if i > 0 && isIdentByte(s[i-1]) {
+		return i + 1
+	}
+	j := i + 1
+	for j < len(s) && isIdentByte(s[j]) {
+		j++
+	}
+	if j >= len(s) || s[j] != '$' || (j > i+1 && s[i+1] >= '0' && s[i+1] <= '9') {
+		return i + 1
+	}
+	delim := s[i : j+1]
+	if k := strings.Index(s[j+1:], delim); k >= 0 {
+		return j + 1 + k + len(delim)
+	}
+	return len(s)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -0,0 +1,131 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SessionStore stores HTTP session data in a database table.
+// Its Find, Commit, and Delete methods
+// (and their context-taking variants FindCtx, CommitCtx, and DeleteCtx)
+// match the store interfaces of common session middlewares,
+// such as github.com/alexedwards/scs.
+// Commit uses INSERT ... ON CONFLICT,
+// as supported by Postgres and SQLite.
+//
+// The sessions table must have these columns:
+//
+//	token   a string-compatible type capable of storing a 32-byte string, uniquely indexed
+//	data    a []byte-compatible type (like BLOB or BYTEA)
+//	expiry  a time.Time-compatible type (like DATETIME); for performance, it should be indexed
+type SessionStore struct {
+	db DB
+
+	// Table is the name of the db table holding sessions.
+	// The default if this is unspecified is "sessions".
+	Table string
+}
+
+const defaultSessionTable = "sessions"
+
+// NewSessionStore produces a new SessionStore.
+func NewSessionStore(db DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+func (s *SessionStore) tableName() string {
+	if s.Table == "" {
+		return defaultSessionTable
+	}
+	return s.Table
+}
+
+// Create stores a new session with the given data,
+// expiring after ttl,
+// and returns its newly generated token.
+func (s *SessionStore) Create(ctx context.Context, data []byte, ttl time.Duration) (string, error) {
+	token, err := newKey()
+	if err != nil {
+		return "", fmt.Errorf("computing token: %w", err)
+	}
+	const insQFmt = `INSERT INTO %s (token, data, expiry) VALUES ($1, $2, $3)`
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(insQFmt, s.tableName()), token, data, time.Now().Add(ttl))
+	return token, wrapf(err, "inserting into database")
+}
+
+// FindCtx returns the data of the session with the given token.
+// The boolean result is false if there is no such session or it has expired.
+func (s *SessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	const selQFmt = `SELECT data FROM %s WHERE token = $1 AND expiry > $2`
+	var data []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(selQFmt, s.tableName()), token, time.Now()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("querying database: %w", err)
+	}
+	return data, true, nil
+}
+
+// CommitCtx stores the data of the session with the given token,
+// creating or replacing it,
+// and sets its expiration time.
+func (s *SessionStore) CommitCtx(ctx context.Context, token string, data []byte, expiry time.Time) error {
+	const upsQFmt = `INSERT INTO %s (token, data, expiry) VALUES ($1, $2, $3)` +
+		` ON CONFLICT (token) DO UPDATE SET data = EXCLUDED.data, expiry = EXCLUDED.expiry`
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(upsQFmt, s.tableName()), token, data, expiry)
+	return wrapf(err, "upserting into database")
+}
+
+// Touch extends the expiration of the session with the given token to ttl from now.
+// The boolean result is false if there is no such session or it has already expired.
+func (s *SessionStore) Touch(ctx context.Context, token string, ttl time.Duration) (bool, error) {
+	const updQFmt = `UPDATE %s SET expiry = $1 WHERE token = $2 AND expiry > $3`
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(updQFmt, s.tableName()), now.Add(ttl), token, now)
+	if err != nil {
+		return false, fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff > 0, wrapf(err, "counting affected rows")
+}
+
+// DeleteCtx deletes the session with the given token.
+// It is not an error if there is no such session.
+func (s *SessionStore) DeleteCtx(ctx context.Context, token string) error {
+	const delQFmt = `DELETE FROM %s WHERE token = $1`
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(delQFmt, s.tableName()), token)
+	return wrapf(err, "deleting from database")
+}
+
+// Find is FindCtx with a background context.
+func (s *SessionStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// Commit is CommitCtx with a background context.
+func (s *SessionStore) Commit(token string, data []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, data, expiry)
+}
+
+// Delete is DeleteCtx with a background context.
+func (s *SessionStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// DeleteExpired deletes expired sessions from the table.
+func (s *SessionStore) DeleteExpired(ctx context.Context) error {
+	_, err := deleteExpired(ctx, s.db, s.tableName(), "expiry", time.Now())
+	return wrapf(err, "deleting expired sessions")
+}
+
+// RunExpirer deletes expired sessions every interval until ctx is canceled.
+// Errors are passed to onErr,
+// which may be nil.
+func (s *SessionStore) RunExpirer(ctx context.Context, interval time.Duration, onErr func(error)) {
+	runExpirer(ctx, s.db, s.tableName(), "expiry", interval, onErr)
+}
@@ -0,0 +1,199 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// Sharded is a DB that routes each operation to one of several shards,
+// based on a shard key carried in the context
+// (see WithShardKey).
+// Use Shard to select a shard by explicit key,
+// and ForEachShard and ForQueryRowsShards for cross-shard operations.
+type Sharded struct {
+	shards    []DB
+	shardFunc func(key string, n int) int
+}
+
+// ErrNoShardKey is the error produced by Sharded when the context carries no shard key.
+var ErrNoShardKey = errors.New("no shard key in context")
+
+// NewSharded produces a new Sharded.
+// The shardFunc maps a shard key to the index of a shard in [0, n).
+// If it is nil,
+// HashShard is used.
+// There must be at least one shard.
+func NewSharded(shardFunc func(key string, n int) int, shards ...DB) (*Sharded, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shards")
+	}
+	if shardFunc == nil {
+		shardFunc = HashShard
+	}
+	return &Sharded{shards: shards, shardFunc: shardFunc}, nil
+}
+
+// HashShard maps key to a shard index in [0, n) using a hash function.
+// It panics if n is not positive.
+func HashShard(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+var shardKeyCtxkey = ctxkeytype("shardkey")
+
+// WithShardKey creates a child of the given context object containing a shard key,
+// which Sharded uses to route operations.
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKeyCtxkey, key)
+}
+
+// GetShardKey extracts the shard key previously stored in ctx
+// (or some parent of ctx)
+// with WithShardKey.
+// The boolean result tells whether there is one.
+func GetShardKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(shardKeyCtxkey).(string)
+	return key, ok
+}
+
+// NumShards returns the number of shards.
+func (s *Sharded) NumShards() int {
+	return len(s.shards)
+}
+
+// Shard returns the shard for the given key.
+func (s *Sharded) Shard(key string) DB {
+	return s.shards[s.shardFunc(key, len(s.shards))]
+}
+
+func (s *Sharded) route(ctx context.Context) (DB, error) {
+	key, ok := GetShardKey(ctx)
+	if !ok {
+		return nil, ErrNoShardKey
+	}
+	return s.Shard(key), nil
+}
+
+// PrepareContext implements PreparerContext.
+// The statement is prepared on the shard selected by the context's shard key.
+func (s *Sharded) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	db, err := s.route(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.PrepareContext(ctx, query)
+}
+
+// QueryContext implements QueryerContext.
+// The query runs on the shard selected by the context's shard key.
+func (s *Sharded) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db, err := s.route(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements QueryerContext.
+// The query runs on the shard selected by the context's shard key.
+// If the context has no shard key,
+// the Row's Scan method returns ErrNoShardKey.
+func (s *Sharded) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	db, err := s.route(ctx)
+	if err != nil {
+		return noShardKeyDB().QueryRowContext(ctx, query, args...)
+	}
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+// noShardKeyDB returns a *sql.DB whose every connection attempt fails with ErrNoShardKey.
+// It exists to produce a *sql.Row carrying that error,
+// which cannot be constructed directly.
+// It is created on first use,
+// so that programs that never need it do not start its connection-opener goroutine.
+var noShardKeyDB = sync.OnceValue(func() *sql.DB {
+	return sql.OpenDB(errConnector{err: ErrNoShardKey})
+})
+
+// errRow returns a *sql.Row whose Scan method returns err.
+func errRow(err error) *sql.Row {
+	db := sql.OpenDB(errConnector{err: err})
+	defer db.Close()
+	return db.QueryRowContext(context.Background(), "")
+}
+
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) { return nil, c.err }
+func (c errConnector) Driver() driver.Driver                        { return errDriver(c) }
+
+type errDriver struct {
+	err error
+}
+
+func (d errDriver) Open(string) (driver.Conn, error) { return nil, d.err }
+
+// ExecContext implements ExecerContext.
+// The statement runs on the shard selected by the context's shard key.
+func (s *Sharded) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db, err := s.route(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, query, args...)
+}
+
+// Begin always fails with ErrNoShardKey,
+// since it has no context from which to get a shard key.
+// Use s.Shard(key).Begin() instead.
+func (s *Sharded) Begin() (*sql.Tx, error) {
+	return nil, ErrNoShardKey
+}
+
+// ForEachShard calls fn concurrently for each shard,
+// passing its index and handle.
+// It waits for all calls to finish,
+// then returns the error from the lowest-numbered shard whose call failed,
+// if any.
+func (s *Sharded) ForEachShard(ctx context.Context, fn func(ctx context.Context, i int, db DB) error) error {
+	errs := make([]error, len(s.shards))
+
+	var wg sync.WaitGroup
+	for i, db := range s.shards {
+		wg.Add(1)
+		go func(i int, db DB) {
+			defer wg.Done()
+			errs[i] = fn(ctx, i, db)
+		}(i, db)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ForQueryRowsShards runs ForQueryRows with the same query on each shard in turn.
+// The args are as for ForQueryRows,
+// ending with the per-row callback,
+// which is never called concurrently.
+func (s *Sharded) ForQueryRowsShards(ctx context.Context, query string, args ...interface{}) error {
+	for i, db := range s.shards {
+		if err := ForQueryRows(ctx, db, query, args...); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package sqlutil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+func TestSharded(t *testing.T) {
+	if _, err := sqlutil.NewSharded(nil); err == nil {
+		t.Error("got no error from NewSharded with no shards")
+	}
+
+	mocks := []*sqlmockutil.Mock{sqlmockutil.New(), sqlmockutil.New()}
+	for i, m := range mocks {
+		defer m.Close()
+		m.AddRows("SELECT shard", []string{"shard"}, [][]interface{}{{i}})
+	}
+	s, err := sqlutil.NewSharded(func(key string, n int) int {
+		if key == "b" {
+			return 1
+		}
+		return 0
+	}, mocks[0].DB(), mocks[1].DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	var shard int
+	if err := s.QueryRowContext(ctx, "SELECT shard").Scan(&shard); !errors.Is(err, sqlutil.ErrNoShardKey) {
+		t.Errorf("got error %v without a shard key, want %v", err, sqlutil.ErrNoShardKey)
+	}
+	if err := s.QueryRowContext(sqlutil.WithShardKey(ctx, "b"), "SELECT shard").Scan(&shard); err != nil {
+		t.Fatal(err)
+	}
+	if shard != 1 {
+		t.Errorf("got shard %d for key b, want 1", shard)
+	}
+}
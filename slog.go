@@ -0,0 +1,40 @@
+package sqlutil
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+var pkgSlog atomic.Pointer[slog.Logger]
+
+// SetSlog sets the package-level structured logger,
+// used by LoggingDB, Lessor, Queue, and Migrator when they have no logger of their own.
+// The default,
+// or if l is nil,
+// is to log nothing.
+func SetSlog(l *slog.Logger) {
+	pkgSlog.Store(l)
+}
+
+// slogger returns l if it is not nil,
+// and otherwise the package-level logger
+// (which discards everything if it is unset).
+func slogger(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	if l = pkgSlog.Load(); l != nil {
+		return l
+	}
+	return discardSlog
+}
+
+var discardSlog = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
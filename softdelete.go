@@ -0,0 +1,241 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultSoftDeleteColumn is the column used by the soft-delete helpers
+// to record when a row was deleted.
+// It must have a nullable time.Time-compatible type (like DATETIME);
+// NULL means the row is not deleted.
+const DefaultSoftDeleteColumn = "deleted_at"
+
+// SoftDelete marks the rows of table matching where
+// (with placeholders $1, $2, ... for args)
+// as deleted,
+// by setting their deleted_at column to the current time.
+// An empty where matches every row.
+// Rows already marked deleted are unaffected.
+// It returns the number of rows marked.
+func SoftDelete(ctx context.Context, db ExecerContext, table, where string, args ...interface{}) (int64, error) {
+	if where == "" {
+		where = "1 = 1"
+	}
+
+	// The timestamp is $1,
+	// ahead of the caller's placeholders in the query text as well as in number,
+	// since SQLite numbers $N parameters in order of appearance.
+	const updQFmt = `UPDATE %[1]s SET %[2]s = $1 WHERE (%[3]s) AND %[2]s IS NULL`
+	updQ := fmt.Sprintf(updQFmt, table, DefaultSoftDeleteColumn, shiftPlaceholders(where, 1))
+	res, err := db.ExecContext(ctx, updQ, append([]interface{}{time.Now()}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff, wrapf(err, "counting affected rows")
+}
+
+// Restore undoes SoftDelete for the rows of table matching where
+// (with placeholders $1, $2, ... for args).
+// It returns the number of rows restored.
+func Restore(ctx context.Context, db ExecerContext, table, where string, args ...interface{}) (int64, error) {
+	if where == "" {
+		where = "1 = 1"
+	}
+	const updQFmt = `UPDATE %[1]s SET %[2]s = NULL WHERE (%[3]s) AND %[2]s IS NOT NULL`
+	updQ := fmt.Sprintf(updQFmt, table, DefaultSoftDeleteColumn, where)
+	res, err := db.ExecContext(ctx, updQ, args...)
+	if err != nil {
+		return 0, fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff, wrapf(err, "counting affected rows")
+}
+
+// PurgeOlderThan permanently deletes the rows of table that were soft-deleted more than age ago.
+// It returns the number of rows deleted.
+func PurgeOlderThan(ctx context.Context, db ExecerContext, table string, age time.Duration) (int64, error) {
+	n, err := deleteExpired(ctx, db, table, DefaultSoftDeleteColumn, time.Now().Add(-age))
+	return n, wrapf(err, "deleting from database")
+}
+
+var withDeletedCtxkey = ctxkeytype("withdeleted")
+
+// WithDeleted creates a child of the given context object in which SoftDeleteDB does not rewrite queries,
+// so soft-deleted rows are visible.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedCtxkey, true)
+}
+
+// SoftDeleteDB is a DB that hides soft-deleted rows,
+// by adding "deleted_at IS NULL" to the WHERE clause of SELECT queries on the tables it manages.
+// Only simple queries are rewritten:
+// the query must begin with SELECT,
+// its first FROM item must be one of the managed tables,
+// and it must have no top-level JOIN or set operation (UNION, INTERSECT, EXCEPT).
+// Other queries,
+// and queries in contexts produced by WithDeleted,
+// are passed through unchanged.
+type SoftDeleteDB struct {
+	DB
+	tables map[string]bool
+}
+
+// NewSoftDeleteDB produces a SoftDeleteDB wrapping db
+// that manages the given tables.
+func NewSoftDeleteDB(db DB, tables ...string) *SoftDeleteDB {
+	m := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		m[strings.ToLower(t)] = true
+	}
+	return &SoftDeleteDB{DB: db, tables: m}
+}
+
+// QueryContext implements QueryerContext.
+func (s *SoftDeleteDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.QueryContext(ctx, s.rewrite(ctx, query), args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (s *SoftDeleteDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRowContext(ctx, s.rewrite(ctx, query), args...)
+}
+
+// PrepareContext implements PreparerContext.
+func (s *SoftDeleteDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return s.DB.PrepareContext(ctx, s.rewrite(ctx, query))
+}
+
+func (s *SoftDeleteDB) rewrite(ctx context.Context, query string) string {
+	if d, _ := ctx.Value(withDeletedCtxkey).(bool); d {
+		return query
+	}
+	words := topLevelWords(query)
+	if len(words) == 0 || words[0].word != "select" {
+		return query
+	}
+
+	var (
+		fromIdx   = -1
+		whereIdx  = -1
+		clauseIdx = -1
+	)
+	for i, w := range words {
+		switch w.word {
+		case "join", "union", "intersect", "except":
+			return query
+		case "from":
+			if fromIdx < 0 {
+				fromIdx = i
+			}
+		case "where":
+			if fromIdx >= 0 && whereIdx < 0 {
+				whereIdx = i
+			}
+		case "group", "having", "order", "limit", "offset", "fetch", "for", "window":
+			if fromIdx >= 0 && clauseIdx < 0 {
+				clauseIdx = i
+			}
+		}
+	}
+	if fromIdx < 0 || fromIdx+1 >= len(words) {
+		return query
+	}
+	if !s.tables[strings.Trim(words[fromIdx+1].word, `"`+"`")] {
+		return query
+	}
+
+	end := len(query)
+	if clauseIdx >= 0 {
+		end = words[clauseIdx].pos
+	}
+	var rest string
+	if end < len(query) {
+		rest = " " + query[end:]
+	}
+	cond := DefaultSoftDeleteColumn + " IS NULL"
+	if whereIdx >= 0 {
+		start := words[whereIdx].pos + len("where")
+		return query[:start] + " (" + strings.TrimSpace(query[start:end]) + ") AND " + cond + rest
+	}
+	return strings.TrimRightFunc(query[:end], unicode.IsSpace) + " WHERE " + cond + rest
+}
+
+type sqlWord struct {
+	word string // lowercased
+	pos  int
+}
+
+// topLevelWords returns the words
+// (identifiers and keywords,
+// including quoted identifiers)
+// in query that are not inside parentheses, string literals, or comments.
+func topLevelWords(query string) []sqlWord {
+	var (
+		words []sqlWord
+		depth int
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, '\'')
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+		case c == '"' || c == '`':
+			j := skipQuoted(query, i, c)
+			if depth == 0 {
+				words = append(words, sqlWord{word: strings.ToLower(query[i:j]), pos: i})
+			}
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(query) && (query[j] == '_' || query[j] == '.' || unicode.IsLetter(rune(query[j])) || unicode.IsDigit(rune(query[j]))) {
+				j++
+			}
+			if depth == 0 {
+				words = append(words, sqlWord{word: strings.ToLower(query[i:j]), pos: i})
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return words
+}
+
+// skipQuoted returns the index just past the quoted string beginning at query[i],
+// where a doubled quote character is an escaped quote.
+func skipQuoted(query string, i int, q byte) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] == q {
+			if j+1 < len(query) && query[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
@@ -0,0 +1,58 @@
+package sqlutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db := testdb.NewSQLite(t, testdb.DDL(
+		"CREATE TABLE docs (id INTEGER PRIMARY KEY, owner TEXT NOT NULL, deleted_at DATETIME)",
+		"INSERT INTO docs (id, owner) VALUES (1, 'alice'), (2, 'alice'), (3, 'bob')",
+	))
+
+	n, err := sqlutil.SoftDelete(ctx, db, "docs", "owner = $1 AND id > $2", "alice", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("marked %d rows, want 1", n)
+	}
+	testdb.AssertExists(t, db, "docs", "id = 2 AND deleted_at IS NOT NULL")
+	testdb.AssertRowCount(t, db, "docs", "deleted_at IS NULL", 2)
+
+	var count int
+	sd := sqlutil.NewSoftDeleteDB(db, "docs")
+	if err := sd.QueryRowContext(ctx, "SELECT COUNT(*) FROM docs").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("SoftDeleteDB counted %d rows, want 2", count)
+	}
+	if err := sd.QueryRowContext(sqlutil.WithDeleted(ctx), "SELECT COUNT(*) FROM docs").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("SoftDeleteDB counted %d rows with WithDeleted, want 3", count)
+	}
+
+	// An empty where matches every row not already marked.
+	if n, err = sqlutil.SoftDelete(ctx, db, "docs", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("marked %d rows, want 2", n)
+	}
+
+	if n, err = sqlutil.Restore(ctx, db, "docs", "owner = $1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("restored %d rows, want 2", n)
+	}
+	testdb.AssertRowCount(t, db, "docs", "deleted_at IS NULL", 2)
+}
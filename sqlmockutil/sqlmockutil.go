@@ -0,0 +1,290 @@
+// Package sqlmockutil provides an in-memory stand-in for a database,
+// for unit-testing code written against the interfaces in package sqlutil
+// without a live database or a third-party mock.
+//
+// A Mock serves canned results for the statements it is told about,
+// and records every statement it receives.
+// Its DB method returns a real *sql.DB
+// (backed by an in-memory driver),
+// which satisfies sqlutil.DB.
+package sqlmockutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Mock is an in-memory database that serves canned results.
+// Statements are matched by their text,
+// with runs of whitespace treated as a single space.
+type Mock struct {
+	db *sql.DB
+
+	mu         sync.Mutex
+	responses  map[string]*response
+	statements []Statement
+}
+
+type response struct {
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertID int64
+	rowsAffected int64
+	err          error
+}
+
+// Statement is a statement received by a Mock.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// New produces a new Mock.
+func New() *Mock {
+	m := &Mock{responses: make(map[string]*response)}
+	m.db = sql.OpenDB(connector{m: m})
+	return m
+}
+
+// DB returns a *sql.DB that sends its statements to m.
+func (m *Mock) DB() *sql.DB {
+	return m.db
+}
+
+// Close closes m's DB.
+func (m *Mock) Close() error {
+	return m.db.Close()
+}
+
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// AddRows sets the rows returned by query,
+// each row a slice of values for the given columns.
+// Values are converted as by database/sql/driver.DefaultParameterConverter;
+// AddRows panics if a value cannot be converted.
+func (m *Mock) AddRows(query string, columns []string, rows [][]interface{}) {
+	dvRows := make([][]driver.Value, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			panic(fmt.Sprintf("row has %d values for %d columns", len(row), len(columns)))
+		}
+		dvRow := make([]driver.Value, len(row))
+		for i, v := range row {
+			dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Sprintf("converting value: %s", err))
+			}
+			dvRow[i] = dv
+		}
+		dvRows = append(dvRows, dvRow)
+	}
+	m.mu.Lock()
+	m.responses[normalize(query)] = &response{columns: columns, rows: dvRows}
+	m.mu.Unlock()
+}
+
+// AddResult sets the result of executing query.
+func (m *Mock) AddResult(query string, lastInsertID, rowsAffected int64) {
+	m.mu.Lock()
+	m.responses[normalize(query)] = &response{lastInsertID: lastInsertID, rowsAffected: rowsAffected}
+	m.mu.Unlock()
+}
+
+// AddError causes query to fail with err.
+func (m *Mock) AddError(query string, err error) {
+	m.mu.Lock()
+	m.responses[normalize(query)] = &response{err: err}
+	m.mu.Unlock()
+}
+
+// Statements returns the statements m has received, in order,
+// including "BEGIN", "COMMIT", and "ROLLBACK" for transactions.
+func (m *Mock) Statements() []Statement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Statement(nil), m.statements...)
+}
+
+// Reset forgets the statements m has received.
+// Canned results are retained.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	m.statements = nil
+	m.mu.Unlock()
+}
+
+func (m *Mock) handle(query string, args []driver.NamedValue) (*response, error) {
+	vals := make([]interface{}, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.statements = append(m.statements, Statement{Query: query, Args: vals})
+	resp, ok := m.responses[normalize(query)]
+	if !ok {
+		return nil, fmt.Errorf("sqlmockutil: no canned result for %q", query)
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return resp, nil
+}
+
+func (m *Mock) record(query string) {
+	m.mu.Lock()
+	m.statements = append(m.statements, Statement{Query: query})
+	m.mu.Unlock()
+}
+
+type connector struct {
+	m *Mock
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{m: c.m}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return drv{m: c.m}
+}
+
+type drv struct {
+	m *Mock
+}
+
+func (d drv) Open(string) (driver.Conn, error) {
+	return &conn{m: d.m}, nil
+}
+
+type conn struct {
+	m *Mock
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{c: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.m.record("BEGIN")
+	return tx{m: c.m}, nil
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c.Begin()
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	resp, err := c.m.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: resp.columns, rows: resp.rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	resp, err := c.m.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result{lastInsertID: resp.lastInsertID, rowsAffected: resp.rowsAffected}, nil
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return nv
+}
+
+type tx struct {
+	m *Mock
+}
+
+func (t tx) Commit() error {
+	t.m.record("COMMIT")
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.m.record("ROLLBACK")
+	return nil
+}
+
+type result struct {
+	lastInsertID, rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
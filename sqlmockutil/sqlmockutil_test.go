@@ -0,0 +1,85 @@
+package sqlmockutil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+func TestMock(t *testing.T) {
+	ctx := context.Background()
+
+	m := sqlmockutil.New()
+	defer m.Close()
+
+	m.AddRows("SELECT id, name FROM people WHERE age > $1", []string{"id", "name"}, [][]interface{}{
+		{1, "alice"},
+		{2, "bob"},
+	})
+	m.AddResult("DELETE FROM people WHERE id = $1", 0, 1)
+
+	errBoom := errors.New("boom")
+	m.AddError("DELETE FROM pets", errBoom)
+
+	var names []string
+	err := sqlutil.ForQueryRows(ctx, m.DB(), "SELECT id, name\n  FROM people WHERE age > $1", 30, func(id int64, name string) {
+		names = append(names, name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("got names %v, want [alice bob]", names)
+	}
+
+	tx, err := m.DB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM people WHERE id = $1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("got rows affected %d, %v, want 1, nil", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.DB().ExecContext(ctx, "DELETE FROM pets"); !errors.Is(err, errBoom) {
+		t.Errorf("got error %v, want %v", err, errBoom)
+	}
+	if _, err := m.DB().ExecContext(ctx, "DELETE FROM cars"); err == nil {
+		t.Error("got no error for a statement with no canned result")
+	}
+
+	want := []string{
+		"SELECT id, name\n  FROM people WHERE age > $1",
+		"BEGIN",
+		"DELETE FROM people WHERE id = $1",
+		"COMMIT",
+		"DELETE FROM pets",
+		"DELETE FROM cars",
+	}
+	stmts := m.Statements()
+	if len(stmts) != len(want) {
+		t.Fatalf("got %d statements, want %d: %v", len(stmts), len(want), stmts)
+	}
+	for i, s := range stmts {
+		if s.Query != want[i] {
+			t.Errorf("statement %d: got %q, want %q", i, s.Query, want[i])
+		}
+	}
+	if args := stmts[0].Args; len(args) != 1 || args[0] != int64(30) {
+		t.Errorf("got args %v for the first statement, want [30]", args)
+	}
+
+	m.Reset()
+	if stmts := m.Statements(); len(stmts) != 0 {
+		t.Errorf("got %d statements after Reset, want 0", len(stmts))
+	}
+}
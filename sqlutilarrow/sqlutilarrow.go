@@ -0,0 +1,336 @@
+// Package sqlutilarrow exports SQL query results as Apache Arrow record batches
+// and Parquet files,
+// for feeding analytics pipelines.
+//
+// Each result column maps to one of a small set of Arrow types,
+// chosen from the column's scan type
+// or, failing that, its database type name:
+//
+//	integers                  int64
+//	floating-point numbers    float64
+//	booleans                  bool
+//	timestamps and dates      timestamp (microseconds, UTC)
+//	binary (BLOB, BYTEA)      binary
+//	everything else           utf8 (including NUMERIC and DECIMAL, to preserve precision)
+//
+// All columns are nullable.
+//
+// This is a separate module so that importers of sqlutil do not acquire a dependency on Arrow and Parquet.
+package sqlutilarrow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+
+	"github.com/bobg/sqlutil"
+)
+
+// Options are options for Export and ExportParquet.
+// A nil *Options is equivalent to a zero one.
+type Options struct {
+	// BatchSize is the maximum number of rows in each record batch.
+	// The default if this is unspecified is 10,000.
+	BatchSize int
+
+	// Allocator allocates the memory of record batches.
+	// The default if this is unspecified is memory.DefaultAllocator.
+	Allocator memory.Allocator
+
+	// ParquetProps are the Parquet writer properties used by ExportParquet.
+	// The default if this is unspecified is parquet.NewWriterProperties().
+	ParquetProps *parquet.WriterProperties
+}
+
+const defaultBatchSize = 10000
+
+func (o *Options) batchSize() int {
+	if o == nil || o.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return o.BatchSize
+}
+
+func (o *Options) allocator() memory.Allocator {
+	if o == nil || o.Allocator == nil {
+		return memory.DefaultAllocator
+	}
+	return o.Allocator
+}
+
+func (o *Options) parquetProps() *parquet.WriterProperties {
+	if o == nil || o.ParquetProps == nil {
+		return parquet.NewWriterProperties()
+	}
+	return o.ParquetProps
+}
+
+var timestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+// Export runs query and streams its result to fn as a sequence of Arrow record batches,
+// all with the same schema
+// (see Schema).
+// Each record is released after fn returns;
+// fn must Retain it to keep it longer.
+// If the result is empty,
+// fn is not called.
+func Export(ctx context.Context, db sqlutil.QueryerContext, opts *Options, fn func(arrow.Record) error, query string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+	defer rows.Close()
+
+	schema, err := rowsSchema(rows)
+	if err != nil {
+		return err
+	}
+	return export(rows, schema, opts, fn)
+}
+
+// ExportParquet runs query and writes its result to w as a Parquet file,
+// one row group per record batch.
+func ExportParquet(ctx context.Context, db sqlutil.QueryerContext, w io.Writer, opts *Options, query string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("executing query: %w", err)
+	}
+	defer rows.Close()
+
+	schema, err := rowsSchema(rows)
+	if err != nil {
+		return err
+	}
+
+	arrowProps := pqarrow.NewArrowWriterProperties(pqarrow.WithAllocator(opts.allocator()))
+	fw, err := pqarrow.NewFileWriter(schema, w, opts.parquetProps(), arrowProps)
+	if err != nil {
+		return fmt.Errorf("creating parquet writer: %w", err)
+	}
+	err = export(rows, schema, opts, fw.Write)
+	if closeErr := fw.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("closing parquet writer: %w", closeErr)
+	}
+	return err
+}
+
+func rowsSchema(rows *sql.Rows) (*arrow.Schema, error) {
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("getting column types: %w", err)
+	}
+	return Schema(cols), nil
+}
+
+// Schema produces the Arrow schema for a query result with the given column types.
+func Schema(cols []*sql.ColumnType) *arrow.Schema {
+	fields := make([]arrow.Field, 0, len(cols))
+	for _, col := range cols {
+		fields = append(fields, arrow.Field{Name: col.Name(), Type: arrowType(col), Nullable: true})
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+var (
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullInt32Type   = reflect.TypeOf(sql.NullInt32{})
+	nullInt16Type   = reflect.TypeOf(sql.NullInt16{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+	nullTimeType    = reflect.TypeOf(sql.NullTime{})
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+func arrowType(col *sql.ColumnType) arrow.DataType {
+	if t := col.ScanType(); t != nil {
+		switch t {
+		case nullInt64Type, nullInt32Type, nullInt16Type:
+			return arrow.PrimitiveTypes.Int64
+		case nullFloat64Type:
+			return arrow.PrimitiveTypes.Float64
+		case nullBoolType:
+			return arrow.FixedWidthTypes.Boolean
+		case nullTimeType, timeType:
+			return timestampType
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return arrow.PrimitiveTypes.Int64
+		case reflect.Float32, reflect.Float64:
+			return arrow.PrimitiveTypes.Float64
+		case reflect.Bool:
+			return arrow.FixedWidthTypes.Boolean
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 && !isTextType(col.DatabaseTypeName()) {
+				return arrow.BinaryTypes.Binary
+			}
+		}
+	}
+
+	name := strings.ToUpper(col.DatabaseTypeName())
+	switch {
+	case isIntType(name):
+		return arrow.PrimitiveTypes.Int64
+	case name == "REAL" || strings.Contains(name, "FLOAT") || strings.Contains(name, "DOUBLE"):
+		return arrow.PrimitiveTypes.Float64
+	case strings.HasPrefix(name, "BOOL"):
+		return arrow.FixedWidthTypes.Boolean
+	case strings.HasPrefix(name, "TIMESTAMP") || name == "DATETIME" || name == "DATE":
+		return timestampType
+	case strings.Contains(name, "BLOB") || name == "BYTEA" || strings.Contains(name, "BINARY"):
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// intTypes are the base names of integer column types.
+var intTypes = map[string]bool{
+	"INT": true, "INTEGER": true, "TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "BIGINT": true,
+	"INT2": true, "INT4": true, "INT8": true,
+	"SERIAL": true, "SMALLSERIAL": true, "BIGSERIAL": true, "SERIAL2": true, "SERIAL4": true, "SERIAL8": true,
+}
+
+// isIntType tells whether the (upper-case) database type name is an integer type,
+// judging by its base name:
+// the part before any length or modifiers,
+// as in "INT(11)" or "BIGINT UNSIGNED",
+// and after any UNSIGNED prefix,
+// as in MySQL's "UNSIGNED INT".
+func isIntType(name string) bool {
+	name = strings.TrimPrefix(name, "UNSIGNED ")
+	base := name
+	if i := strings.IndexFunc(name, func(r rune) bool { return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') }); i >= 0 {
+		base = name[:i]
+	}
+	return intTypes[base]
+}
+
+func isTextType(name string) bool {
+	name = strings.ToUpper(name)
+	return strings.Contains(name, "CHAR") || strings.Contains(name, "TEXT") || name == "NUMERIC" || name == "DECIMAL" || name == "JSON"
+}
+
+func export(rows *sql.Rows, schema *arrow.Schema, opts *Options, fn func(arrow.Record) error) error {
+	b := array.NewRecordBuilder(opts.allocator(), schema)
+	defer b.Release()
+
+	var (
+		fields = schema.Fields()
+		dests  = make([]interface{}, len(fields))
+		appnd  = make([]func(), len(fields))
+	)
+	for i, f := range fields {
+		dests[i], appnd[i] = column(b.Field(i), f.Type)
+	}
+
+	flush := func() error {
+		rec := b.NewRecord()
+		defer rec.Release()
+		return fn(rec)
+	}
+
+	var n int
+	for rows.Next() {
+		if err := rows.Scan(dests...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		for _, a := range appnd {
+			a()
+		}
+		if n++; n == opts.batchSize() {
+			if err := flush(); err != nil {
+				return err
+			}
+			n = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over rows: %w", err)
+	}
+	if n > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// column produces a scan destination for a column of type dt,
+// and a function appending its scanned value to the builder bb.
+func column(bb array.Builder, dt arrow.DataType) (interface{}, func()) {
+	switch dt {
+	case arrow.PrimitiveTypes.Int64:
+		var v sql.NullInt64
+		b := bb.(*array.Int64Builder)
+		return &v, func() {
+			if v.Valid {
+				b.Append(v.Int64)
+			} else {
+				b.AppendNull()
+			}
+		}
+
+	case arrow.PrimitiveTypes.Float64:
+		var v sql.NullFloat64
+		b := bb.(*array.Float64Builder)
+		return &v, func() {
+			if v.Valid {
+				b.Append(v.Float64)
+			} else {
+				b.AppendNull()
+			}
+		}
+
+	case arrow.FixedWidthTypes.Boolean:
+		var v sql.NullBool
+		b := bb.(*array.BooleanBuilder)
+		return &v, func() {
+			if v.Valid {
+				b.Append(v.Bool)
+			} else {
+				b.AppendNull()
+			}
+		}
+
+	case timestampType:
+		var v sql.NullTime
+		b := bb.(*array.TimestampBuilder)
+		return &v, func() {
+			if v.Valid {
+				b.Append(arrow.Timestamp(v.Time.UnixMicro()))
+			} else {
+				b.AppendNull()
+			}
+		}
+
+	case arrow.BinaryTypes.Binary:
+		var v []byte
+		b := bb.(*array.BinaryBuilder)
+		return &v, func() {
+			if v == nil {
+				b.AppendNull()
+			} else {
+				b.Append(v)
+			}
+		}
+	}
+
+	var v sql.NullString
+	b := bb.(*array.StringBuilder)
+	return &v, func() {
+		if v.Valid {
+			b.Append(v.String)
+		} else {
+			b.AppendNull()
+		}
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/bobg/sqlutil/sqlutilpgx
+
+go 1.21
+
+replace github.com/bobg/sqlutil => ../
+
+require (
+	github.com/bobg/sqlutil v0.0.0-00010101000000-000000000000
+	github.com/jackc/pgx/v5 v5.5.5
+)
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sync v0.4.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
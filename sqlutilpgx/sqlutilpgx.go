@@ -0,0 +1,114 @@
+// Package sqlutilpgx adapts a pgx connection pool for use with sqlutil.
+//
+// The interfaces in sqlutil
+// (QueryerContext, ExecerContext, DB, and so on)
+// traffic in database/sql types such as *sql.Rows and *sql.Tx,
+// which a pgxpool.Pool cannot produce natively.
+// A DB produced by New satisfies them anyway:
+// statements that return only a result
+// (ExecContext)
+// and bulk loads
+// (CopyFromRows, used by sqlutil.BulkInsert and sqlutil.Queue.EnqueueBatch)
+// go straight to the pool using pgx's native protocol,
+// while queries and transactions go through a *sql.DB sharing the same pool's connections.
+// Everything built on those interfaces,
+// like sqlutil.Lessor and sqlutil.Queue,
+// therefore works with a pgx pool
+// and uses its native features where sqlutil can.
+//
+// This is a separate module so that importers of sqlutil do not acquire a dependency on pgx.
+package sqlutilpgx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/bobg/sqlutil"
+)
+
+// DB adapts a pgxpool.Pool to sqlutil.DB and sqlutil.CopyFromer.
+type DB struct {
+	pool  *pgxpool.Pool
+	sqldb *sql.DB
+}
+
+var (
+	_ sqlutil.DB         = (*DB)(nil)
+	_ sqlutil.CopyFromer = (*DB)(nil)
+)
+
+// New produces a DB using the connections of pool.
+// Closing the DB does not close pool.
+func New(pool *pgxpool.Pool) *DB {
+	return &DB{pool: pool, sqldb: stdlib.OpenDBFromPool(pool)}
+}
+
+// Pool returns the underlying pgx pool.
+func (d *DB) Pool() *pgxpool.Pool {
+	return d.pool
+}
+
+// SQLDB returns the *sql.DB sharing the pool's connections.
+func (d *DB) SQLDB() *sql.DB {
+	return d.sqldb
+}
+
+// Close releases the resources of the *sql.DB returned by SQLDB.
+// It does not close the pool.
+func (d *DB) Close() error {
+	return d.sqldb.Close()
+}
+
+// PrepareContext implements sqlutil.PreparerContext.
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.sqldb.PrepareContext(ctx, query)
+}
+
+// QueryContext implements sqlutil.QueryerContext.
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.sqldb.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements sqlutil.QueryerContext.
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.sqldb.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements sqlutil.ExecerContext
+// by executing the statement natively on the pool.
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tag, err := d.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(tag.RowsAffected()), nil
+}
+
+// Begin implements sqlutil.DB.
+func (d *DB) Begin() (*sql.Tx, error) {
+	return d.sqldb.Begin()
+}
+
+// BeginTx begins a transaction with the given options.
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.sqldb.BeginTx(ctx, opts)
+}
+
+// PingContext implements sqlutil.PingerContext.
+func (d *DB) PingContext(ctx context.Context) error {
+	return d.pool.Ping(ctx)
+}
+
+// CopyFromRows implements sqlutil.CopyFromer with pgx's CopyFrom,
+// which uses the Postgres COPY protocol.
+// The table name may be schema-qualified
+// (schema.table).
+func (d *DB) CopyFromRows(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	return d.pool.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, pgx.CopyFromRows(rows))
+}
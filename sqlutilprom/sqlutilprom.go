@@ -0,0 +1,204 @@
+// Package sqlutilprom publishes sqlutil metrics to Prometheus.
+//
+// Enabling it takes two lines:
+//
+//	m := sqlutilprom.New("myapp")
+//	prometheus.MustRegister(m)
+//
+// after which m can be passed wherever a sqlutil.Metrics is wanted,
+// as in sqlutil.NewMetricsDB and sqlutil.NewPoolStats.
+// Use m.ForDB to distinguish the statements of several databases.
+//
+// This is a separate module so that importers of sqlutil do not acquire a dependency on Prometheus.
+package sqlutilprom
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bobg/sqlutil"
+)
+
+// DefaultBuckets are the histogram buckets for statement durations,
+// in seconds,
+// used when New is called.
+// They range from half a millisecond to ten seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Outcomes of a statement,
+// as reported in the "outcome" label.
+const (
+	OutcomeOK       = "ok"
+	OutcomeNoRows   = "no_rows"
+	OutcomeCanceled = "canceled"
+	OutcomeTimeout  = "timeout"
+	OutcomeError    = "error"
+)
+
+// Metrics implements sqlutil.Metrics,
+// and is a prometheus.Collector for the measurements it receives.
+//
+// Statement durations are published as a histogram,
+// <namespace>_sql_query_duration_seconds,
+// labeled with op, name
+// (from sqlutil.QueryName),
+// outcome,
+// and db
+// (empty unless the statement was reported through ForDB).
+//
+// Connection-pool statistics are published as gauges and counters
+// named <namespace>_sql_pool_*,
+// labeled with db
+// (the name under which the *sql.DB was added to a sqlutil.PoolStats).
+type Metrics struct {
+	queries *prometheus.HistogramVec
+
+	poolOpen, poolInUse, poolIdle, poolMaxOpen                   *prometheus.Desc
+	poolWaits, poolWaitSeconds                                   *prometheus.Desc
+	poolMaxIdleClosed, poolMaxIdleTimeClosed, poolLifetimeClosed *prometheus.Desc
+
+	mu    sync.Mutex
+	pools map[string]sql.DBStats
+}
+
+var _ sqlutil.Metrics = (*Metrics)(nil)
+
+// New produces a new Metrics
+// whose metric names begin with the given namespace
+// (which may be empty),
+// using DefaultBuckets.
+func New(namespace string) *Metrics {
+	return NewWithBuckets(namespace, DefaultBuckets)
+}
+
+// NewWithBuckets is like New but uses the given histogram buckets for statement durations.
+func NewWithBuckets(namespace string, buckets []float64) *Metrics {
+	poolDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "sql_pool", name), help, []string{"db"}, nil)
+	}
+	return &Metrics{
+		queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "sql",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of SQL statements.",
+			Buckets:   buckets,
+		}, []string{"op", "name", "outcome", "db"}),
+
+		poolOpen:              poolDesc("open_connections", "Established connections, both in use and idle."),
+		poolInUse:             poolDesc("in_use_connections", "Connections currently in use."),
+		poolIdle:              poolDesc("idle_connections", "Idle connections."),
+		poolMaxOpen:           poolDesc("max_open_connections", "Maximum number of open connections (0 for unlimited)."),
+		poolWaits:             poolDesc("waits_total", "Total number of waits for a connection."),
+		poolWaitSeconds:       poolDesc("wait_seconds_total", "Total time spent waiting for a connection."),
+		poolMaxIdleClosed:     poolDesc("max_idle_closed_total", "Total connections closed due to the idle limit."),
+		poolMaxIdleTimeClosed: poolDesc("max_idle_time_closed_total", "Total connections closed due to the idle time limit."),
+		poolLifetimeClosed:    poolDesc("max_lifetime_closed_total", "Total connections closed due to the lifetime limit."),
+
+		pools: make(map[string]sql.DBStats),
+	}
+}
+
+// ObserveQuery implements sqlutil.Metrics.
+// The statement's db label is empty.
+func (m *Metrics) ObserveQuery(op, name string, d time.Duration, err error) {
+	m.observeQuery("", op, name, d, err)
+}
+
+func (m *Metrics) observeQuery(dbName, op, name string, d time.Duration, err error) {
+	m.queries.WithLabelValues(op, name, Outcome(err), dbName).Observe(d.Seconds())
+}
+
+// ForDB returns a sqlutil.Metrics that reports to m,
+// labeling statements with db=dbName.
+// Use it to give each database its own MetricsDB:
+//
+//	primary := sqlutil.NewMetricsDB(primaryDB, m.ForDB("primary"))
+//	replica := sqlutil.NewMetricsDB(replicaDB, m.ForDB("replica"))
+func (m *Metrics) ForDB(dbName string) sqlutil.Metrics {
+	return dbMetrics{m: m, db: dbName}
+}
+
+type dbMetrics struct {
+	m  *Metrics
+	db string
+}
+
+func (d dbMetrics) ObserveQuery(op, name string, dur time.Duration, err error) {
+	d.m.observeQuery(d.db, op, name, dur, err)
+}
+
+func (d dbMetrics) ObservePoolStats(dbName string, stats sql.DBStats) {
+	d.m.ObservePoolStats(dbName, stats)
+}
+
+// ObservePoolStats implements sqlutil.Metrics.
+// The most recent sample for each dbName is published on collection.
+func (m *Metrics) ObservePoolStats(dbName string, stats sql.DBStats) {
+	m.mu.Lock()
+	m.pools[dbName] = stats
+	m.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.queries.Describe(ch)
+	for _, d := range m.poolDescs() {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.queries.Collect(ch)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, s := range m.pools {
+		gauge := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, name)
+		}
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, name)
+		}
+		gauge(m.poolOpen, float64(s.OpenConnections))
+		gauge(m.poolInUse, float64(s.InUse))
+		gauge(m.poolIdle, float64(s.Idle))
+		gauge(m.poolMaxOpen, float64(s.MaxOpenConnections))
+		counter(m.poolWaits, float64(s.WaitCount))
+		counter(m.poolWaitSeconds, s.WaitDuration.Seconds())
+		counter(m.poolMaxIdleClosed, float64(s.MaxIdleClosed))
+		counter(m.poolMaxIdleTimeClosed, float64(s.MaxIdleTimeClosed))
+		counter(m.poolLifetimeClosed, float64(s.MaxLifetimeClosed))
+	}
+}
+
+func (m *Metrics) poolDescs() []*prometheus.Desc {
+	return []*prometheus.Desc{
+		m.poolOpen, m.poolInUse, m.poolIdle, m.poolMaxOpen,
+		m.poolWaits, m.poolWaitSeconds,
+		m.poolMaxIdleClosed, m.poolMaxIdleTimeClosed, m.poolLifetimeClosed,
+	}
+}
+
+// Outcome classifies a statement's error for the "outcome" label.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, sql.ErrNoRows):
+		return OutcomeNoRows
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return OutcomeTimeout
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,117 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Kinds of StrictViolation.
+const (
+	// CallbackAfterCancel means that rows were still being delivered to a ForQueryRows callback after its context was done.
+	// In strict mode the iteration stops with the context's error.
+	CallbackAfterCancel = "callback after cancel"
+
+	// RowNotScanned means that the context of a Row produced by QueryRowContext was done before the Row was scanned,
+	// so the Row was holding a connection.
+	// In strict mode the Row's rows are then closed.
+	RowNotScanned = "row not scanned"
+
+	// QueryAfterCancel means that a StrictDB received a statement in a context that was already done.
+	QueryAfterCancel = "query after cancel"
+)
+
+// StrictViolation describes misuse detected in strict mode.
+type StrictViolation struct {
+	Kind  string
+	Query string
+	Stack []byte // the stack of the goroutine that detected the violation
+}
+
+var strictHookVal atomic.Value // func(StrictViolation)
+
+// SetStrictHook enables strict mode,
+// in which the package's helpers check that contexts are respected
+// and that query results are not left holding connections,
+// reporting violations to hook.
+// Strict mode costs a goroutine per QueryRowContext call
+// and is meant for tests and debugging.
+// A nil hook disables strict mode.
+//
+// Since *sql.Rows cannot be wrapped,
+// rows obtained directly from a database handle are not checked;
+// the helpers close the rows they obtain.
+func SetStrictHook(hook func(StrictViolation)) {
+	strictHookVal.Store(hook)
+}
+
+func strictHook() func(StrictViolation) {
+	hook, _ := strictHookVal.Load().(func(StrictViolation))
+	return hook
+}
+
+func reportStrict(v StrictViolation) {
+	if hook := strictHook(); hook != nil {
+		v.Stack = debug.Stack()
+		hook(v)
+	}
+}
+
+// watch reports r and closes its rows
+// if ctx is done before r is scanned.
+func (r *Row) watch(ctx context.Context, query string) {
+	select {
+	case <-r.scanned:
+	case <-ctx.Done():
+		select {
+		case <-r.scanned:
+		default:
+			reportStrict(StrictViolation{Kind: RowNotScanned, Query: query})
+			r.rows.Close()
+		}
+	}
+}
+
+// StrictDB is a DB that reports statements issued in contexts that are already done
+// (e.g. by a handler that keeps working after its request was canceled)
+// to the strict-mode hook.
+// It has no effect unless strict mode is enabled with SetStrictHook.
+type StrictDB struct {
+	DB
+}
+
+// NewStrictDB produces a StrictDB wrapping db.
+func NewStrictDB(db DB) *StrictDB {
+	return &StrictDB{DB: db}
+}
+
+func (s *StrictDB) check(ctx context.Context, query string) {
+	if ctx.Err() != nil {
+		reportStrict(StrictViolation{Kind: QueryAfterCancel, Query: query})
+	}
+}
+
+// PrepareContext implements PreparerContext.
+func (s *StrictDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.check(ctx, query)
+	return s.DB.PrepareContext(ctx, query)
+}
+
+// QueryContext implements QueryerContext.
+func (s *StrictDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	s.check(ctx, query)
+	return s.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (s *StrictDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	s.check(ctx, query)
+	return s.DB.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements ExecerContext.
+func (s *StrictDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	s.check(ctx, query)
+	return s.DB.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,145 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// structValue returns the struct value that v points to
+// (or v itself)
+// and its field mappings.
+func structValue(v interface{}) (reflect.Value, []structField, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, nil, fmt.Errorf("nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, nil, fmt.Errorf("%s is not a struct type", rv.Type())
+	}
+	fields, err := structFields(rv.Type())
+	return rv, fields, err
+}
+
+// whereFields builds a WHERE condition matching the given fields,
+// with placeholders numbered from start,
+// and returns it along with the corresponding args.
+func whereFields(rv reflect.Value, fields []structField, start int) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	for _, f := range fields {
+		conds = append(conds, fmt.Sprintf("%s = $%d", f.column, start+len(args)))
+		args = append(args, rv.FieldByIndex(f.index).Interface())
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func pkFields(fields []structField) []structField {
+	var pks []structField
+	for _, f := range fields {
+		if f.pk {
+			pks = append(pks, f)
+		}
+	}
+	return pks
+}
+
+// InsertStruct inserts a row into table from the fields of the struct that v points to
+// (or the struct v itself),
+// mapped to columns by their `sql` struct tags
+// (see the package documentation).
+// Fields with the autoincr option are omitted,
+// so the database assigns their values.
+func InsertStruct(ctx context.Context, db ExecerContext, table string, v interface{}) error {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	var (
+		cols, placeholders []string
+		args               []interface{}
+	)
+	for _, f := range fields {
+		if f.autoincr {
+			continue
+		}
+		cols = append(cols, f.column)
+		args = append(args, rv.FieldByIndex(f.index).Interface())
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	const insQFmt = `INSERT INTO %s (%s) VALUES (%s)`
+	insQ := fmt.Sprintf(insQFmt, table, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+	_, err = db.ExecContext(ctx, insQ, args...)
+	return wrapf(err, "inserting into database")
+}
+
+// UpdateStruct updates the row of table identified by the primary-key fields of the struct that v points to
+// (or the struct v itself),
+// setting its other columns from the struct's other fields.
+// The struct must have at least one field with the pk option.
+// It returns the number of rows affected.
+func UpdateStruct(ctx context.Context, db ExecerContext, table string, v interface{}) (int64, error) {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return 0, err
+	}
+	pks := pkFields(fields)
+	if len(pks) == 0 {
+		return 0, fmt.Errorf("%s has no primary-key fields", rv.Type())
+	}
+	var (
+		sets []string
+		args []interface{}
+	)
+	for _, f := range fields {
+		if f.pk {
+			continue
+		}
+		args = append(args, rv.FieldByIndex(f.index).Interface())
+		sets = append(sets, fmt.Sprintf("%s = $%d", f.column, len(args)))
+	}
+	if len(sets) == 0 {
+		return 0, fmt.Errorf("%s has no non-primary-key fields", rv.Type())
+	}
+	where, whereArgs := whereFields(rv, pks, len(args)+1)
+
+	const updQFmt = `UPDATE %s SET %s WHERE %s`
+	updQ := fmt.Sprintf(updQFmt, table, strings.Join(sets, ", "), where)
+	res, err := db.ExecContext(ctx, updQ, append(args, whereArgs...)...)
+	if err != nil {
+		return 0, fmt.Errorf("updating database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff, wrapf(err, "counting affected rows")
+}
+
+// DeleteStruct deletes the row of table identified by the primary-key fields of the struct that v points to
+// (or the struct v itself).
+// The struct must have at least one field with the pk option.
+// It returns the number of rows affected.
+func DeleteStruct(ctx context.Context, db ExecerContext, table string, v interface{}) (int64, error) {
+	rv, fields, err := structValue(v)
+	if err != nil {
+		return 0, err
+	}
+	pks := pkFields(fields)
+	if len(pks) == 0 {
+		return 0, fmt.Errorf("%s has no primary-key fields", rv.Type())
+	}
+	where, args := whereFields(rv, pks, 1)
+
+	const delQFmt = `DELETE FROM %s WHERE %s`
+	delQ := fmt.Sprintf(delQFmt, table, where)
+	res, err := db.ExecContext(ctx, delQ, args...)
+	if err != nil {
+		return 0, fmt.Errorf("deleting from database: %w", err)
+	}
+	aff, err := res.RowsAffected()
+	return aff, wrapf(err, "counting affected rows")
+}
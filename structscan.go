@@ -0,0 +1,175 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ScanMode governs how struct scanning treats a mismatch between result columns and struct fields.
+// See StructScanOptions.
+type ScanMode int
+
+const (
+	// ScanStrict makes the mismatch an error.
+	ScanStrict ScanMode = iota
+
+	// ScanLenient ignores the mismatch:
+	// columns with no field are discarded,
+	// and fields with no column keep their zero values.
+	ScanLenient
+
+	// ScanCollect stores columns with no field in the struct's leftover field:
+	// a field of type map[string]interface{} with the `sql` tag option leftover,
+	// which must exist.
+	// It applies only to StructScanOptions.UnknownColumns.
+	ScanCollect
+)
+
+// StructScanOptions control scanning into structs by column name,
+// as done by ForQueryRows for a callback taking a single struct argument.
+// The zero value is strict in both directions.
+type StructScanOptions struct {
+	// UnknownColumns governs result columns that match no struct field.
+	UnknownColumns ScanMode
+
+	// MissingFields governs struct fields that match no result column.
+	// (ScanCollect is treated as ScanLenient.)
+	MissingFields ScanMode
+}
+
+// WithStructScanOptions creates a child of the given context object
+// carrying struct-scanning options for the queries made in it.
+func WithStructScanOptions(ctx context.Context, opts StructScanOptions) context.Context {
+	return context.WithValue(ctx, structScanOptionsCtxkey, opts)
+}
+
+var structScanOptionsCtxkey = ctxkeytype("structscanopts")
+
+func structScanOptions(ctx context.Context) StructScanOptions {
+	opts, _ := ctx.Value(structScanOptionsCtxkey).(StructScanOptions)
+	return opts
+}
+
+var scannerInterface = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// isScanStruct tells whether values of type t are scanned as structs by column name,
+// rather than as single values:
+// it is a struct type other than time.Time
+// that does not implement sql.Scanner.
+func isScanStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(scannerInterface)
+}
+
+// structScanner scans rows with a given set of columns into structs of a given type.
+type structScanner struct {
+	fieldIndexes [][]int // per column; nil for unknown columns
+	leftover     []int   // index of the leftover field, if collecting
+	columns      []string
+}
+
+func newStructScanner(t reflect.Type, columns []string, opts StructScanOptions) (*structScanner, error) {
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+	byColumn := make(map[string]structField, len(fields))
+	for _, f := range fields {
+		byColumn[strings.ToLower(f.column)] = f
+	}
+
+	s := &structScanner{
+		fieldIndexes: make([][]int, len(columns)),
+		columns:      columns,
+	}
+	matched := make(map[string]bool, len(columns))
+	var unknown []string
+	for i, col := range columns {
+		f, ok := byColumn[strings.ToLower(col)]
+		if !ok {
+			unknown = append(unknown, col)
+			continue
+		}
+		s.fieldIndexes[i] = f.index
+		matched[f.column] = true
+	}
+
+	if len(unknown) > 0 {
+		switch opts.UnknownColumns {
+		case ScanStrict:
+			return nil, fmt.Errorf("no field in %s for column(s) %s", t, strings.Join(unknown, ", "))
+		case ScanCollect:
+			if s.leftover = leftoverIndex(t); s.leftover == nil {
+				return nil, fmt.Errorf("%s has no leftover field for column(s) %s", t, strings.Join(unknown, ", "))
+			}
+		}
+	}
+	if opts.MissingFields == ScanStrict {
+		var missing []string
+		for _, f := range fields {
+			if !matched[f.column] {
+				missing = append(missing, f.name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("no column for field(s) %s of %s", strings.Join(missing, ", "), t)
+		}
+	}
+	return s, nil
+}
+
+// leftoverIndex returns the index of the leftover field of struct type t,
+// or nil if it has none.
+func leftoverIndex(t reflect.Type) []int {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Type != mapType {
+			continue
+		}
+		for _, opt := range strings.Split(sf.Tag.Get("sql"), ",")[1:] {
+			if opt == "leftover" {
+				return sf.Index
+			}
+		}
+	}
+	return nil
+}
+
+// dests returns scan destinations for the struct v:
+// pointers to its fields,
+// and for unknown columns,
+// pointers to discarded (or collected) values.
+func (s *structScanner) dests(v reflect.Value) []interface{} {
+	dests := make([]interface{}, len(s.fieldIndexes))
+	for i, index := range s.fieldIndexes {
+		if index == nil {
+			dests[i] = new(interface{})
+			continue
+		}
+		dests[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return dests
+}
+
+// finish stores the values of unknown columns in v's leftover field,
+// if collecting.
+func (s *structScanner) finish(v reflect.Value, dests []interface{}) {
+	if s.leftover == nil {
+		return
+	}
+	m := make(map[string]interface{})
+	for i, index := range s.fieldIndexes {
+		if index == nil {
+			val := *(dests[i].(*interface{}))
+			if b, ok := val.([]byte); ok {
+				// The driver may reuse the memory of a []byte.
+				val = append([]byte(nil), b...)
+			}
+			m[s.columns[i]] = val
+		}
+	}
+	v.FieldByIndex(s.leftover).Set(reflect.ValueOf(m))
+}
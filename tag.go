@@ -0,0 +1,119 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var tagCtxkey = ctxkeytype("tags")
+
+// WithQueryTag creates a child of the given context object carrying an additional query tag.
+// A tag has the form "key=value",
+// e.g. "handler=GetUser".
+// Tags accumulate:
+// the tags in ctx (and its parents) are all retained.
+//
+// Tags are appended to outgoing SQL as a comment by TagQuery and by TaggedDB,
+// in the style of sqlcommenter
+// (https://google.github.io/sqlcommenter/),
+// so that slow queries can be attributed to application call sites.
+func WithQueryTag(ctx context.Context, tag string) context.Context {
+	old := QueryTags(ctx)
+	tags := make([]string, len(old), len(old)+1)
+	copy(tags, old)
+	tags = append(tags, tag)
+	return context.WithValue(ctx, tagCtxkey, tags)
+}
+
+// QueryTags returns the tags added to ctx
+// (or some parent of ctx)
+// with WithQueryTag,
+// in the order they were added.
+func QueryTags(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagCtxkey).([]string)
+	return tags
+}
+
+// WithQueryName creates a child of the given context object carrying the query tag "name=<name>",
+// which names the queries made in it
+// (see QueryName).
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return WithQueryTag(ctx, "name="+name)
+}
+
+// QueryName returns the value of the most recently added "name" query tag in ctx,
+// or "" if there is none.
+// It is used to label metrics.
+func QueryName(ctx context.Context) string {
+	tags := QueryTags(ctx)
+	for i := len(tags) - 1; i >= 0; i-- {
+		if strings.HasPrefix(tags[i], "name=") {
+			return strings.TrimPrefix(tags[i], "name=")
+		}
+	}
+	return ""
+}
+
+// TagQuery appends the query tags in ctx to query as a sqlcommenter-style comment.
+// Keys and values are URL-encoded, values are single-quoted,
+// and the pairs are sorted by key.
+// If ctx has no tags,
+// or query already ends with the same comment
+// (as when wrappers that tag queries are combined),
+// query is returned unchanged.
+func TagQuery(ctx context.Context, query string) string {
+	tags := QueryTags(ctx)
+	if len(tags) == 0 {
+		return query
+	}
+	pairs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		var key, val string
+		if i := strings.IndexByte(tag, '='); i >= 0 {
+			key, val = tag[:i], tag[i+1:]
+		} else {
+			key = tag
+		}
+		pairs = append(pairs, url.QueryEscape(key)+"='"+url.QueryEscape(val)+"'")
+	}
+	sort.Strings(pairs)
+	comment := " /*" + strings.Join(pairs, ",") + "*/"
+	if strings.HasSuffix(query, comment) {
+		return query
+	}
+	return query + comment
+}
+
+// TaggedDB is a DB that applies TagQuery to each query it sends to the underlying DB.
+// Transactions produced by Begin are not affected.
+type TaggedDB struct {
+	DB
+}
+
+// NewTaggedDB produces a TaggedDB wrapping db.
+func NewTaggedDB(db DB) *TaggedDB {
+	return &TaggedDB{DB: db}
+}
+
+// PrepareContext implements PreparerContext.
+func (t *TaggedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.DB.PrepareContext(ctx, TagQuery(ctx, query))
+}
+
+// QueryContext implements QueryerContext.
+func (t *TaggedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.DB.QueryContext(ctx, TagQuery(ctx, query), args...)
+}
+
+// QueryRowContext implements QueryerContext.
+func (t *TaggedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.DB.QueryRowContext(ctx, TagQuery(ctx, query), args...)
+}
+
+// ExecContext implements ExecerContext.
+func (t *TaggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.DB.ExecContext(ctx, TagQuery(ctx, query), args...)
+}
@@ -0,0 +1,215 @@
+package sqlutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is an SQL query template,
+// for queries whose structure must vary at run time
+// (dynamic ORDER BY, optional JOINs, and so on).
+// It uses the syntax of text/template,
+// but the value of every {{...}} action becomes a bound query parameter,
+// never part of the query text,
+// unless it is produced by one of these functions:
+//
+//	ident X            X, validated and quoted as an identifier (like a column or table name; "schema.table" is allowed)
+//	idents XS          each element of the slice XS, validated and quoted as an identifier, separated by commas
+//	oneof X A B ...    X, which must equal one of the literals A, B, ... (e.g. oneof .Dir "ASC" "DESC")
+//	in XS              a parenthesized list of bound parameters, one for each element of the slice XS
+//
+// For example:
+//
+//	SELECT id, name FROM users WHERE org = {{.Org}}
+//	{{if .Active}}AND active{{end}}
+//	ORDER BY {{ident .SortBy}} {{oneof .Dir "ASC" "DESC"}}
+//
+// renders with .Org as a bound parameter.
+type Template struct {
+	t       *template.Template
+	Dialect Dialect
+}
+
+const bindFuncName = "sqlutil_bind"
+
+// sqlSafe is the type of template-function output that is included in the query text.
+type sqlSafe string
+
+// ParseTemplate parses an SQL template for the given dialect,
+// whose placeholder syntax it uses.
+func ParseTemplate(name, text string, d Dialect) (*Template, error) {
+	t, err := template.New(name).Funcs(newTemplateBinder(d).funcs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			bindActions(tt.Tree.Root)
+		}
+	}
+	return &Template{t: t, Dialect: d}, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics on error.
+// It is intended for templates in package-level variables.
+func MustParseTemplate(name, text string, d Dialect) *Template {
+	t, err := ParseTemplate(name, text, d)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the template with the given data,
+// producing the query text and its arguments.
+// It is safe to call concurrently.
+func (t *Template) Render(data interface{}) (string, []interface{}, error) {
+	b := newTemplateBinder(t.Dialect)
+	tt, err := t.t.Clone()
+	if err != nil {
+		return "", nil, fmt.Errorf("cloning template: %w", err)
+	}
+	tt.Funcs(b.funcs())
+
+	var buf strings.Builder
+	if err := tt.Execute(&buf, data); err != nil {
+		return "", nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return buf.String(), b.args, nil
+}
+
+// bindActions rewrites each action in the tree rooted at node
+// to pipe its value through the bind function.
+func bindActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			bindActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			// Declarations produce no output.
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(bindFuncName).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		bindActions(n.List)
+		bindActions(n.ElseList)
+	case *parse.RangeNode:
+		bindActions(n.List)
+		bindActions(n.ElseList)
+	case *parse.WithNode:
+		bindActions(n.List)
+		bindActions(n.ElseList)
+	}
+}
+
+type templateBinder struct {
+	d    Dialect
+	args []interface{}
+}
+
+func newTemplateBinder(d Dialect) *templateBinder {
+	return &templateBinder{d: d}
+}
+
+func (b *templateBinder) funcs() template.FuncMap {
+	return template.FuncMap{
+		bindFuncName: b.bind,
+		"ident":      b.ident,
+		"idents":     b.idents,
+		"oneof":      oneof,
+		"in":         b.in,
+	}
+}
+
+func (b *templateBinder) bind(v interface{}) sqlSafe {
+	if s, ok := v.(sqlSafe); ok {
+		return s
+	}
+	b.args = append(b.args, v)
+	return sqlSafe(b.d.Placeholder(len(b.args)))
+}
+
+func (b *templateBinder) ident(s string) (sqlSafe, error) {
+	parts := strings.Split(s, ".")
+	for i, part := range parts {
+		if !validIdent(part) {
+			return "", fmt.Errorf("invalid identifier %q", s)
+		}
+		parts[i] = b.d.QuoteIdent(part)
+	}
+	return sqlSafe(strings.Join(parts, ".")), nil
+}
+
+func (b *templateBinder) idents(v interface{}) (sqlSafe, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("idents requires a slice, not %T", v)
+	}
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		s, ok := rv.Index(i).Interface().(string)
+		if !ok {
+			return "", fmt.Errorf("idents requires strings, not %s", rv.Index(i).Type())
+		}
+		q, err := b.ident(s)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, string(q))
+	}
+	return sqlSafe(strings.Join(parts, ", ")), nil
+}
+
+// in binds each element of the slice v and returns their placeholders as a parenthesized list.
+// An empty slice produces (NULL),
+// which matches nothing.
+func (b *templateBinder) in(v interface{}) (sqlSafe, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("in requires a slice, not %T", v)
+	}
+	if rv.Len() == 0 {
+		return "(NULL)", nil
+	}
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		parts = append(parts, string(b.bind(rv.Index(i).Interface())))
+	}
+	return sqlSafe("(" + strings.Join(parts, ", ") + ")"), nil
+}
+
+func oneof(v string, allowed ...string) (sqlSafe, error) {
+	for _, a := range allowed {
+		if strings.EqualFold(v, a) {
+			return sqlSafe(a), nil
+		}
+	}
+	return "", fmt.Errorf("%q is not one of %q", v, allowed)
+}
+
+// validIdent tells whether s is a plain SQL identifier:
+// a letter or underscore followed by letters, digits, and underscores.
+func validIdent(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
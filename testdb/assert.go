@@ -0,0 +1,93 @@
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+func countRows(t testing.TB, db sqlutil.QueryerContext, table, where string, args []interface{}) int64 {
+	t.Helper()
+
+	query := "SELECT COUNT(*) FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+	var n int64
+	if err := sqlutil.QueryRowContext(context.Background(), db, query, args...).Scan(&n); err != nil {
+		t.Fatalf("counting rows in %s: %s", table, err)
+	}
+	return n
+}
+
+// AssertRowCount fails the test unless table has exactly n rows matching where,
+// an SQL boolean expression with placeholders for args.
+// An empty where matches all rows.
+func AssertRowCount(t testing.TB, db sqlutil.QueryerContext, table, where string, n int64, args ...interface{}) {
+	t.Helper()
+
+	if got := countRows(t, db, table, where, args); got != n {
+		t.Errorf("got %d rows in %s %s, want %d", got, table, describeWhere(where, args), n)
+	}
+}
+
+// AssertExists fails the test unless table has at least one row matching where,
+// an SQL boolean expression with placeholders for args.
+func AssertExists(t testing.TB, db sqlutil.QueryerContext, table, where string, args ...interface{}) {
+	t.Helper()
+
+	if countRows(t, db, table, where, args) == 0 {
+		t.Errorf("no rows in %s %s", table, describeWhere(where, args))
+	}
+}
+
+// AssertNotExists fails the test if table has any row matching where,
+// an SQL boolean expression with placeholders for args.
+func AssertNotExists(t testing.TB, db sqlutil.QueryerContext, table, where string, args ...interface{}) {
+	t.Helper()
+
+	if n := countRows(t, db, table, where, args); n > 0 {
+		t.Errorf("got %d rows in %s %s, want none", n, table, describeWhere(where, args))
+	}
+}
+
+// AssertRowEquals fails the test unless query,
+// with the given args,
+// produces exactly one row whose columns equal want.
+// Each column is scanned into a new value of the same type as the corresponding element of want
+// (or interface{} if that element is nil)
+// and compared with reflect.DeepEqual.
+func AssertRowEquals(t testing.TB, db sqlutil.QueryerContext, query string, args []interface{}, want ...interface{}) {
+	t.Helper()
+
+	ptrs := make([]interface{}, len(want))
+	for i, w := range want {
+		if w == nil {
+			ptrs[i] = new(interface{})
+			continue
+		}
+		ptrs[i] = reflect.New(reflect.TypeOf(w)).Interface()
+	}
+	if err := sqlutil.QueryRowContext(context.Background(), db, query, args...).Scan(ptrs...); err != nil {
+		t.Fatalf("querying row: %s", err)
+	}
+	for i, w := range want {
+		got := reflect.ValueOf(ptrs[i]).Elem().Interface()
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("column %d: got %v, want %v", i, got, w)
+		}
+	}
+}
+
+func describeWhere(where string, args []interface{}) string {
+	if where == "" {
+		return "(all rows)"
+	}
+	if len(args) == 0 {
+		return "where " + where
+	}
+	return fmt.Sprintf("where %s %v", where, args)
+}
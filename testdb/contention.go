@@ -0,0 +1,173 @@
+package testdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+)
+
+// FakeClock is a manually advanced clock,
+// suitable for the Now field of sqlutil.Lessor.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock produces a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{t: start}
+}
+
+// Now tells the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// ContentionOptions configure LeaseContention.
+type ContentionOptions struct {
+	// Goroutines is the number of goroutines contending for the lease.
+	// The default if this is unspecified is 8.
+	Goroutines int
+
+	// Acquisitions is the number of times each goroutine acquires and releases the lease.
+	// The default if this is unspecified is 10.
+	Acquisitions int
+
+	// LeaseDuration is the duration of each acquired lease.
+	// The default if this is unspecified is one minute.
+	LeaseDuration time.Duration
+
+	// Hold is how long each goroutine holds the lease before releasing it.
+	Hold time.Duration
+
+	// Retry governs how goroutines wait for the lease.
+	// The default if this is unspecified is to retry every millisecond.
+	Retry *sqlutil.RetryPolicy
+
+	// Clock, if set, is advanced by Hold
+	// (instead of sleeping for real)
+	// while each goroutine holds the lease.
+	// It should also be installed as the Lessor's Now function.
+	Clock *FakeClock
+}
+
+// ContentionResult reports the outcome of LeaseContention.
+type ContentionResult struct {
+	// Acquisitions[i] is the number of times goroutine i acquired the lease.
+	Acquisitions []int
+
+	// Waits[i] is the total (real) time goroutine i spent waiting for the lease.
+	Waits []time.Duration
+
+	// Violations is the number of times a goroutine acquired the lease while another held it.
+	Violations int
+}
+
+// Fairness is Jain's fairness index of the goroutines' total wait times:
+// 1 when all goroutines waited equally,
+// approaching 1/n when one goroutine did all the waiting.
+func (r ContentionResult) Fairness() float64 {
+	var sum, sumSq float64
+	for _, w := range r.Waits {
+		f := float64(w)
+		sum += f
+		sumSq += f * f
+	}
+	if sumSq == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(r.Waits)) * sumSq)
+}
+
+// LeaseContention runs goroutines that repeatedly contend for the lease named name from l,
+// failing the test if any two goroutines ever hold it at once
+// or if any goroutine cannot acquire it.
+// Validating the Lessor against a real database is best,
+// but an in-memory one
+// (see NewSQLite and sqlutil.Lessor.EnsureTable)
+// serves for quick checks.
+func LeaseContention(t testing.TB, l *sqlutil.Lessor, name string, opts ContentionOptions) ContentionResult {
+	t.Helper()
+
+	var (
+		ngo   = opts.Goroutines
+		nacq  = opts.Acquisitions
+		dur   = opts.LeaseDuration
+		retry = opts.Retry
+	)
+	if ngo <= 0 {
+		ngo = 8
+	}
+	if nacq <= 0 {
+		nacq = 10
+	}
+	if dur <= 0 {
+		dur = time.Minute
+	}
+	if retry == nil {
+		retry = &sqlutil.RetryPolicy{Base: time.Millisecond, Max: time.Millisecond, Jitter: -1}
+	}
+
+	var (
+		ctx        = context.Background()
+		holders    int32
+		violations int32
+		result     = ContentionResult{
+			Acquisitions: make([]int, ngo),
+			Waits:        make([]time.Duration, ngo),
+		}
+		wg sync.WaitGroup
+	)
+	for i := 0; i < ngo; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < nacq; j++ {
+				start := time.Now()
+				lease, err := l.AcquireWait(ctx, name, dur, retry)
+				result.Waits[i] += time.Since(start)
+				if err != nil {
+					t.Errorf("goroutine %d: acquiring lease: %s", i, err)
+					return
+				}
+				if atomic.AddInt32(&holders, 1) > 1 {
+					atomic.AddInt32(&violations, 1)
+				}
+				result.Acquisitions[i]++
+
+				if opts.Clock != nil {
+					opts.Clock.Advance(opts.Hold)
+				} else if opts.Hold > 0 {
+					time.Sleep(opts.Hold)
+				}
+
+				atomic.AddInt32(&holders, -1)
+				if err := lease.Release(ctx); err != nil {
+					t.Errorf("goroutine %d: releasing lease: %s", i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Violations = int(violations)
+	if result.Violations > 0 {
+		t.Errorf("lease %s held by more than one goroutine %d times", name, result.Violations)
+	}
+	return result
+}
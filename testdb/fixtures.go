@@ -0,0 +1,268 @@
+package testdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// Fixtures maps table names to rows,
+// each row mapping column names to values.
+//
+// A row may have a "_label" entry,
+// which is not a column,
+// naming the row so that other rows can refer to its values:
+// a string value of the form "@table.label.column"
+// is replaced with the value of that column in the row of that table with that label.
+// (Only values present in the fixtures can be referred to,
+// not values assigned by the database.)
+// Tables are loaded in dependency order,
+// so referenced rows are inserted before the rows referring to them.
+type Fixtures map[string][]map[string]interface{}
+
+// Decoders maps file extensions to functions decoding fixture files,
+// for ReadFixtures.
+// JSON is supported by default.
+// To support YAML,
+// register a YAML decoder, e.g.:
+//
+//	testdb.Decoders[".yaml"] = yaml.Unmarshal
+var Decoders = map[string]func([]byte, interface{}) error{
+	".json": json.Unmarshal,
+}
+
+// ReadFixtures reads and merges fixture files from fsys.
+// Each file must decode to an object mapping table names to arrays of rows,
+// as in Fixtures.
+// The decoder is chosen from Decoders by file extension.
+func ReadFixtures(fsys fs.FS, paths ...string) (Fixtures, error) {
+	result := make(Fixtures)
+	for _, p := range paths {
+		decode, ok := Decoders[path.Ext(p)]
+		if !ok {
+			return nil, fmt.Errorf("no decoder for %s", p)
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		var f Fixtures
+		if err = decode(b, &f); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", p, err)
+		}
+		for table, rows := range f {
+			result[table] = append(result[table], rows...)
+		}
+	}
+	return result, nil
+}
+
+const labelKey = "_label"
+
+// order returns the tables of f in dependency order.
+func (f Fixtures) order() ([]string, error) {
+	deps := make(map[string]map[string]bool)
+	for table, rows := range f {
+		deps[table] = make(map[string]bool)
+		for _, row := range rows {
+			for _, val := range row {
+				if ref, ok := parseRef(val); ok && ref.table != table {
+					deps[table][ref.table] = true
+				}
+			}
+		}
+	}
+
+	tables := make([]string, 0, len(f))
+	for table := range f {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var (
+		result []string
+		state  = make(map[string]int) // 1: visiting, 2: done
+		visit  func(string) error
+	)
+	visit = func(table string) error {
+		switch state[table] {
+		case 1:
+			return fmt.Errorf("circular fixture references involving %s", table)
+		case 2:
+			return nil
+		}
+		state[table] = 1
+		var ds []string
+		for d := range deps[table] {
+			ds = append(ds, d)
+		}
+		sort.Strings(ds)
+		for _, d := range ds {
+			if _, ok := f[d]; !ok {
+				return fmt.Errorf("table %s refers to table %s, which has no fixtures", table, d)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[table] = 2
+		result = append(result, table)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+type ref struct {
+	table, label, column string
+}
+
+func parseRef(val interface{}) (ref, bool) {
+	s, ok := val.(string)
+	if !ok || !strings.HasPrefix(s, "@") {
+		return ref{}, false
+	}
+	parts := strings.Split(s[1:], ".")
+	if len(parts) != 3 {
+		return ref{}, false
+	}
+	return ref{table: parts[0], label: parts[1], column: parts[2]}, true
+}
+
+func (f Fixtures) resolve(val interface{}) (interface{}, error) {
+	r, ok := parseRef(val)
+	if !ok {
+		return val, nil
+	}
+	for _, row := range f[r.table] {
+		if row[labelKey] == r.label {
+			v, ok := row[r.column]
+			if !ok {
+				return nil, fmt.Errorf("row %s.%s has no column %s", r.table, r.label, r.column)
+			}
+			return f.resolve(v)
+		}
+	}
+	return nil, fmt.Errorf("no row labeled %s in table %s", r.label, r.table)
+}
+
+// loaded is a row inserted by Load.
+type loaded struct {
+	table   string
+	columns []string
+	values  []interface{}
+}
+
+// Load inserts the rows of f into db
+// (using sqlutil.BulkInsert),
+// in dependency order.
+// It returns a function that deletes the inserted rows,
+// in reverse order.
+// Rows are deleted by matching all their non-nil column values.
+func (f Fixtures) Load(ctx context.Context, db sqlutil.ExecerContext) (teardown func(context.Context) error, err error) {
+	tables, err := f.order()
+	if err != nil {
+		return nil, err
+	}
+
+	var inserted []loaded
+	teardown = func(ctx context.Context) error {
+		for i := len(inserted) - 1; i >= 0; i-- {
+			l := inserted[i]
+			var (
+				conds []string
+				args  []interface{}
+			)
+			for j, col := range l.columns {
+				if l.values[j] == nil {
+					continue
+				}
+				args = append(args, l.values[j])
+				conds = append(conds, fmt.Sprintf("%s = $%d", col, len(args)))
+			}
+			if len(conds) == 0 {
+				continue
+			}
+			q := fmt.Sprintf("DELETE FROM %s WHERE %s", l.table, strings.Join(conds, " AND "))
+			if _, err := db.ExecContext(ctx, q, args...); err != nil {
+				return fmt.Errorf("deleting fixture from %s: %w", l.table, err)
+			}
+		}
+		return nil
+	}
+
+	for _, table := range tables {
+		// Group rows by column set, so each group can be bulk-inserted.
+		var (
+			groups  = make(map[string]int)
+			columns [][]string
+			rows    [][][]interface{}
+		)
+		for _, row := range f[table] {
+			var cols []string
+			for col := range row {
+				if col != labelKey {
+					cols = append(cols, col)
+				}
+			}
+			sort.Strings(cols)
+			vals := make([]interface{}, len(cols))
+			for i, col := range cols {
+				v, err := f.resolve(row[col])
+				if err != nil {
+					return teardown, fmt.Errorf("table %s: %w", table, err)
+				}
+				vals[i] = v
+			}
+			key := strings.Join(cols, ",")
+			g, ok := groups[key]
+			if !ok {
+				g = len(columns)
+				groups[key] = g
+				columns = append(columns, cols)
+				rows = append(rows, nil)
+			}
+			rows[g] = append(rows[g], vals)
+		}
+		for g, cols := range columns {
+			if err := sqlutil.BulkInsert(ctx, db, table, cols, rows[g]); err != nil {
+				return teardown, fmt.Errorf("loading fixtures into %s: %w", table, err)
+			}
+			for _, vals := range rows[g] {
+				inserted = append(inserted, loaded{table: table, columns: cols, values: vals})
+			}
+		}
+	}
+	return teardown, nil
+}
+
+// Setup loads f into db for the duration of the test,
+// deleting the rows again when the test finishes
+// (via t.Cleanup).
+func Setup(t testing.TB, db sqlutil.ExecerContext, f Fixtures) {
+	t.Helper()
+
+	ctx := context.Background()
+	teardown, err := f.Load(ctx, db)
+	if teardown != nil {
+		t.Cleanup(func() {
+			if err := teardown(ctx); err != nil {
+				t.Errorf("tearing down fixtures: %s", err)
+			}
+		})
+	}
+	if err != nil {
+		t.Fatalf("loading fixtures: %s", err)
+	}
+}
@@ -0,0 +1,193 @@
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// UpdateGolden, if true, causes AssertGolden to rewrite golden files instead of comparing against them.
+// Callers can wire it to a flag of their own,
+// e.g. in a test file:
+//
+//	func init() {
+//		flag.BoolVar(&testdb.UpdateGolden, "update-golden", false, "rewrite golden query files")
+//	}
+//
+// Setting the environment variable UPDATE_GOLDEN to a non-empty value has the same effect.
+var UpdateGolden bool
+
+func updateGolden() bool {
+	return UpdateGolden || os.Getenv("UPDATE_GOLDEN") != ""
+}
+
+// CapturedStatement is a statement recorded by a CaptureDB.
+type CapturedStatement struct {
+	Op    string // "prepare", "query", "queryrow", or "exec"
+	Query string // normalized with NormalizeQuery
+	Args  []interface{}
+}
+
+func (s CapturedStatement) String() string {
+	if len(s.Args) == 0 {
+		return fmt.Sprintf("%s: %s", s.Op, s.Query)
+	}
+	return fmt.Sprintf("%s: %s\n  args: %v", s.Op, s.Query, s.Args)
+}
+
+// CaptureDB is a sqlutil.DB that records every statement it executes
+// before passing it to an underlying DB.
+//
+// Statements executed in a transaction obtained from Begin are not captured,
+// since *sql.Tx cannot be intercepted.
+type CaptureDB struct {
+	db sqlutil.DB
+
+	mu    sync.Mutex
+	stmts []CapturedStatement
+}
+
+var _ sqlutil.DB = (*CaptureDB)(nil)
+
+// NewCaptureDB produces a new CaptureDB wrapping db.
+func NewCaptureDB(db sqlutil.DB) *CaptureDB {
+	return &CaptureDB{db: db}
+}
+
+func (c *CaptureDB) capture(op, query string, args []interface{}) {
+	c.mu.Lock()
+	c.stmts = append(c.stmts, CapturedStatement{Op: op, Query: NormalizeQuery(query), Args: args})
+	c.mu.Unlock()
+}
+
+// Statements returns the statements captured so far, in order.
+func (c *CaptureDB) Statements() []CapturedStatement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CapturedStatement(nil), c.stmts...)
+}
+
+// Reset discards the captured statements.
+func (c *CaptureDB) Reset() {
+	c.mu.Lock()
+	c.stmts = nil
+	c.mu.Unlock()
+}
+
+// PrepareContext implements sqlutil.PreparerContext.
+func (c *CaptureDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.capture("prepare", query, nil)
+	return c.db.PrepareContext(ctx, query)
+}
+
+// QueryContext implements sqlutil.QueryerContext.
+func (c *CaptureDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.capture("query", query, args)
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements sqlutil.QueryerContext.
+func (c *CaptureDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c.capture("queryrow", query, args)
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements sqlutil.ExecerContext.
+func (c *CaptureDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c.capture("exec", query, args)
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+// Begin implements sqlutil.DB.
+func (c *CaptureDB) Begin() (*sql.Tx, error) {
+	return c.db.Begin()
+}
+
+// NormalizeQuery collapses runs of whitespace outside quoted strings and identifiers to single spaces
+// and trims leading and trailing whitespace,
+// so that reformatting a query does not change its golden representation.
+func NormalizeQuery(query string) string {
+	var (
+		buf   strings.Builder
+		quote rune
+		space bool
+	)
+	for _, r := range strings.TrimSpace(query) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			space = true
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// AssertGolden compares the statements captured by c against the golden file at path,
+// failing the test on any difference.
+// If UpdateGolden is true
+// (or UPDATE_GOLDEN is set in the environment),
+// the golden file is (re)written instead.
+func AssertGolden(t testing.TB, path string, c *CaptureDB) {
+	t.Helper()
+
+	var buf strings.Builder
+	for _, s := range c.Statements() {
+		buf.WriteString(s.String())
+		buf.WriteString("\n")
+	}
+	got := buf.String()
+
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating golden directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("writing golden file: %s", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (set UPDATE_GOLDEN=1 to create it): %s", err)
+	}
+	if got == string(want) {
+		return
+	}
+
+	var (
+		gotLines  = strings.Split(got, "\n")
+		wantLines = strings.Split(string(want), "\n")
+	)
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("captured statements differ from %s at line %d:\n got: %s\nwant: %s", path, i+1, g, w)
+			return
+		}
+	}
+}
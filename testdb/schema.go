@@ -0,0 +1,108 @@
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// Server describes a shared database server
+// on which each test can get its own schema
+// (in Postgres)
+// or database
+// (in MySQL),
+// so that integration tests can run in parallel without interfering with one another.
+type Server struct {
+	// Admin is a connection to the server
+	// with permission to create and drop schemas or databases.
+	Admin *sql.DB
+
+	// Dialect is the server's SQL dialect.
+	// It must be sqlutil.Postgres or sqlutil.MySQL.
+	Dialect sqlutil.Dialect
+
+	// Driver is the database/sql driver name for connecting to the server.
+	Driver string
+
+	// DSN produces a data source name for connecting to the server
+	// with the given schema or database as the default.
+	// For Postgres see PostgresSchemaDSN.
+	DSN func(schema string) string
+}
+
+// NewSchema creates a uniquely named schema or database on s,
+// connects to it,
+// runs the given setup functions
+// (e.g. Migrations(s.Dialect, ...))
+// there,
+// and returns the connection.
+// The connection is closed and the schema or database dropped when the test finishes.
+func (s Server) NewSchema(t testing.TB, setup ...SetupFunc) *sql.DB {
+	t.Helper()
+
+	var createQFmt, dropQFmt string
+	switch s.Dialect {
+	case sqlutil.Postgres:
+		createQFmt, dropQFmt = "CREATE SCHEMA %s", "DROP SCHEMA %s CASCADE"
+	case sqlutil.MySQL:
+		createQFmt, dropQFmt = "CREATE DATABASE %s", "DROP DATABASE %s"
+	default:
+		t.Fatalf("per-test schemas are not supported for %s", s.Dialect)
+	}
+
+	var rnd [8]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		t.Fatalf("choosing schema name: %s", err)
+	}
+	name := "test_" + hex.EncodeToString(rnd[:])
+	quoted := s.Dialect.QuoteIdent(name)
+
+	ctx := context.Background()
+	if _, err := s.Admin.ExecContext(ctx, fmt.Sprintf(createQFmt, quoted)); err != nil {
+		t.Fatalf("creating schema %s: %s", name, err)
+	}
+	t.Cleanup(func() {
+		if _, err := s.Admin.ExecContext(context.Background(), fmt.Sprintf(dropQFmt, quoted)); err != nil {
+			t.Errorf("dropping schema %s: %s", name, err)
+		}
+	})
+
+	db, err := sql.Open(s.Driver, s.DSN(name))
+	if err != nil {
+		t.Fatalf("connecting to schema %s: %s", name, err)
+	}
+	// Registered after the drop, so it runs before it.
+	t.Cleanup(func() { db.Close() })
+
+	for _, fn := range setup {
+		if err := fn(ctx, db); err != nil {
+			t.Fatalf("setting up schema %s: %s", name, err)
+		}
+	}
+	return db
+}
+
+// PostgresSchemaDSN produces a Server.DSN function for Postgres
+// that adds a search_path parameter to base,
+// which may be in URL form
+// (postgres://...)
+// or key=value form.
+// This works with drivers that pass unrecognized parameters to the server,
+// such as github.com/lib/pq.
+func PostgresSchemaDSN(base string) func(string) string {
+	return func(schema string) string {
+		if u, err := url.Parse(base); err == nil && u.Scheme != "" {
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+		return base + " search_path=" + schema
+	}
+}
@@ -0,0 +1,104 @@
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// SQLiteDriver is the name of the database/sql driver NewSQLite uses.
+// The driver itself must be registered by the caller,
+// e.g. by importing github.com/mattn/go-sqlite3
+// (which registers "sqlite3", the default)
+// or modernc.org/sqlite
+// (which registers "sqlite").
+var SQLiteDriver = "sqlite3"
+
+// SetupFunc prepares a new test database,
+// e.g. by creating tables.
+type SetupFunc func(context.Context, *sql.DB) error
+
+// DDL produces a SetupFunc that executes the given statements in order.
+func DDL(stmts ...string) SetupFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		for _, stmt := range stmts {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("executing %s: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Migrations produces a SetupFunc that applies the given migrations with a sqlutil.Migrator.
+// The Migrator's versions table
+// (named schema_migrations)
+// is created first,
+// with column types for the given dialect
+// (see Migrator.EnsureTable).
+func Migrations(d sqlutil.Dialect, migrations ...sqlutil.Migration) SetupFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		m := sqlutil.NewMigrator(db)
+		if err := m.EnsureTable(ctx, d); err != nil {
+			return err
+		}
+		if err := m.Register(migrations...); err != nil {
+			return err
+		}
+		return m.Up(ctx)
+	}
+}
+
+// LessorTable produces a SetupFunc that creates the lease-info table for a Lessor
+// with the given configuration
+// (table and column names,
+// including the heartbeat column, if any).
+func LessorTable(l *sqlutil.Lessor) SetupFunc {
+	return func(ctx context.Context, db *sql.DB) error {
+		nl := sqlutil.NewLessor(db)
+		nl.Table, nl.Name, nl.Exp, nl.Key, nl.LastSeen = l.Table, l.Name, l.Exp, l.Key, l.LastSeen
+		return nl.EnsureTable(ctx, sqlutil.SQLite)
+	}
+}
+
+var sqliteCounter int64
+
+// NewSQLite opens a new,
+// isolated,
+// in-memory SQLite database using SQLiteDriver,
+// runs the given setup functions on it,
+// and returns it.
+// The database is closed
+// (and discarded)
+// when the test finishes.
+func NewSQLite(t testing.TB, setup ...SetupFunc) *sql.DB {
+	t.Helper()
+
+	// A named shared-cache in-memory database is visible to all of the pool's connections
+	// but not to other tests.
+	dsn := fmt.Sprintf("file:testdb_%d?mode=memory&cache=shared", atomic.AddInt64(&sqliteCounter, 1))
+	db, err := sql.Open(SQLiteDriver, dsn)
+	if err != nil {
+		t.Fatalf("opening SQLite database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// The database lasts only as long as some connection to it is open.
+	db.SetConnMaxLifetime(0)
+	db.SetMaxIdleConns(2)
+
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("connecting to SQLite database: %s", err)
+	}
+	for _, fn := range setup {
+		if err := fn(ctx, db); err != nil {
+			t.Fatalf("setting up SQLite database: %s", err)
+		}
+	}
+	return db
+}
@@ -0,0 +1,64 @@
+// Package testdb provides helpers for tests that use a real database.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+)
+
+// RunInRollback calls fn with a new transaction on db,
+// which is rolled back when fn returns
+// (even if it fails the test),
+// so that tests against a real database stay isolated from one another
+// without truncating tables between tests.
+func RunInRollback(t testing.TB, db sqlutil.DB, fn func(*sql.Tx)) {
+	t.Helper()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("beginning transaction: %s", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			t.Errorf("rolling back transaction: %s", err)
+		}
+	}()
+
+	fn(tx)
+}
+
+var savepointCounter int64
+
+// RunInSavepoint calls fn within a new savepoint in the existing transaction tx,
+// rolling back to the savepoint when fn returns
+// (even if it fails the test).
+// This isolates subtests that share a transaction from RunInRollback.
+func RunInSavepoint(t testing.TB, tx *sql.Tx, fn func(*sql.Tx)) {
+	t.Helper()
+
+	ctx := context.Background()
+	name := fmt.Sprintf("testdb_sp_%d", atomic.AddInt64(&savepointCounter, 1))
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		t.Fatalf("creating savepoint: %s", err)
+	}
+	defer func() {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			t.Errorf("rolling back to savepoint: %s", err)
+		}
+	}()
+
+	fn(tx)
+}
+
+// FailOnPlanRegression produces a callback for sqlutil.PlanGuard
+// that fails the test when a plan regression is detected.
+func FailOnPlanRegression(t testing.TB) func(sqlutil.PlanRegression) {
+	return func(r sqlutil.PlanRegression) {
+		t.Error(r)
+	}
+}
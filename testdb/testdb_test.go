@@ -0,0 +1,117 @@
+package testdb_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/testdb"
+)
+
+func TestNewSQLite(t *testing.T) {
+	db := testdb.NewSQLite(t, testdb.DDL(
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+		"INSERT INTO people (id, name) VALUES (1, 'alice'), (2, 'bob')",
+	))
+	testdb.AssertRowCount(t, db, "people", "", 2)
+	testdb.AssertExists(t, db, "people", "name = $1", "alice")
+	testdb.AssertNotExists(t, db, "people", "name = $1", "carol")
+
+	// Each call gets its own database.
+	other := testdb.NewSQLite(t)
+	var n int
+	if err := other.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'people'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("databases from separate NewSQLite calls are not isolated")
+	}
+}
+
+func TestLessorTable(t *testing.T) {
+	ctx := context.Background()
+
+	l := sqlutil.NewLessor(nil)
+	l.Table, l.LastSeen, l.StaleAfter = "locks", "last_seen", time.Minute
+
+	db := testdb.NewSQLite(t, testdb.LessorTable(l))
+	l = sqlutil.NewLessor(db)
+	l.Table, l.LastSeen, l.StaleAfter = "locks", "last_seen", time.Minute
+
+	lease, err := l.Acquire(ctx, "x", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.KeepAlive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := l.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "x" || infos[0].LastSeen.IsZero() {
+		t.Errorf("got leases %+v, want one named x with a last-seen time", infos)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	db := testdb.NewSQLite(t, testdb.Migrations(sqlutil.SQLite,
+		sqlutil.Migration{Version: 1, Up: "CREATE TABLE a (x INTEGER)"},
+		sqlutil.Migration{Version: 2, Up: "CREATE TABLE b (y INTEGER)"},
+	))
+	applied, err := sqlutil.NewMigrator(db).Applied(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Errorf("got applied versions %v, want [1 2]", applied)
+	}
+	testdb.AssertRowCount(t, db, "b", "", 0)
+}
+
+func TestRunInRollback(t *testing.T) {
+	db := testdb.NewSQLite(t, testdb.DDL("CREATE TABLE t (x INTEGER)"))
+	testdb.RunInRollback(t, db, func(tx *sql.Tx) {
+		if _, err := tx.Exec("INSERT INTO t (x) VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+		testdb.AssertRowCount(t, tx, "t", "", 1)
+	})
+	testdb.AssertRowCount(t, db, "t", "", 0)
+}
+
+func TestAssertGolden(t *testing.T) {
+	db := testdb.NewSQLite(t, testdb.DDL("CREATE TABLE t (x INTEGER)"))
+	c := testdb.NewCaptureDB(db)
+	if _, err := c.ExecContext(context.Background(), "INSERT INTO t\n  (x) VALUES ($1)", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "golden", "insert.txt")
+
+	testdb.UpdateGolden = true
+	testdb.AssertGolden(t, path, c)
+	testdb.UpdateGolden = false
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "exec: INSERT INTO t (x) VALUES ($1)\n  args: [7]\n"; string(got) != want {
+		t.Errorf("got golden file %q, want %q", got, want)
+	}
+	testdb.AssertGolden(t, path, c)
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	got := testdb.NormalizeQuery("  SELECT  a,\n\tb FROM t WHERE s = 'x   y'  ")
+	if want := "SELECT a, b FROM t WHERE s = 'x   y'"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrStatementTimeout is the error produced by ExecWithTimeout and InServerTimeout
+// when a statement exceeds its own timeout,
+// as distinct from the cancellation or expiration of the caller's context
+// (which is reported as the context's error).
+//
+// IsRetryable does not consider it retryable.
+// A RetryPolicy may retry it with a Retryable function like:
+//
+//	func(err error) bool {
+//		return errors.Is(err, sqlutil.ErrStatementTimeout) || sqlutil.IsRetryable(err)
+//	}
+var ErrStatementTimeout = errors.New("statement timeout")
+
+// ExecWithTimeout executes a statement,
+// canceling it if it runs longer than d.
+// If the statement is canceled for that reason,
+// the error wraps ErrStatementTimeout
+// (and not context.DeadlineExceeded).
+// If instead ctx is canceled or expires first,
+// the error is whatever the database handle reports for that.
+func ExecWithTimeout(ctx context.Context, db ExecerContext, d time.Duration, query string, args ...interface{}) (sql.Result, error) {
+	stmtCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	res, err := db.ExecContext(stmtCtx, query, args...)
+	if err != nil && ctx.Err() == nil && errors.Is(stmtCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s: %w", ErrStatementTimeout, d, err)
+	}
+	return res, err
+}
+
+var serverTimeoutCtxkey = ctxkeytype("servertimeout")
+
+// WithServerTimeout creates a child of the given context object
+// carrying a server-side statement timeout
+// for InServerTimeout calls made in it
+// that do not specify their own.
+func WithServerTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, serverTimeoutCtxkey, timeout)
+}
+
+// InServerTimeout calls fn with a handle on db
+// whose statements the database server itself cancels if they run longer than timeout,
+// so that runaway queries do not continue on the server after the client gives up on them.
+// If timeout is zero or less,
+// the one from WithServerTimeout is used,
+// and if there is none,
+// fn gets db unchanged.
+//
+// On Postgres,
+// fn runs in a transaction
+// (committed if fn returns nil)
+// with SET LOCAL statement_timeout,
+// which applies to every statement.
+// On MySQL,
+// SELECT queries made through the handle get a MAX_EXECUTION_TIME optimizer hint,
+// and other statements
+// (which MySQL does not time out)
+// are unaffected.
+// Other dialects have no server-side statement timeout,
+// and fn gets db unchanged.
+//
+// An error that fn returns because the server timed out a statement wraps ErrStatementTimeout.
+func InServerTimeout(ctx context.Context, db DB, d Dialect, timeout time.Duration, fn func(QueryExecerContext) error) error {
+	if timeout <= 0 {
+		timeout, _ = ctx.Value(serverTimeoutCtxkey).(time.Duration)
+	}
+	if timeout <= 0 {
+		return fn(db)
+	}
+
+	ms := timeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+
+	switch d {
+	case Postgres:
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)); err != nil {
+			return fmt.Errorf("setting statement timeout: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			return serverTimeoutErr(err, timeout)
+		}
+		return wrapf(tx.Commit(), "committing transaction")
+
+	case MySQL:
+		return serverTimeoutErr(fn(mysqlTimeoutDB{db: db, ms: ms}), timeout)
+
+	default:
+		return fn(db)
+	}
+}
+
+// mysqlTimeoutDB adds a MAX_EXECUTION_TIME hint to the SELECT queries made through it.
+type mysqlTimeoutDB struct {
+	db QueryExecerContext
+	ms int64
+}
+
+func (m mysqlTimeoutDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return m.db.QueryContext(ctx, mysqlTimeoutHint(query, m.ms), args...)
+}
+
+func (m mysqlTimeoutDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return m.db.QueryRowContext(ctx, mysqlTimeoutHint(query, m.ms), args...)
+}
+
+func (m mysqlTimeoutDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.db.ExecContext(ctx, query, args...)
+}
+
+// mysqlTimeoutHint inserts a MAX_EXECUTION_TIME hint after the SELECT keyword that begins query.
+// Queries that do not begin with SELECT are returned unchanged.
+func mysqlTimeoutHint(query string, ms int64) string {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if len(trimmed) < 6 || !strings.EqualFold(trimmed[:6], "SELECT") || (len(trimmed) > 6 && isIdentByte(trimmed[6])) {
+		return query
+	}
+	return fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */%s", ms, trimmed[6:])
+}
+
+// serverTimeoutErr wraps err with ErrStatementTimeout
+// if it reports that the server timed out a statement.
+func serverTimeoutErr(err error, timeout time.Duration) error {
+	if err == nil || errors.Is(err, ErrStatementTimeout) {
+		return err
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "canceling statement due to statement timeout") || // Postgres (SQLSTATE 57014)
+		strings.Contains(msg, "maximum statement execution time exceeded") { // MySQL (error 3024)
+		return fmt.Errorf("%w after %s: %w", ErrStatementTimeout, timeout, err)
+	}
+	return err
+}
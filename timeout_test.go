@@ -0,0 +1,41 @@
+package sqlutil_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bobg/sqlutil"
+)
+
+// driverError stands in for a driver's error type.
+type driverError struct{ code string }
+
+func (e *driverError) Error() string { return "driver error " + e.code }
+
+// slowExecer is an ExecerContext whose statements run until canceled.
+type slowExecer struct{}
+
+func (slowExecer) ExecContext(ctx context.Context, _ string, _ ...interface{}) (sql.Result, error) {
+	<-ctx.Done()
+	return nil, &driverError{code: "57014"}
+}
+
+func TestExecWithTimeout(t *testing.T) {
+	_, err := sqlutil.ExecWithTimeout(context.Background(), slowExecer{}, time.Millisecond, "SELECT pg_sleep(10)")
+	if !errors.Is(err, sqlutil.ErrStatementTimeout) {
+		t.Errorf("got error %v, want %v", err, sqlutil.ErrStatementTimeout)
+	}
+	var de *driverError
+	if !errors.As(err, &de) || de.code != "57014" {
+		t.Errorf("got error %v, want one wrapping the driver error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sqlutil.ExecWithTimeout(ctx, slowExecer{}, time.Hour, "SELECT pg_sleep(10)"); errors.Is(err, sqlutil.ErrStatementTimeout) {
+		t.Errorf("got %v when the caller's context was canceled", err)
+	}
+}
@@ -22,6 +22,18 @@ type (
 		ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
 	}
 
+	// QueryExecerContext has the methods of QueryerContext and ExecerContext.
+	// It is satisfied by *sql.DB, *sql.Tx, and *sql.Conn.
+	QueryExecerContext interface {
+		QueryerContext
+		ExecerContext
+	}
+
+	// PingerContext has a PingContext method.
+	PingerContext interface {
+		PingContext(context.Context) error
+	}
+
 	DB interface {
 		PreparerContext
 		QueryerContext
@@ -0,0 +1,222 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UpdateAll updates many rows of table from a slice of structs
+// (or pointers to structs),
+// mapped to columns by their `sql` struct tags
+// (see the package documentation).
+// Each struct identifies its row by the fields for keyCols,
+// or by its primary-key fields if keyCols is empty,
+// and supplies new values for its other columns.
+//
+// Rather than one statement per row,
+// UpdateAll uses one statement per batch of rows,
+// with as many rows per batch as d.MaxParams() allows:
+// on Postgres, UPDATE ... FROM (VALUES ...);
+// elsewhere, UPDATE ... SET col = CASE ... END.
+// The statements are not run in a transaction;
+// pass a *sql.Tx as db to make the whole update atomic.
+// UpdateAll returns the number of rows affected.
+func UpdateAll[T any](ctx context.Context, db ExecerContext, d Dialect, table string, keyCols []string, rows []T) (int64, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return 0, err
+	}
+
+	var keys, sets []structField
+	if len(keyCols) == 0 {
+		keys = pkFields(fields)
+		if len(keys) == 0 {
+			return 0, fmt.Errorf("%s has no primary-key fields", t)
+		}
+	} else {
+		byColumn := make(map[string]structField, len(fields))
+		for _, f := range fields {
+			byColumn[f.column] = f
+		}
+		for _, col := range keyCols {
+			f, ok := byColumn[col]
+			if !ok {
+				return 0, fmt.Errorf("no field in %s for key column %s", t, col)
+			}
+			keys = append(keys, f)
+		}
+	}
+	isKey := make(map[string]bool, len(keys))
+	for _, f := range keys {
+		isKey[f.column] = true
+	}
+	for _, f := range fields {
+		if !isKey[f.column] {
+			sets = append(sets, f)
+		}
+	}
+	if len(sets) == 0 {
+		return 0, fmt.Errorf("%s has no non-key fields", t)
+	}
+
+	var (
+		build     func([]reflect.Value) (string, []interface{})
+		paramsPer int
+	)
+	if d == Postgres {
+		build = func(batch []reflect.Value) (string, []interface{}) {
+			return updateAllValues(d, table, keys, sets, batch)
+		}
+		paramsPer = len(keys) + len(sets)
+	} else {
+		build = func(batch []reflect.Value) (string, []interface{}) {
+			return updateAllCase(d, table, keys, sets, batch)
+		}
+		paramsPer = len(sets)*(len(keys)+1) + len(keys)
+	}
+	perStmt := d.MaxParams() / paramsPer
+	if perStmt < 1 {
+		return 0, fmt.Errorf("too many columns for placeholder limit (%d)", d.MaxParams())
+	}
+
+	var total int64
+	for len(rows) > 0 {
+		batch := rows
+		if len(batch) > perStmt {
+			batch = batch[:perStmt]
+		}
+		rows = rows[len(batch):]
+
+		vals := make([]reflect.Value, 0, len(batch))
+		for _, row := range batch {
+			rv := reflect.ValueOf(row)
+			for rv.Kind() == reflect.Ptr {
+				if rv.IsNil() {
+					return total, fmt.Errorf("nil pointer")
+				}
+				rv = rv.Elem()
+			}
+			vals = append(vals, rv)
+		}
+
+		q, args := build(vals)
+		res, err := db.ExecContext(ctx, q, args...)
+		if err != nil {
+			return total, fmt.Errorf("updating database: %w", err)
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("counting affected rows: %w", err)
+		}
+		total += aff
+	}
+	return total, nil
+}
+
+// updateAllValues builds an UPDATE ... FROM (VALUES ...) statement for Postgres.
+// The placeholders in the first row of VALUES are cast to the columns' types,
+// since Postgres otherwise takes them to be text.
+func updateAllValues(d Dialect, table string, keys, sets []structField, batch []reflect.Value) (string, []interface{}) {
+	var (
+		cols   = append(append([]structField{}, keys...), sets...)
+		names  = make([]string, 0, len(cols))
+		assign = make([]string, 0, len(sets))
+		conds  = make([]string, 0, len(keys))
+		tuples = make([]string, 0, len(batch))
+		args   = make([]interface{}, 0, len(batch)*len(cols))
+	)
+	for _, f := range cols {
+		names = append(names, f.column)
+	}
+	for _, f := range sets {
+		col := f.column
+		assign = append(assign, fmt.Sprintf("%s = v.%s", col, col))
+	}
+	for _, f := range keys {
+		col := f.column
+		conds = append(conds, fmt.Sprintf("t.%s = v.%s", col, col))
+	}
+	for i, rv := range batch {
+		phs := make([]string, 0, len(cols))
+		for _, f := range cols {
+			args = append(args, rv.FieldByIndex(f.index).Interface())
+			ph := d.Placeholder(len(args))
+			if i == 0 {
+				if typ := castType(f); typ != "" {
+					ph += "::" + typ
+				}
+			}
+			phs = append(phs, ph)
+		}
+		tuples = append(tuples, "("+strings.Join(phs, ", ")+")")
+	}
+
+	const updQFmt = `UPDATE %s AS t SET %s FROM (VALUES %s) AS v (%s) WHERE %s`
+	q := fmt.Sprintf(updQFmt, table, strings.Join(assign, ", "), strings.Join(tuples, ", "), strings.Join(names, ", "), strings.Join(conds, " AND "))
+	return q, args
+}
+
+// castType returns the Postgres type to which a placeholder for f's value is cast,
+// or "" if it has no known type.
+func castType(f structField) string {
+	if f.dbType != "" {
+		return f.dbType
+	}
+	typ := f.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if base, ok := nullTypes[typ]; ok {
+		typ = base
+	}
+	dbType, err := columnType(Postgres, typ)
+	if err != nil {
+		return ""
+	}
+	return dbType
+}
+
+// updateAllCase builds an UPDATE ... SET col = CASE ... END statement.
+func updateAllCase(d Dialect, table string, keys, sets []structField, batch []reflect.Value) (string, []interface{}) {
+	var args []interface{}
+
+	// match produces the condition matching rv's key,
+	// adding the key values to args.
+	match := func(rv reflect.Value) string {
+		conds := make([]string, 0, len(keys))
+		for _, f := range keys {
+			args = append(args, rv.FieldByIndex(f.index).Interface())
+			conds = append(conds, fmt.Sprintf("%s = %s", f.column, d.Placeholder(len(args))))
+		}
+		return strings.Join(conds, " AND ")
+	}
+
+	assign := make([]string, 0, len(sets))
+	for _, f := range sets {
+		var b strings.Builder
+		col := f.column
+		fmt.Fprintf(&b, "%s = CASE", col)
+		for _, rv := range batch {
+			cond := match(rv)
+			args = append(args, rv.FieldByIndex(f.index).Interface())
+			fmt.Fprintf(&b, " WHEN %s THEN %s", cond, d.Placeholder(len(args)))
+		}
+		fmt.Fprintf(&b, " ELSE %s END", col)
+		assign = append(assign, b.String())
+	}
+
+	rowConds := make([]string, 0, len(batch))
+	for _, rv := range batch {
+		rowConds = append(rowConds, "("+match(rv)+")")
+	}
+
+	const updQFmt = `UPDATE %s SET %s WHERE %s`
+	q := fmt.Sprintf(updQFmt, table, strings.Join(assign, ", "), strings.Join(rowConds, " OR "))
+	return q, args
+}
@@ -0,0 +1,96 @@
+package sqlutil_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bobg/sqlutil"
+	"github.com/bobg/sqlutil/sqlmockutil"
+)
+
+type person struct {
+	ID    int64  `sql:"id,pk"`
+	Name  string `sql:"name"`
+	Score int    `sql:"score"`
+}
+
+func TestUpdateAll(t *testing.T) {
+	rows := []person{{1, "alice", 10}, {2, "bob", 20}}
+
+	cases := []struct {
+		d     sqlutil.Dialect
+		query string
+		args  []interface{}
+	}{{
+		d:     sqlutil.Postgres,
+		query: "UPDATE people AS t SET name = v.name, score = v.score FROM (VALUES ($1::BIGINT, $2::TEXT, $3::BIGINT), ($4, $5, $6)) AS v (id, name, score) WHERE t.id = v.id",
+		args:  []interface{}{int64(1), "alice", int64(10), int64(2), "bob", int64(20)},
+	}, {
+		d:     sqlutil.MySQL,
+		query: "UPDATE people SET name = CASE WHEN id = ? THEN ? WHEN id = ? THEN ? ELSE name END, score = CASE WHEN id = ? THEN ? WHEN id = ? THEN ? ELSE score END WHERE (id = ?) OR (id = ?)",
+		args:  []interface{}{int64(1), "alice", int64(2), "bob", int64(1), int64(10), int64(2), int64(20), int64(1), int64(2)},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.d.String(), func(t *testing.T) {
+			m := sqlmockutil.New()
+			defer m.Close()
+			m.AddResult(tc.query, 0, 2)
+
+			n, err := sqlutil.UpdateAll(context.Background(), m.DB(), tc.d, "people", nil, rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Errorf("got %d rows affected, want 2", n)
+			}
+			stmts := m.Statements()
+			if len(stmts) != 1 {
+				t.Fatalf("got %d statements, want 1", len(stmts))
+			}
+			if got := fmt.Sprint(stmts[0].Args); got != fmt.Sprint(tc.args) {
+				t.Errorf("got args %s, want %s", got, fmt.Sprint(tc.args))
+			}
+		})
+	}
+}
+
+func TestUpdateAllBatches(t *testing.T) {
+	// Each row of a CASE update takes 5 placeholders
+	// (two per set column and one for the WHERE clause),
+	// so SQLite's limit of 999 allows 199 rows per statement.
+	const numRows = 450
+
+	rows := make([]*person, 0, numRows)
+	for i := 0; i < numRows; i++ {
+		rows = append(rows, &person{ID: int64(i), Name: fmt.Sprintf("p%d", i), Score: i})
+	}
+
+	m := sqlmockutil.New()
+	defer m.Close()
+
+	for _, n := range []int{199, 199, 52} {
+		m.AddResult(caseUpdate(n), 0, int64(n))
+	}
+
+	n, err := sqlutil.UpdateAll(context.Background(), m.DB(), sqlutil.SQLite, "people", []string{"id"}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != numRows {
+		t.Errorf("got %d rows affected, want %d", n, numRows)
+	}
+	if stmts := m.Statements(); len(stmts) != 3 {
+		t.Errorf("got %d statements, want 3", len(stmts))
+	}
+}
+
+// caseUpdate is the statement UpdateAll produces on SQLite for n people.
+func caseUpdate(n int) string {
+	whens := strings.TrimSpace(strings.Repeat("WHEN id = ? THEN ? ", n))
+	where := strings.Repeat("(id = ?) OR ", n)
+	where = strings.TrimSuffix(where, " OR ")
+	return fmt.Sprintf("UPDATE people SET name = CASE %[1]s ELSE name END, score = CASE %[1]s ELSE score END WHERE %[2]s", whens, where)
+}
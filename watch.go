@@ -0,0 +1,191 @@
+package sqlutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeKind is the kind of change reported in a WatchEvent.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Changed
+	Removed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Changed:
+		return "changed"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// WatchEvent describes a change in the result of a watched query.
+type WatchEvent struct {
+	Kind ChangeKind
+
+	// Columns are the names of the query's result columns.
+	Columns []string
+
+	// Row is the new row.
+	// It is nil for Removed events.
+	Row []interface{}
+
+	// Old is the previous row.
+	// It is nil for Added events.
+	Old []interface{}
+}
+
+// Watcher re-runs a query periodically
+// (and, optionally, on notification),
+// compares its result with the previous one,
+// and reports added, changed, and removed rows.
+// Rows are matched between runs by their leading KeyColumns columns.
+// It is a cheap form of change-data capture,
+// suitable for small tables such as configuration.
+type Watcher struct {
+	DB    QueryerContext
+	Query string
+	Args  []interface{}
+
+	// Interval is how often to re-run the query.
+	Interval time.Duration
+
+	// KeyColumns is the number of leading result columns that identify a row.
+	// The default if this is unspecified is 1.
+	KeyColumns int
+
+	// Notifier and Channel,
+	// if set,
+	// cause the query to be re-run whenever a notification arrives on Channel,
+	// in addition to every Interval.
+	Notifier Notifier
+	Channel  string
+
+	prev     map[string][]interface{}
+	prevKeys []string
+}
+
+// Watch runs a Watcher for query that re-runs it every interval and calls fn for each change.
+// See Watcher.Run.
+func Watch(ctx context.Context, db QueryerContext, query string, interval time.Duration, fn func(WatchEvent) error, args ...interface{}) error {
+	w := &Watcher{DB: db, Query: query, Args: args, Interval: interval}
+	return w.Run(ctx, fn)
+}
+
+// Run runs w's query repeatedly until ctx is canceled,
+// calling fn for each change.
+// On the first run,
+// every row is reported as Added.
+// If fn returns an error,
+// Run stops and returns it.
+// Otherwise Run returns ctx.Err(),
+// or an error if the query fails.
+func (w *Watcher) Run(ctx context.Context, fn func(WatchEvent) error) error {
+	for {
+		if err := w.Poll(ctx, fn); err != nil {
+			return err
+		}
+		var channel string
+		if w.Notifier != nil {
+			channel = w.Channel
+		}
+		if err := waitFor(ctx, w.Notifier, channel, w.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Poll runs w's query once,
+// calling fn for each change since the previous run.
+// Removed rows are reported last.
+func (w *Watcher) Poll(ctx context.Context, fn func(WatchEvent) error) error {
+	rows, err := w.DB.QueryContext(ctx, w.Query, w.Args...)
+	if err != nil {
+		return fmt.Errorf("running query: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("getting columns: %w", err)
+	}
+	nkey := w.KeyColumns
+	if nkey <= 0 {
+		nkey = 1
+	}
+	if nkey > len(cols) {
+		return fmt.Errorf("%d key columns but only %d result columns", nkey, len(cols))
+	}
+
+	var (
+		cur     = make(map[string][]interface{})
+		curKeys []string
+		events  []WatchEvent
+	)
+	for rows.Next() {
+		row := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		key := watchKey(row[:nkey])
+		cur[key] = row
+		curKeys = append(curKeys, key)
+
+		old, ok := w.prev[key]
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Kind: Added, Columns: cols, Row: row})
+		case !reflect.DeepEqual(old, row):
+			events = append(events, WatchEvent{Kind: Changed, Columns: cols, Row: row, Old: old})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over rows: %w", err)
+	}
+
+	var removed []string
+	for _, key := range w.prevKeys {
+		if _, ok := cur[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		events = append(events, WatchEvent{Kind: Removed, Columns: cols, Old: w.prev[key]})
+	}
+
+	w.prev, w.prevKeys = cur, curKeys
+
+	for _, ev := range events {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func watchKey(vals []interface{}) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, "\x00")
+}